@@ -0,0 +1,68 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ugodiggi/go-thrift/parser"
+)
+
+// Exit codes of the compat command, beyond 1 for bad usage and 2 for
+// files that don't parse.
+const (
+	exitSourceBreaking = 3
+	exitWireBreaking   = 4
+)
+
+func parseForCompat(filename string) (map[string]*parser.Thrift, string, error) {
+	p := parser.New()
+	files, path, err := p.ParseFile(filename, parser.Debug(*flagParserDebug))
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := p.RenderTemplates(); err != nil {
+		return nil, "", err
+	}
+	return files, path, nil
+}
+
+// compat prints the incompatible changes from oldFilename to newFilename
+// and returns the exit code for the worst of them.
+func compat(w io.Writer, oldFilename, newFilename string) (int, error) {
+	oldFiles, oldPath, err := parseForCompat(oldFilename)
+	if err != nil {
+		return 2, err
+	}
+	newFiles, newPath, err := parseForCompat(newFilename)
+	if err != nil {
+		return 2, err
+	}
+	code := 0
+	for _, c := range parser.Compare(oldFiles, oldPath, newFiles, newPath) {
+		fmt.Fprintln(w, c.String())
+		switch {
+		case c.Severity == parser.WireBreaking:
+			code = exitWireBreaking
+		case code == 0:
+			code = exitSourceBreaking
+		}
+	}
+	return code, nil
+}
+
+func compatMain(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage of %s: [options] compat oldfile newfile\n", os.Args[0])
+		os.Exit(1)
+	}
+	code, err := compat(os.Stdout, args[0], args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,151 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/ugodiggi/go-thrift/parser"
+)
+
+type fmtOptions struct {
+	list  bool // print the names of the files whose formatting differs
+	diff  bool // print diffs
+	write bool // rewrite the files
+}
+
+// formatFile formats src, the contents of filename, and prints the result
+// or rewrites the file according to opts.
+func formatFile(w io.Writer, f *parser.Formatter, filename string, src []byte, opts fmtOptions) error {
+	res, err := f.Source(filename, src)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(src, res) {
+		if opts.list {
+			fmt.Fprintln(w, filename)
+		}
+		if opts.write {
+			info, err := os.Stat(filename)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+		if opts.diff {
+			d, err := diff(src, res, filename)
+			if err != nil {
+				return fmt.Errorf("computing diff: %s", err)
+			}
+			fmt.Fprintf(w, "diff -u %s.orig %s\n", filename, filename)
+			w.Write(d)
+		}
+	}
+	if !opts.list && !opts.write && !opts.diff {
+		_, err = w.Write(res)
+	}
+	return err
+}
+
+// diff returns the output of diff -u between a and b, the original and
+// formatted contents of filename.
+func diff(a, b []byte, filename string) ([]byte, error) {
+	fa, err := writeTemp(a)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(fa)
+	fb, err := writeTemp(b)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(fb)
+	out, err := exec.Command("diff", "-u", fa, fb).CombinedOutput()
+	if len(out) == 0 {
+		return nil, err
+	}
+	// diff exits with 1 when the files differ. Name them after filename
+	// rather than the temporary files.
+	if lines := bytes.SplitN(out, []byte("\n"), 3); len(lines) == 3 && bytes.HasPrefix(lines[0], []byte("--- ")) {
+		out = append([]byte(fmt.Sprintf("--- %s.orig\n+++ %s\n", filename, filename)), lines[2]...)
+	}
+	return out, nil
+}
+
+func writeTemp(data []byte) (string, error) {
+	f, err := ioutil.TempFile("", "go-thrift-fmt")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func fmtMain(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	var opts fmtOptions
+	flags.BoolVar(&opts.list, "l", false, "List files whose formatting differs")
+	flags.BoolVar(&opts.diff, "d", false, "Display diffs instead of rewriting files")
+	flags.BoolVar(&opts.write, "w", false, "Write the result to the files instead of stdout")
+	sortIncludes := flags.Bool("sortincludes", false, "Sort consecutive includes by path")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s: fmt [-l] [-d] [-w] [-sortincludes] [files]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	f := &parser.Formatter{SortIncludes: *sortIncludes}
+	report := func(err error) {
+		if errs, ok := err.(parser.ErrorList); ok {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s\n%s\n", e.Error(), e.Excerpt)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		}
+	}
+	if flags.NArg() == 0 {
+		if opts.write {
+			fmt.Fprintln(os.Stderr, "can't use -w on standard input")
+			os.Exit(1)
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err == nil {
+			err = formatFile(os.Stdout, f, "<standard input>", src, opts)
+		}
+		if err != nil {
+			report(err)
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+	code := 0
+	for _, filename := range flags.Args() {
+		src, err := ioutil.ReadFile(filename)
+		if err == nil {
+			err = formatFile(os.Stdout, f, filename, src, opts)
+		}
+		if err != nil {
+			report(err)
+			code = 2
+		}
+	}
+	os.Exit(code)
+}
@@ -4,9 +4,6 @@
 
 package main
 
-// TODO:
-// - Default arguments. Possibly don't bother...
-
 import (
 	"bytes"
 	"flag"
@@ -24,6 +21,8 @@ import (
 
 var (
 	flagGoBinarystring = flag.Bool("go.binarystring", false, "Always use string for binary instead of []byte")
+	flagGoCodec        = flag.Bool("go.codec", false, "Generate EncodeThrift and DecodeThrift methods instead of relying on reflection")
+	flagGoContext      = flag.Bool("go.context", false, "Generate clients and services whose methods take a context.Context")
 	flagGoImportPrefix = flag.String("go.importprefix", "", "Prefix for Thrift-generated go package imports")
 	flagGoJSONEnumnum  = flag.Bool("go.json.enumnum", false, "For JSON marshal enums by number instead of name")
 	flagGoPointers     = flag.Bool("go.pointers", false, "Make all fields pointers")
@@ -34,6 +33,8 @@ var (
 	goNamespaceOrder = []string{"go", "perl", "py", "cpp", "rb", "java"}
 )
 
+const thriftImportPath = "github.com/ugodiggi/go-thrift/thrift"
+
 type ErrUnknownType string
 
 func (e ErrUnknownType) Error() string {
@@ -60,6 +61,8 @@ type GoGenerator struct {
 	Format      bool
 	Pointers    bool
 	SignedBytes bool
+	Context     bool // Generate clients and services that take a context.Context, clients using ContextRPCClient
+	Codec       bool // Generate EncodeThrift and DecodeThrift methods for all structs
 }
 
 var goKeywords = map[string]bool{
@@ -207,6 +210,13 @@ func (g *GoGenerator) formatType(pkg string, thrift *parser.Thrift, typ *parser.
 		}
 		return ptr + name
 	}
+	if e := thrift.SEnums[typ.Name]; e != nil {
+		name := camelCase(e.Name)
+		if pkg != g.pkg {
+			name = pkg + "." + name
+		}
+		return ptr + name
+	}
 	if s := thrift.Structs[typ.Name]; s != nil {
 		name := camelCase(s.Name)
 		if pkg != g.pkg {
@@ -254,7 +264,7 @@ func (g *GoGenerator) resolveType(typ *parser.Type) string {
 	return typ.Name
 }
 
-func (g *GoGenerator) formatField(field *parser.Field) string {
+func (g *GoGenerator) formatField(field *parser.Field, union bool) string {
 	tags := ""
 	jsonTags := ""
 	if !field.Optional {
@@ -262,6 +272,9 @@ func (g *GoGenerator) formatField(field *parser.Field) string {
 	} else {
 		jsonTags = ",omitempty"
 	}
+	if union {
+		tags += ",union"
+	}
 	var opt typeOption
 	if field.Optional {
 		opt |= toOptional
@@ -362,7 +375,11 @@ func (g *GoGenerator) writeEnum(out io.Writer, enum *parser.Enum) error {
 
 	g.write(out, "\ntype %s int32\n", enumName)
 
-	valueNames := sortedKeys(enum.Values)
+	names := make([]string, len(enum.ValueList))
+	for i, v := range enum.ValueList {
+		names[i] = v.Name
+	}
+	valueNames := orderedKeys(names, enum.Values)
 	g.write(out, "\nconst (\n")
 	for _, name := range valueNames {
 		val := enum.Values[name]
@@ -432,6 +449,46 @@ func (e *%s) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+func (g *GoGenerator) writeSEnum(out io.Writer, enum *parser.SEnum) error {
+	enumName := camelCase(enum.Name)
+
+	g.write(out, "\ntype %s string\n", enumName)
+
+	values := make([]string, len(enum.ValueList))
+	for i, v := range enum.ValueList {
+		values[i] = v.Value
+	}
+	values = orderedKeys(values, enum.Values)
+	if len(values) == 0 {
+		g.write(out, `
+// IsValid reports whether e is one of the values of %s, which has none.
+func (e %s) IsValid() bool {
+	return false
+}
+`, enumName, enumName)
+		return nil
+	}
+	names := make([]string, len(values))
+	g.write(out, "\nconst (\n")
+	for i, value := range values {
+		names[i] = enumName + camelCase(value)
+		g.write(out, "\t%s %s = %q\n", names[i], enumName, value)
+	}
+	g.write(out, ")\n")
+
+	g.write(out, `
+// IsValid reports whether e is one of the values of %s.
+func (e %s) IsValid() bool {
+	switch e {
+	case %s:
+		return true
+	}
+	return false
+}
+`, enumName, enumName, strings.Join(names, ", "))
+	return nil
+}
+
 func (g *GoGenerator) writeStruct(out io.Writer, st *parser.Struct) error {
 	structName := camelCase(st.Name)
 
@@ -442,11 +499,56 @@ func (g *GoGenerator) writeStruct(out io.Writer, st *parser.Struct) error {
 			g.write(out, p)
 		}
 	}
+	union := g.thrift.Unions[st.Name] == st
 	g.write(out, "\ntype %s struct {\n", structName)
 	for _, field := range st.Fields {
-		g.write(out, "\t%s\n", g.formatField(field))
+		g.write(out, "\t%s\n", g.formatField(field, union))
+	}
+	g.write(out, "}\n")
+
+	if union {
+		g.writeUnion(out, structName, st)
+	}
+	if !union && hasDefaults(st) {
+		g.writeDefaults(out, structName, st)
+	}
+	if g.Codec {
+		g.writeCodec(out, structName, st, union)
+	}
+	return nil
+}
+
+// writeUnion writes the constants for the field IDs of a union, its Which
+// method and a setter for every field that clears the others.
+func (g *GoGenerator) writeUnion(out io.Writer, structName string, st *parser.Struct) {
+	if len(st.Fields) == 0 {
+		return
+	}
+	g.write(out, "\nconst (\n")
+	for _, field := range st.Fields {
+		g.write(out, "\t%sField%s = %d\n", structName, camelCase(field.Name), field.ID)
+	}
+	g.write(out, ")\n")
+
+	g.write(out, "\n// Which returns the ID of the field set in the union, or 0 if none is.\n")
+	g.write(out, "func (s *%s) Which() int {\n\tswitch {\n", structName)
+	for _, field := range st.Fields {
+		name := camelCase(field.Name)
+		g.write(out, "\tcase s.%s != nil:\n\t\treturn %sField%s\n", name, structName, name)
+	}
+	g.write(out, "\t}\n\treturn 0\n}\n")
+
+	for _, field := range st.Fields {
+		name := camelCase(field.Name)
+		goType := g.formatType(g.pkg, g.thrift, field.Type, toOptional)
+		_, th, typ := g.followTypedefs(g.pkg, g.thrift, field.Type)
+		value := "v"
+		if strings.HasPrefix(goType, "*") && !isStruct(th, typ.Name) {
+			goType = goType[1:]
+			value = "&v"
+		}
+		g.write(out, "\nfunc (s *%s) Set%s(v %s) {\n\t*s = %s{%s: %s}\n}\n", structName, name, goType, structName, name, value)
 	}
-	return g.write(out, "}\n")
 }
 
 func (g *GoGenerator) writeException(out io.Writer, ex *parser.Struct) error {
@@ -472,6 +574,18 @@ func (g *GoGenerator) writeException(out io.Writer, ex *parser.Struct) error {
 	return g.write(out, "}\n")
 }
 
+// contextArguments adds a context argument in front of the formatted
+// arguments of a method when generating with Context.
+func (g *GoGenerator) contextArguments(args string) string {
+	if !g.Context {
+		return args
+	}
+	if args == "" {
+		return "ctx context.Context"
+	}
+	return "ctx context.Context, " + args
+}
+
 func (g *GoGenerator) writeService(out io.Writer, svc *parser.Service) error {
 	svcName := camelCase(svc.Name)
 
@@ -481,12 +595,16 @@ func (g *GoGenerator) writeService(out io.Writer, svc *parser.Service) error {
 	if svc.Extends != "" {
 		g.write(out, "\t%s\n", camelCase(svc.Extends))
 	}
-	methodNames := sortedKeys(svc.Methods)
+	names := make([]string, len(svc.MethodList))
+	for i, m := range svc.MethodList {
+		names[i] = m.Name
+	}
+	methodNames := orderedKeys(names, svc.Methods)
 	for _, k := range methodNames {
 		method := svc.Methods[k]
 		g.write(out,
 			"\t%s(%s) %s\n",
-			camelCase(method.Name), g.formatArguments(method.Arguments),
+			camelCase(method.Name), g.contextArguments(g.formatArguments(method.Arguments)),
 			g.formatReturnType(method.ReturnType, false))
 	}
 	g.write(out, "}\n")
@@ -504,12 +622,26 @@ func (g *GoGenerator) writeService(out io.Writer, svc *parser.Service) error {
 	for _, k := range methodNames {
 		method := svc.Methods[k]
 		mName := camelCase(method.Name)
-		resArg := ""
+		// net/rpc only registers methods that take a reply argument, so
+		// one-way methods get a placeholder that's never written back.
+		resArg := ", _ *struct{}"
 		if !method.Oneway {
 			resArg = fmt.Sprintf(", res *%s%sResponse", svcName, mName)
 		}
 		g.write(out, "\nfunc (s *%sServer) %s(req *%s%sRequest%s) error {\n", svcName, mName, svcName, mName, resArg)
+		if g.Context {
+			// The method registered with net/rpc, which has no context.
+			res := "res"
+			if method.Oneway {
+				res = "nil"
+			}
+			g.write(out, "\treturn s.%sContext(context.Background(), req, %s)\n}\n", mName, res)
+			g.write(out, "\nfunc (s *%sServer) %sContext(ctx context.Context, req *%s%sRequest%s) error {\n", svcName, mName, svcName, mName, resArg)
+		}
 		var args []string
+		if g.Context {
+			args = append(args, "ctx")
+		}
 		for _, arg := range method.Arguments {
 			aName := camelCase(arg.Name)
 			args = append(args, "req."+aName)
@@ -537,6 +669,35 @@ func (g *GoGenerator) writeService(out io.Writer, svc *parser.Service) error {
 		g.write(out, "\treturn err\n}\n")
 	}
 
+	// Processor method table
+
+	g.write(out, "\nfunc (s *%sServer) ProcessorMethods() map[string]thrift.ProcessorMethod {\n", svcName)
+	if svc.Extends == "" {
+		g.write(out, "\tm := make(map[string]thrift.ProcessorMethod, %d)\n", len(methodNames))
+	} else {
+		g.write(out, "\tm := s.%sServer.ProcessorMethods()\n", camelCase(svc.Extends))
+	}
+	for _, k := range methodNames {
+		method := svc.Methods[k]
+		mName := camelCase(method.Name)
+		reqName := svcName + mName + "Request"
+		resName := svcName + mName + "Response"
+		g.write(out, "\tm[%q] = thrift.ProcessorMethod{\n", method.Name)
+		g.write(out, "\t\tNewRequest: func() interface{} { return &%s{} },\n", reqName)
+		res := "nil"
+		if !method.Oneway {
+			g.write(out, "\t\tNewResponse: func() interface{} { return &%s{} },\n", resName)
+			res = fmt.Sprintf("res.(*%s)", resName)
+		}
+		if g.Context {
+			g.write(out, "\t\tCallContext: func(ctx context.Context, req, res interface{}) error {\n\t\t\treturn s.%sContext(ctx, req.(*%s), %s)\n\t\t},\n", mName, reqName, res)
+		} else {
+			g.write(out, "\t\tCall: func(req, res interface{}) error {\n\t\t\treturn s.%s(req.(*%s), %s)\n\t\t},\n", mName, reqName, res)
+		}
+		g.write(out, "\t}\n")
+	}
+	g.write(out, "\treturn m\n}\n")
+
 	for _, k := range methodNames {
 		// Request struct
 		method := svc.Methods[k]
@@ -544,6 +705,10 @@ func (g *GoGenerator) writeService(out io.Writer, svc *parser.Service) error {
 		if err := g.writeStruct(out, &parser.Struct{Name: reqStructName, Fields: method.Arguments}); err != nil {
 			return err
 		}
+		// Lets thrift.RetryClient know that the call may be retried.
+		if annotation(method.Annotations, "idempotent") == "true" {
+			g.write(out, "\nfunc (r *%s) Idempotent() bool {\n\treturn true\n}\n", reqStructName)
+		}
 
 		if method.Oneway {
 			g.write(out, "\nfunc (r *%s) Oneway() bool {\n\treturn true\n}\n", reqStructName)
@@ -564,7 +729,11 @@ func (g *GoGenerator) writeService(out io.Writer, svc *parser.Service) error {
 	}
 
 	if svc.Extends == "" {
-		g.write(out, "\ntype %sClient struct {\n\tClient RPCClient\n}\n", svcName)
+		rpcClient := "RPCClient"
+		if g.Context {
+			rpcClient = "ContextRPCClient"
+		}
+		g.write(out, "\ntype %sClient struct {\n\tClient %s\n}\n", svcName, rpcClient)
 	} else {
 		g.write(out, "\ntype %sClient struct {\n\t%sClient\n}\n", svcName, camelCase(svc.Extends))
 	}
@@ -572,14 +741,13 @@ func (g *GoGenerator) writeService(out io.Writer, svc *parser.Service) error {
 	for _, k := range methodNames {
 		method := svc.Methods[k]
 		methodName := camelCase(method.Name)
-		returnType := "err error"
+		returnType := "(err error)"
 		if !method.Oneway {
 			returnType = g.formatReturnType(method.ReturnType, true)
 		}
+		args := g.contextArguments(g.formatArguments(method.Arguments))
 		g.write(out, "\nfunc (s *%sClient) %s(%s) %s {\n",
-			svcName, methodName,
-			g.formatArguments(method.Arguments),
-			returnType)
+			svcName, methodName, args, returnType)
 
 		// Request
 		g.write(out, "\treq := &%s%sRequest{\n", svcName, methodName)
@@ -597,7 +765,11 @@ func (g *GoGenerator) writeService(out io.Writer, svc *parser.Service) error {
 		}
 
 		// Call
-		g.write(out, "\terr = s.Client.Call(\"%s\", req, res)\n", method.Name)
+		if g.Context {
+			g.write(out, "\terr = s.Client.CallContext(ctx, \"%s\", req, res)\n", method.Name)
+		} else {
+			g.write(out, "\terr = s.Client.Call(\"%s\", req, res)\n", method.Name)
+		}
 
 		// Exceptions
 		if len(method.Exceptions) > 0 {
@@ -633,6 +805,9 @@ func (g *GoGenerator) generateSingle(out io.Writer, thriftPath string, thrift *p
 
 	// Imports
 	imports := []string{"fmt"}
+	if g.Context && len(thrift.Services) > 0 {
+		imports = append([]string{"context"}, imports...)
+	}
 	if len(thrift.Enums) > 0 {
 		imports = append(imports, "strconv")
 	}
@@ -648,6 +823,9 @@ func (g *GoGenerator) generateSingle(out io.Writer, thriftPath string, thrift *p
 			}
 		}
 	}
+	if len(thrift.Services) > 0 || (g.Codec && len(thrift.Structs)+len(thrift.Exceptions)+len(thrift.Unions) > 0) {
+		imports = append(imports, thriftImportPath)
+	}
 	if len(imports) > 0 {
 		g.write(out, "\nimport (\n")
 		for _, in := range imports {
@@ -660,21 +838,28 @@ func (g *GoGenerator) generateSingle(out io.Writer, thriftPath string, thrift *p
 
 	if len(thrift.Typedefs) > 0 {
 		g.write(out, "\n")
-		for _, k := range sortedKeys(thrift.Typedefs) {
+		for _, k := range definitionNames(thrift, "typedef", thrift.Typedefs) {
 			t := thrift.Typedefs[k]
 			g.write(out, "type %s %s\n", camelCase(k), g.formatType(g.pkg, g.thrift, t.Type, toNoPointer))
 		}
 	}
 
 	if len(thrift.Constants) > 0 {
-		for _, k := range sortedKeys(thrift.Constants) {
+		g.write(out, "\n")
+		for _, k := range definitionNames(thrift, "const", thrift.Constants) {
 			c := thrift.Constants[k]
-			v, err := g.formatValue(c.Value, c.Type)
-			if err != nil {
-				g.error(err)
+			_, th, typ := g.followTypedefs(g.pkg, g.thrift, c.Type)
+			var v string
+			if isStruct(th, typ.Name) {
+				v = g.defaultValue(g.pkg, g.thrift, c.Type, c.Value, g.thrift, 0)
+			} else {
+				var err error
+				if v, err = g.formatValue(c.Value, c.Type); err != nil {
+					g.error(err)
+				}
 			}
 
-			if c.Type.Name == "list" || c.Type.Name == "map" || c.Type.Name == "set" {
+			if c.Type.Name == "list" || c.Type.Name == "map" || c.Type.Name == "set" || isStruct(th, typ.Name) {
 				g.write(out, "var ")
 			} else {
 				g.write(out, "const ")
@@ -683,35 +868,42 @@ func (g *GoGenerator) generateSingle(out io.Writer, thriftPath string, thrift *p
 		}
 	}
 
-	for _, k := range sortedKeys(thrift.Enums) {
+	for _, k := range definitionNames(thrift, "enum", thrift.Enums) {
 		enum := thrift.Enums[k]
 		if err := g.writeEnum(out, enum); err != nil {
 			g.error(err)
 		}
 	}
 
-	for _, k := range sortedKeys(thrift.Structs) {
+	for _, k := range definitionNames(thrift, "senum", thrift.SEnums) {
+		enum := thrift.SEnums[k]
+		if err := g.writeSEnum(out, enum); err != nil {
+			g.error(err)
+		}
+	}
+
+	for _, k := range definitionNames(thrift, "struct", thrift.Structs) {
 		st := thrift.Structs[k]
 		if err := g.writeStruct(out, st); err != nil {
 			g.error(err)
 		}
 	}
 
-	for _, k := range sortedKeys(thrift.Exceptions) {
+	for _, k := range definitionNames(thrift, "exception", thrift.Exceptions) {
 		ex := thrift.Exceptions[k]
 		if err := g.writeException(out, ex); err != nil {
 			g.error(err)
 		}
 	}
 
-	for _, k := range sortedKeys(thrift.Unions) {
+	for _, k := range definitionNames(thrift, "union", thrift.Unions) {
 		un := thrift.Unions[k]
 		if err := g.writeStruct(out, un); err != nil {
 			g.error(err)
 		}
 	}
 
-	for _, k := range sortedKeys(thrift.Services) {
+	for _, k := range definitionNames(thrift, "service", thrift.Services) {
 		svc := thrift.Services[k]
 		if err := g.writeService(out, svc); err != nil {
 			g.error(err)
@@ -719,6 +911,60 @@ func (g *GoGenerator) generateSingle(out io.Writer, thriftPath string, thrift *p
 	}
 }
 
+// annotation returns the value of the annotation called name, or "" if there
+// is none.
+func annotation(annotations []*parser.Annotation, name string) string {
+	for _, a := range annotations {
+		if a.Name == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// definitionNames returns the names of the definitions of the given kind in
+// m, the map holding them, in the order they're declared in th.
+func definitionNames(th *parser.Thrift, kind string, m interface{}) []string {
+	var names []string
+	for _, d := range th.Definitions {
+		if d.Kind != kind {
+			continue
+		}
+		switch v := d.Value.(type) {
+		case *parser.Typedef:
+			names = append(names, v.Alias)
+		case *parser.Constant:
+			names = append(names, v.Name)
+		case *parser.Enum:
+			names = append(names, v.Name)
+		case *parser.SEnum:
+			names = append(names, v.Name)
+		case *parser.Struct:
+			names = append(names, v.Name)
+		case *parser.Service:
+			names = append(names, v.Name)
+		}
+	}
+	return orderedKeys(names, m)
+}
+
+// generateRPCStub writes the interfaces that generated clients use to make
+// calls, which are shared by all the services of a package.
+func (g *GoGenerator) generateRPCStub(out io.Writer, packageName string) {
+	g.write(out, "package %s\n", packageName)
+	if g.Context {
+		g.write(out, "\nimport \"context\"\n")
+	}
+	g.write(out, "\ntype RPCClient interface {\n"+
+		"\tCall(method string, request interface{}, response interface{}) error\n"+
+		"}\n")
+	if g.Context {
+		g.write(out, "\ntype ContextRPCClient interface {\n"+
+			"\tCallContext(ctx context.Context, method string, request interface{}, response interface{}) error\n"+
+			"}\n")
+	}
+}
+
 func (g *GoGenerator) Generate(outPath string) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -803,14 +1049,23 @@ func (g *GoGenerator) Generate(outPath string) (err error) {
 	for path, name := range rpcPackages {
 		outfile := filepath.Join(path, "rpc_stub.go")
 
+		out := &bytes.Buffer{}
+		g.generateRPCStub(out, name)
+
+		outBytes := out.Bytes()
+		if g.Format {
+			outBytes, err = format.Source(outBytes)
+			if err != nil {
+				g.error(err)
+			}
+		}
+
 		fi, err := os.OpenFile(outfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 			os.Exit(2)
 		}
-		_, err = fi.WriteString(fmt.Sprintf("package %s\n\ntype RPCClient interface {\n"+
-			"\tCall(method string, request interface{}, response interface{}) error\n"+
-			"}\n", name))
+		_, err = fi.Write(outBytes)
 		fi.Close()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
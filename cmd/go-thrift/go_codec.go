@@ -0,0 +1,373 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ugodiggi/go-thrift/parser"
+)
+
+// codecValue describes how the generated EncodeThrift and DecodeThrift
+// methods handle a value of some Go type. It mirrors what the reflection
+// based encoder and decoder of the thrift package do with the same type, so
+// that both produce the same output.
+type codecValue struct {
+	goType string // Go type as declared
+	kind   string // bool, byte, i16, i32, i64, double, string, binary, struct, list, set or map
+	base   string // Go type values are read and written as
+	ptr    bool   // goType is a pointer to a value, not a struct pointer
+	elem   *codecValue
+	key    *codecValue
+}
+
+var codecBasicTypes = map[string]struct{ wire, goType, method string }{
+	"bool":   {"TypeBool", "bool", "Bool"},
+	"byte":   {"TypeByte", "byte", "Byte"},
+	"i16":    {"TypeI16", "int16", "I16"},
+	"i32":    {"TypeI32", "int32", "I32"},
+	"i64":    {"TypeI64", "int64", "I64"},
+	"double": {"TypeDouble", "float64", "Double"},
+	"string": {"TypeString", "string", "String"},
+	"binary": {"TypeString", "[]byte", "Bytes"},
+}
+
+// wireType returns the name of the thrift package constant for the type
+// the value is sent as.
+func (cv *codecValue) wireType() string {
+	switch cv.kind {
+	case "struct":
+		return "thrift.TypeStruct"
+	case "list":
+		return "thrift.TypeList"
+	case "set":
+		return "thrift.TypeSet"
+	case "map":
+		return "thrift.TypeMap"
+	}
+	return "thrift." + codecBasicTypes[cv.kind].wire
+}
+
+// declared returns the declared Go type without its pointer.
+func (cv *codecValue) declared() string {
+	if cv.ptr {
+		return cv.goType[1:]
+	}
+	return cv.goType
+}
+
+// plain reports whether values are declared with their base type.
+func (cv *codecValue) plain() bool {
+	return !cv.ptr && cv.goType == cv.base
+}
+
+// value returns the expression converting expr, of the declared type, to
+// the base type.
+func (cv *codecValue) value(expr string) string {
+	if cv.ptr {
+		expr = "*" + expr
+	}
+	if cv.declared() != cv.base {
+		base := cv.base
+		if strings.HasPrefix(base, "*") {
+			base = "(" + base + ")"
+		}
+		expr = base + "(" + expr + ")"
+	}
+	return expr
+}
+
+// followInclude returns where a type named <include>.<type> is defined.
+func (g *GoGenerator) followInclude(pkg string, th *parser.Thrift, typ *parser.Type) (string, *parser.Thrift, *parser.Type) {
+	if !strings.Contains(typ.Name, ".") {
+		return pkg, th, typ
+	}
+	parts := strings.SplitN(typ.Name, ".", 2)
+	thriftFilename := th.Includes[parts[0]]
+	if thriftFilename == "" {
+		g.error(ErrMissingInclude(parts[0]))
+	}
+	th = g.ThriftFiles[thriftFilename]
+	if th == nil {
+		g.error(ErrMissingInclude(thriftFilename))
+	}
+	return g.Packages[thriftFilename].Name, th, &parser.Type{
+		Name:      parts[1],
+		KeyType:   typ.KeyType,
+		ValueType: typ.ValueType,
+	}
+}
+
+// followTypedefs follows includes and typedefs to the actual type.
+func (g *GoGenerator) followTypedefs(pkg string, th *parser.Thrift, typ *parser.Type) (string, *parser.Thrift, *parser.Type) {
+	pkg, th, typ = g.followInclude(pkg, th, typ)
+	for th.Typedefs[typ.Name] != nil {
+		pkg, th, typ = g.followInclude(pkg, th, th.Typedefs[typ.Name].Type)
+	}
+	return pkg, th, typ
+}
+
+// newCodecValue describes values of the Thrift type typ declared as goType.
+func (g *GoGenerator) newCodecValue(pkg string, th *parser.Thrift, typ *parser.Type, goType string) *codecValue {
+	pkg, th, typ = g.followTypedefs(pkg, th, typ)
+
+	cv := &codecValue{goType: goType, kind: typ.Name}
+	switch {
+	case typ.Name == "list":
+		elemType := g.formatType(pkg, th, typ.ValueType, 0)
+		if elemType == "byte" {
+			// A []byte is binary to the thrift package.
+			cv.kind = "binary"
+		} else {
+			cv.elem = g.newCodecValue(pkg, th, typ.ValueType, elemType)
+			cv.base = "[]" + elemType
+		}
+	case typ.Name == "set":
+		cv.key = g.newCodecValue(pkg, th, typ.ValueType, g.formatKeyType(pkg, th, typ.ValueType))
+		cv.base = "map[" + cv.key.goType + "]struct{}"
+	case typ.Name == "map":
+		cv.key = g.newCodecValue(pkg, th, typ.KeyType, g.formatKeyType(pkg, th, typ.KeyType))
+		cv.elem = g.newCodecValue(pkg, th, typ.ValueType, g.formatType(pkg, th, typ.ValueType, toNoPointer))
+		cv.base = "map[" + cv.key.goType + "]" + cv.elem.goType
+	case th.Enums[typ.Name] != nil:
+		cv.kind = "i32"
+	case th.SEnums[typ.Name] != nil:
+		cv.kind = "string"
+	case th.Structs[typ.Name] != nil || th.Exceptions[typ.Name] != nil || th.Unions[typ.Name] != nil:
+		cv.kind = "struct"
+		cv.base = g.formatType(pkg, th, typ, 0)
+	case codecBasicTypes[typ.Name].goType == "":
+		g.error(ErrUnknownType(typ.Name))
+	}
+	if cv.kind == "binary" && (*flagGoBinarystring || strings.TrimPrefix(goType, "*") == "string") {
+		cv.kind = "string"
+	}
+	if cv.base == "" {
+		cv.base = codecBasicTypes[cv.kind].goType
+	}
+	cv.ptr = strings.HasPrefix(goType, "*") && goType != cv.base
+	return cv
+}
+
+// codecField is a field of a struct being generated.
+type codecField struct {
+	*parser.Field
+	name  string
+	value *codecValue
+}
+
+func (g *GoGenerator) writeCodec(out io.Writer, structName string, st *parser.Struct, union bool) {
+	fields := make([]*codecField, len(st.Fields))
+	for i, field := range st.Fields {
+		var opt typeOption
+		if field.Optional {
+			opt |= toOptional
+		}
+		goType := g.formatType(g.pkg, g.thrift, field.Type, opt)
+		fields[i] = &codecField{field, camelCase(field.Name), g.newCodecValue(g.pkg, g.thrift, field.Type, goType)}
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].ID < fields[j].ID })
+
+	g.writeEncoder(out, structName, fields, union)
+	g.writeDecoder(out, structName, fields, union, !union && hasDefaults(st))
+}
+
+func (g *GoGenerator) writeEncoder(out io.Writer, structName string, fields []*codecField, union bool) {
+	g.write(out, "\nfunc (s *%s) EncodeThrift(w thrift.ProtocolWriter) error {\n", structName)
+	if union {
+		g.write(out, "\tset := 0\n")
+		for _, f := range fields {
+			g.write(out, "\tif s.%s != nil {\n\t\tset++\n\t}\n", f.name)
+		}
+		g.write(out, "\tif set != 1 {\n\t\treturn &thrift.InvalidUnionError{StructName: %q, Fields: set}\n\t}\n", structName)
+	}
+	g.write(out, "\tif err := w.WriteStructBegin(%q); err != nil {\n\t\treturn err\n\t}\n", structName)
+	for _, f := range fields {
+		expr := "s." + f.name
+		if f.Optional {
+			// Optional fields are always declared with a type that can be nil.
+			g.write(out, "\tif %s != nil {\n", expr)
+		} else if strings.HasPrefix(f.value.goType, "*") {
+			g.write(out, "\tif %s == nil {\n\t\treturn &thrift.MissingRequiredField{StructName: %q, FieldName: %q}\n\t}\n", expr, structName, f.name)
+		}
+		g.write(out, "\tif err := w.WriteFieldBegin(%q, %s, %d); err != nil {\n\t\treturn err\n\t}\n", f.name, f.value.wireType(), f.ID)
+		g.writeEncodeValue(out, f.value, expr, 1)
+		g.write(out, "\tif err := w.WriteFieldEnd(); err != nil {\n\t\treturn err\n\t}\n")
+		if f.Optional {
+			g.write(out, "\t}\n")
+		}
+	}
+	g.write(out, "\tif err := w.WriteFieldStop(); err != nil {\n\t\treturn err\n\t}\n")
+	g.write(out, "\treturn w.WriteStructEnd()\n}\n")
+}
+
+func (g *GoGenerator) writeEncodeValue(out io.Writer, cv *codecValue, expr string, depth int) {
+	v := cv.value(expr)
+	switch cv.kind {
+	case "struct":
+		g.write(out, "\tif err := %s.EncodeThrift(w); err != nil {\n\t\treturn err\n\t}\n", v)
+	case "list":
+		g.write(out, "\tif err := w.WriteListBegin(%s, len(%s)); err != nil {\n\t\treturn err\n\t}\n", cv.elem.wireType(), v)
+		g.write(out, "\tfor _, e%d := range %s {\n", depth, v)
+		g.writeEncodeValue(out, cv.elem, fmt.Sprintf("e%d", depth), depth+1)
+		g.write(out, "\t}\n\tif err := w.WriteListEnd(); err != nil {\n\t\treturn err\n\t}\n")
+	case "set":
+		g.write(out, "\tif err := w.WriteSetBegin(%s, len(%s)); err != nil {\n\t\treturn err\n\t}\n", cv.key.wireType(), v)
+		g.write(out, "\tfor k%d := range %s {\n", depth, v)
+		g.writeEncodeValue(out, cv.key, fmt.Sprintf("k%d", depth), depth+1)
+		g.write(out, "\t}\n\tif err := w.WriteSetEnd(); err != nil {\n\t\treturn err\n\t}\n")
+	case "map":
+		g.write(out, "\tif err := w.WriteMapBegin(%s, %s, len(%s)); err != nil {\n\t\treturn err\n\t}\n", cv.key.wireType(), cv.elem.wireType(), v)
+		g.write(out, "\tfor k%d, v%d := range %s {\n", depth, depth, v)
+		g.writeEncodeValue(out, cv.key, fmt.Sprintf("k%d", depth), depth+1)
+		g.writeEncodeValue(out, cv.elem, fmt.Sprintf("v%d", depth), depth+1)
+		g.write(out, "\t}\n\tif err := w.WriteMapEnd(); err != nil {\n\t\treturn err\n\t}\n")
+	default:
+		g.write(out, "\tif err := w.Write%s(%s); err != nil {\n\t\treturn err\n\t}\n", codecBasicTypes[cv.kind].method, v)
+	}
+}
+
+func (g *GoGenerator) writeDecoder(out io.Writer, structName string, fields []*codecField, union, defaults bool) {
+	g.write(out, "\nfunc (s *%s) DecodeThrift(r thrift.ProtocolReader) error {\n", structName)
+	if union {
+		g.write(out, "\t*s = %s{}\n\tset := 0\n", structName)
+	}
+	if defaults {
+		g.write(out, "\ts.SetDefaults()\n")
+	}
+	g.write(out, "\tif err := r.ReadStructBegin(); err != nil {\n\t\treturn err\n\t}\n")
+	var isset []string
+	for _, f := range fields {
+		if !f.Optional {
+			isset = append(isset, "isset"+f.name)
+		}
+	}
+	if len(isset) > 0 {
+		g.write(out, "\tvar %s bool\n", strings.Join(isset, ", "))
+	}
+	g.write(out, "\tfor {\n\t\tftype, id, err := r.ReadFieldBegin()\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n")
+	g.write(out, "\t\tif ftype == thrift.TypeStop {\n\t\t\tbreak\n\t\t}\n")
+	g.write(out, "\t\tswitch id {\n")
+	for _, f := range fields {
+		mismatch := fmt.Sprintf("&thrift.FieldTypeMismatch{StructName: %q, FieldName: %q, Type: %%s}", structName, f.name)
+		g.write(out, "\t\tcase %d:\n", f.ID)
+		g.write(out, "\t\t\tif ftype != %s {\n\t\t\t\treturn %s\n\t\t\t}\n", f.value.wireType(), fmt.Sprintf(mismatch, "ftype"))
+		g.writeDecodeValue(out, f.value, "s."+f.name, false, 1, mismatch)
+		if union {
+			g.write(out, "\t\t\tset++\n")
+		}
+		if !f.Optional {
+			g.write(out, "\t\t\tisset%s = true\n", f.name)
+		}
+	}
+	g.write(out, "\t\tdefault:\n\t\t\tif err := thrift.SkipValue(r, ftype); err != nil {\n\t\t\t\treturn err\n\t\t\t}\n\t\t}\n")
+	g.write(out, "\t\tif err := r.ReadFieldEnd(); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n")
+	g.write(out, "\tif err := r.ReadStructEnd(); err != nil {\n\t\treturn err\n\t}\n")
+	if union {
+		g.write(out, "\tif set != 1 {\n\t\treturn &thrift.InvalidUnionError{StructName: %q, Fields: set}\n\t}\n", structName)
+	}
+	for _, f := range fields {
+		if !f.Optional {
+			g.write(out, "\tif !isset%s {\n\t\treturn &thrift.MissingRequiredField{StructName: %q, FieldName: %q}\n\t}\n", f.name, structName, f.name)
+		}
+	}
+	g.write(out, "\treturn nil\n}\n")
+}
+
+// writeAssign assigns value, of the base type, to target.
+func (g *GoGenerator) writeAssign(out io.Writer, cv *codecValue, target, value string) {
+	if cv.declared() != cv.base {
+		value = cv.declared() + "(" + value + ")"
+		if cv.ptr {
+			g.write(out, "\tx := %s\n", value)
+			value = "x"
+		}
+	}
+	if cv.ptr {
+		value = "&" + value
+	}
+	g.write(out, "\t%s = %s\n", target, value)
+}
+
+// writeDecodeValue reads a value into target, declaring it first when
+// declare is set. mismatch formats the error for containers whose elements
+// aren't of the expected type.
+func (g *GoGenerator) writeDecodeValue(out io.Writer, cv *codecValue, target string, declare bool, depth int, mismatch string) {
+	if declare && (cv.kind == "list" || !cv.plain()) {
+		g.write(out, "\tvar %s %s\n", target, cv.goType)
+	}
+	switch cv.kind {
+	case "struct":
+		if cv.plain() {
+			op := "="
+			if declare {
+				op = ":="
+			}
+			g.write(out, "\t%s %s &%s{}\n", target, op, cv.base[1:])
+			g.write(out, "\tif err := %s.DecodeThrift(r); err != nil {\n\t\treturn err\n\t}\n", target)
+			return
+		}
+		g.write(out, "\t{\n\tst := &%s{}\n", cv.base[1:])
+		g.write(out, "\tif err := st.DecodeThrift(r); err != nil {\n\t\treturn err\n\t}\n")
+		g.writeAssign(out, cv, target, "st")
+		g.write(out, "\t}\n")
+	case "list":
+		c := target
+		if !declare || !cv.plain() {
+			c = fmt.Sprintf("l%d", depth)
+			g.write(out, "\tvar %s %s\n", c, cv.base)
+		}
+		g.write(out, "\tet%d, n%d, err := r.ReadListBegin()\n\tif err != nil {\n\t\treturn err\n\t}\n", depth, depth)
+		g.write(out, "\tif n%d > 0 && et%d != %s {\n\t\treturn %s\n\t}\n", depth, depth, cv.elem.wireType(), fmt.Sprintf(mismatch, fmt.Sprintf("et%d", depth)))
+		g.write(out, "\tfor i%d := 0; i%d < n%d; i%d++ {\n", depth, depth, depth, depth)
+		e := fmt.Sprintf("e%d", depth)
+		g.writeDecodeValue(out, cv.elem, e, true, depth+1, mismatch)
+		g.write(out, "\t%s = append(%s, %s)\n\t}\n", c, c, e)
+		g.write(out, "\tif err := r.ReadListEnd(); err != nil {\n\t\treturn err\n\t}\n")
+		if c != target {
+			g.writeAssign(out, cv, target, c)
+		}
+	case "set", "map":
+		c := target
+		if !declare || !cv.plain() {
+			c = fmt.Sprintf("m%d", depth)
+		}
+		g.write(out, "\t%s := make(%s)\n", c, cv.base)
+		k := fmt.Sprintf("k%d", depth)
+		if cv.kind == "set" {
+			g.write(out, "\tet%d, n%d, err := r.ReadSetBegin()\n\tif err != nil {\n\t\treturn err\n\t}\n", depth, depth)
+			g.write(out, "\tif n%d > 0 && et%d != %s {\n\t\treturn %s\n\t}\n", depth, depth, cv.key.wireType(), fmt.Sprintf(mismatch, fmt.Sprintf("et%d", depth)))
+			g.write(out, "\tfor i%d := 0; i%d < n%d; i%d++ {\n", depth, depth, depth, depth)
+			g.writeDecodeValue(out, cv.key, k, true, depth+1, mismatch)
+			g.write(out, "\t%s[%s] = struct{}{}\n\t}\n", c, k)
+			g.write(out, "\tif err := r.ReadSetEnd(); err != nil {\n\t\treturn err\n\t}\n")
+		} else {
+			v := fmt.Sprintf("v%d", depth)
+			g.write(out, "\tkt%d, vt%d, n%d, err := r.ReadMapBegin()\n\tif err != nil {\n\t\treturn err\n\t}\n", depth, depth, depth)
+			g.write(out, "\tif n%d > 0 && kt%d != %s {\n\t\treturn %s\n\t}\n", depth, depth, cv.key.wireType(), fmt.Sprintf(mismatch, fmt.Sprintf("kt%d", depth)))
+			g.write(out, "\tif n%d > 0 && vt%d != %s {\n\t\treturn %s\n\t}\n", depth, depth, cv.elem.wireType(), fmt.Sprintf(mismatch, fmt.Sprintf("vt%d", depth)))
+			g.write(out, "\tfor i%d := 0; i%d < n%d; i%d++ {\n", depth, depth, depth, depth)
+			g.writeDecodeValue(out, cv.key, k, true, depth+1, mismatch)
+			g.writeDecodeValue(out, cv.elem, v, true, depth+1, mismatch)
+			g.write(out, "\t%s[%s] = %s\n\t}\n", c, k, v)
+			g.write(out, "\tif err := r.ReadMapEnd(); err != nil {\n\t\treturn err\n\t}\n")
+		}
+		if c != target {
+			g.writeAssign(out, cv, target, c)
+		}
+	default:
+		read := "r.Read" + codecBasicTypes[cv.kind].method + "()"
+		if declare && cv.plain() {
+			g.write(out, "\t%s, err := %s\n\tif err != nil {\n\t\treturn err\n\t}\n", target, read)
+			return
+		}
+		g.write(out, "\tif v, err := %s; err != nil {\n\t\treturn err\n\t} else {\n", read)
+		g.writeAssign(out, cv, target, "v")
+		g.write(out, "\t}\n")
+	}
+}
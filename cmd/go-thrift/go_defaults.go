@@ -0,0 +1,240 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ugodiggi/go-thrift/parser"
+)
+
+func hasDefaults(st *parser.Struct) bool {
+	for _, field := range st.Fields {
+		if field.Default != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func isStruct(th *parser.Thrift, name string) bool {
+	return th.Structs[name] != nil || th.Exceptions[name] != nil || th.Unions[name] != nil
+}
+
+// writeDefaults writes the New<Struct> constructor and the SetDefaults
+// method of a struct with default values.
+func (g *GoGenerator) writeDefaults(out io.Writer, structName string, st *parser.Struct) {
+	g.write(out, "\nfunc New%s() *%s {\n\ts := &%s{}\n\ts.SetDefaults()\n\treturn s\n}\n", structName, structName, structName)
+	g.write(out, "\nfunc (s *%s) SetDefaults() {\n", structName)
+	for _, field := range st.Fields {
+		if field.Default == nil {
+			continue
+		}
+		var opt typeOption
+		if field.Optional {
+			opt |= toOptional
+		}
+		name := camelCase(field.Name)
+		goType := g.formatType(g.pkg, g.thrift, field.Type, opt)
+		_, th, typ := g.followTypedefs(g.pkg, g.thrift, field.Type)
+		if strings.HasPrefix(goType, "*") && !isStruct(th, typ.Name) {
+			g.write(out, "\ts.%s = new(%s)\n", name, goType[1:])
+			g.write(out, "\t*s.%s = %s\n", name, g.defaultValue(g.pkg, g.thrift, field.Type, field.Default, g.thrift, toNoPointer))
+		} else {
+			g.write(out, "\ts.%s = %s\n", name, g.defaultValue(g.pkg, g.thrift, field.Type, field.Default, g.thrift, opt))
+		}
+	}
+	g.write(out, "}\n")
+}
+
+// included returns the file included as name by th.
+func (g *GoGenerator) included(th *parser.Thrift, name string) *parser.Thrift {
+	if filename := th.Includes[name]; filename != "" {
+		return g.ThriftFiles[filename]
+	}
+	return nil
+}
+
+// constant returns the constant named by id in the scope of th, along with
+// the file that defines it.
+func (g *GoGenerator) constant(th *parser.Thrift, id string) (*parser.Constant, *parser.Thrift) {
+	parts := strings.Split(id, ".")
+	switch len(parts) {
+	case 1:
+		return th.Constants[id], th
+	case 2:
+		if inc := g.included(th, parts[0]); inc != nil {
+			return inc.Constants[parts[1]], inc
+		}
+	}
+	return nil, nil
+}
+
+// enumValue returns the enum value named by id, Enum.VALUE or
+// include.Enum.VALUE, in the scope of th.
+func (g *GoGenerator) enumValue(th *parser.Thrift, id string) (*parser.Enum, *parser.EnumValue) {
+	parts := strings.Split(id, ".")
+	if len(parts) == 3 {
+		th = g.included(th, parts[0])
+		parts = parts[1:]
+	}
+	if th == nil || len(parts) != 2 || th.Enums[parts[0]] == nil {
+		return nil, nil
+	}
+	e := th.Enums[parts[0]]
+	return e, e.Values[parts[1]]
+}
+
+// defaultValue returns an expression of the Go type of typ, formatted with
+// opt, for the constant value v. Identifiers in v are looked up in scope.
+// Constants are inlined so that every value gets its own copy of lists,
+// maps and structs.
+func (g *GoGenerator) defaultValue(pkg string, th *parser.Thrift, typ *parser.Type, v interface{}, scope *parser.Thrift, opt typeOption) string {
+	if id, ok := v.(parser.Identifier); ok {
+		if c, cth := g.constant(scope, string(id)); c != nil {
+			return g.defaultValue(pkg, th, typ, c.Value, cth, opt)
+		}
+	}
+
+	goType := g.formatType(pkg, th, typ, opt)
+	rpkg, rth, rtyp := g.followTypedefs(pkg, th, typ)
+	if strings.HasPrefix(goType, "*") && !isStruct(rth, rtyp.Name) {
+		// There's no other way to take the address of a constant in an
+		// expression.
+		return fmt.Sprintf("&[]%s{%s}[0]", goType[1:], g.defaultValue(pkg, th, typ, v, scope, toNoPointer))
+	}
+
+	switch rtyp.Name {
+	case "bool":
+		switch v {
+		case parser.Identifier("true"), int64(1):
+			return "true"
+		case parser.Identifier("false"), int64(0):
+			return "false"
+		}
+	case "byte", "i16", "i32", "i64":
+		switch v2 := v.(type) {
+		case int64:
+			return strconv.FormatInt(v2, 10)
+		case parser.Identifier:
+			if _, ev := g.enumValue(scope, string(v2)); ev != nil {
+				return strconv.Itoa(ev.Value)
+			}
+		}
+	case "double":
+		switch v2 := v.(type) {
+		case int64:
+			return strconv.FormatInt(v2, 10)
+		case float64:
+			return strconv.FormatFloat(v2, 'g', -1, 64)
+		}
+	case "string", "binary":
+		if s, ok := v.(string); ok {
+			if rtyp.Name == "binary" && !*flagGoBinarystring {
+				return goType + "(" + strconv.Quote(s) + ")"
+			}
+			return strconv.Quote(s)
+		}
+	case "list", "set":
+		if vs, ok := v.([]interface{}); ok {
+			elems := make([]string, len(vs))
+			for i, e := range vs {
+				if rtyp.Name == "set" {
+					elems[i] = g.defaultKey(rpkg, rth, rtyp.ValueType, e, scope) + ": {}"
+				} else {
+					elems[i] = g.defaultValue(rpkg, rth, rtyp.ValueType, e, scope, 0)
+				}
+			}
+			return goType + "{" + strings.Join(elems, ", ") + "}"
+		}
+	case "map":
+		if kvs, ok := v.([]parser.KeyValue); ok {
+			elems := make([]string, len(kvs))
+			for i, kv := range kvs {
+				elems[i] = g.defaultKey(rpkg, rth, rtyp.KeyType, kv.Key, scope) + ": " +
+					g.defaultValue(rpkg, rth, rtyp.ValueType, kv.Value, scope, toNoPointer)
+			}
+			return goType + "{" + strings.Join(elems, ", ") + "}"
+		}
+	default:
+		if e := rth.Enums[rtyp.Name]; e != nil {
+			switch v2 := v.(type) {
+			case int64:
+				return strconv.FormatInt(v2, 10)
+			case parser.Identifier:
+				ve, ev := g.enumValue(scope, string(v2))
+				if ev == nil {
+					break
+				}
+				if ve != e {
+					return strconv.Itoa(ev.Value)
+				}
+				name := camelCase(e.Name) + camelCase(ev.Name)
+				if rpkg != g.pkg {
+					name = rpkg + "." + name
+				}
+				return name
+			}
+		} else if s, ok := v.(string); ok && rth.SEnums[rtyp.Name] != nil {
+			return strconv.Quote(s)
+		} else if kvs, ok := v.([]parser.KeyValue); ok && isStruct(rth, rtyp.Name) {
+			return g.defaultStruct(rpkg, rth, rtyp, kvs, scope)
+		}
+	}
+	g.error(fmt.Errorf("invalid value %v for type %s", v, typ.Name))
+	return ""
+}
+
+// defaultKey is defaultValue for map and set keys, which are never pointers
+// and use string instead of []byte.
+func (g *GoGenerator) defaultKey(pkg string, th *parser.Thrift, typ *parser.Type, v interface{}, scope *parser.Thrift) string {
+	if s, ok := v.(string); ok && g.formatKeyType(pkg, th, typ) == "string" {
+		return strconv.Quote(s)
+	}
+	return g.defaultValue(pkg, th, typ, v, scope, toNoPointer)
+}
+
+// defaultStruct returns a struct literal with the fields set in kvs, and
+// the default values of the other fields.
+func (g *GoGenerator) defaultStruct(pkg string, th *parser.Thrift, typ *parser.Type, kvs []parser.KeyValue, scope *parser.Thrift) string {
+	st := th.Structs[typ.Name]
+	if st == nil {
+		st = th.Exceptions[typ.Name]
+	}
+	if st == nil {
+		st = th.Unions[typ.Name]
+	}
+	values := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		name, ok := kv.Key.(string)
+		if !ok {
+			g.error(fmt.Errorf("invalid field name %v for struct %s", kv.Key, st.Name))
+		}
+		values[name] = kv.Value
+	}
+	var elems []string
+	for _, field := range st.Fields {
+		v, fieldScope := values[field.Name], scope
+		delete(values, field.Name)
+		if v == nil {
+			v, fieldScope = field.Default, th
+		}
+		if v == nil {
+			continue
+		}
+		var opt typeOption
+		if field.Optional {
+			opt |= toOptional
+		}
+		elems = append(elems, camelCase(field.Name)+": "+g.defaultValue(pkg, th, field.Type, v, fieldScope, opt))
+	}
+	for name := range values {
+		g.error(fmt.Errorf("struct %s has no field %s", st.Name, name))
+	}
+	return "&" + g.formatType(pkg, th, typ, 0)[1:] + "{" + strings.Join(elems, ", ") + "}"
+}
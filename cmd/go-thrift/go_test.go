@@ -15,7 +15,7 @@ import (
 )
 
 func TestSimple(t *testing.T) {
-	files, err := filepath.Glob("../testfiles/generator/*.thrift")
+	files, err := filepath.Glob("../../testfiles/generator/*.thrift")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -48,7 +48,7 @@ func TestSimple(t *testing.T) {
 }
 
 func TestFlagGoSignedBytes(t *testing.T) {
-	files, err := filepath.Glob("../testfiles/generator/withFlags/go.signedbytes/*.thrift")
+	files, err := filepath.Glob("../../testfiles/generator/withFlags/go.signedbytes/*.thrift")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -59,7 +59,7 @@ func TestFlagGoSignedBytes(t *testing.T) {
 	}
 	defer os.RemoveAll(outPath)
 
-	p := &parser.Parser{}
+	p := parser.New()
 	for _, fn := range files {
 		t.Logf("Testing %s", fn)
 		th, _, err := p.ParseFile(fn)
@@ -81,6 +81,73 @@ func TestFlagGoSignedBytes(t *testing.T) {
 	}
 }
 
+func TestFlagGoContext(t *testing.T) {
+	files, err := filepath.Glob("../../testfiles/generator/withFlags/go.context/*.thrift")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outPath, err := ioutil.TempDir("", "go-thrift-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outPath)
+
+	p := parser.New()
+	for _, fn := range files {
+		t.Logf("Testing %s", fn)
+		th, _, err := p.ParseFile(fn)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %s", fn, err)
+		}
+		generator := &GoGenerator{
+			ThriftFiles: th,
+			Format:      true,
+			Context:     true,
+		}
+		if err := generator.Generate(outPath); err != nil {
+			t.Fatalf("Failed to generate go for %s: %s", fn, err)
+		}
+		base := fn[:len(fn)-len(".thrift")]
+		name := filepath.Base(base)
+		compareFiles(t, outPath+"/gentest/"+name+".go", base+".go")
+		compareFiles(t, outPath+"/gentest/rpc_stub.go", filepath.Join(filepath.Dir(fn), "rpc_stub.go"))
+	}
+}
+
+func TestFlagGoCodec(t *testing.T) {
+	files, err := filepath.Glob("../../testfiles/generator/withFlags/go.codec/*.thrift")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outPath, err := ioutil.TempDir("", "go-thrift-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outPath)
+
+	p := parser.New()
+	for _, fn := range files {
+		t.Logf("Testing %s", fn)
+		th, _, err := p.ParseFile(fn)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %s", fn, err)
+		}
+		generator := &GoGenerator{
+			ThriftFiles: th,
+			Format:      true,
+			Codec:       true,
+		}
+		if err := generator.Generate(outPath); err != nil {
+			t.Fatalf("Failed to generate go for %s: %s", fn, err)
+		}
+		base := fn[:len(fn)-len(".thrift")]
+		name := filepath.Base(base)
+		compareFiles(t, outPath+"/gentest/"+name+".go", base+".go")
+	}
+}
+
 func compareFiles(t *testing.T, actualPath, expectedPath string) {
 	ac, err := ioutil.ReadFile(actualPath)
 	if err != nil {
@@ -94,3 +161,124 @@ func compareFiles(t *testing.T, actualPath, expectedPath string) {
 		t.Fatalf("Expected\n%s\ngot\n%s", string(ex), string(ac))
 	}
 }
+
+func TestSEnumInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-thrift-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"common.thrift": "namespace go common\nsenum Mode {\n\tON,\n\tOFF,\n}\n",
+		"main.thrift":   "namespace go gentest\ninclude \"common.thrift\"\nstruct Config {\n\t1: common.Mode mode = \"ON\",\n\t2: map<common.Mode, string> labels,\n}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	th, _, err := parser.New().ParseFile(filepath.Join(dir, "main.thrift"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator := &GoGenerator{
+		ThriftFiles: th,
+		Format:      true,
+		Codec:       true,
+	}
+	if err := generator.Generate(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.ReadFile(filepath.Join(dir, "common", "common.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out, []byte("type Mode string")) {
+		t.Fatalf("Expected the senum type in\n%s", out)
+	}
+	out, err = ioutil.ReadFile(filepath.Join(dir, "gentest", "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"map[common.Mode]string", "s.Mode = common.Mode(v)", "w.WriteString(string(s.Mode))"} {
+		if !bytes.Contains(out, []byte(s)) {
+			t.Fatalf("Expected %q in\n%s", s, out)
+		}
+	}
+}
+
+func TestCompat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-thrift-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"v1.thrift":      "struct S {\n\t1: i32 id,\n\t2: string name,\n}\n",
+		"v2.thrift":      "struct S {\n\t1: i32 id,\n\t2: string name,\n\t3: optional i64 created,\n}\n",
+		"renamed.thrift": "struct S {\n\t1: i32 id,\n\t2: string title,\n}\n",
+		"retyped.thrift": "struct S {\n\t1: i64 id,\n\t2: string name,\n}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		newFile string
+		code    int
+	}{
+		{"v2.thrift", 0},
+		{"renamed.thrift", exitSourceBreaking},
+		{"retyped.thrift", exitWireBreaking},
+	} {
+		var out bytes.Buffer
+		code, err := compat(&out, filepath.Join(dir, "v1.thrift"), filepath.Join(dir, tc.newFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tc.code {
+			t.Errorf("Expected exit code %d for %s instead of %d:\n%s", tc.code, tc.newFile, code, out.String())
+		}
+	}
+}
+
+func TestFmt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-thrift-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "s.thrift")
+	src := []byte("struct S { 1: i32 id; 2: string name }\n")
+	if err := ioutil.WriteFile(filename, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := &parser.Formatter{}
+	var out bytes.Buffer
+	if err := formatFile(&out, f, filename, src, fmtOptions{list: true, write: true}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != filename+"\n" {
+		t.Errorf("Expected -l to list %s instead of %q", filename, out.String())
+	}
+	formatted, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "struct S {\n  1: i32 id,\n  2: string name,\n}\n"; string(formatted) != expected {
+		t.Fatalf("Expected -w to write\n%s\ninstead of\n%s", expected, formatted)
+	}
+
+	out.Reset()
+	if err := formatFile(&out, f, filename, formatted, fmtOptions{list: true}); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected -l to list nothing for a formatted file instead of %q", out.String())
+	}
+}
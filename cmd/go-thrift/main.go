@@ -77,11 +77,39 @@ func sortedKeys(m interface{}) []string {
 	return keys
 }
 
+// orderedKeys returns names, the keys of the map m in declaration order,
+// followed by the sorted keys of m that aren't in names, such as structs
+// rendered from templates or entries added to a hand-built AST.
+func orderedKeys(names []string, m interface{}) []string {
+	seen := make(map[string]bool, len(names))
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			keys = append(keys, name)
+		}
+	}
+	for _, k := range sortedKeys(m) {
+		if !seen[k] {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
 func main() {
 	flag.Parse()
 
+	switch flag.Arg(0) {
+	case "compat":
+		compatMain(flag.Args()[1:])
+	case "fmt":
+		fmtMain(flag.Args()[1:])
+	}
 	if flag.NArg() < 2 {
 		fmt.Fprintf(os.Stderr, "Usage of %s: [options] inputfile outputpath\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s: [options] compat oldfile newfile\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s: fmt [-l] [-d] [-w] [-sortincludes] [files]\n", os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
@@ -91,7 +119,12 @@ func main() {
 
 	p := parser.New()
 	parsedThrift, _, err := p.ParseFile(filename, parser.Debug(*flagParserDebug))
-	if err != nil {
+	if errs, ok := err.(parser.ErrorList); ok {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%s\n%s\n", e.Error(), e.Excerpt)
+		}
+		os.Exit(2)
+	} else if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 		os.Exit(2)
 	} else if *flagDebug {
@@ -106,10 +139,19 @@ func main() {
 	}
 	parsedThrift = pp.Files
 
+	if diags := parser.Validate(parsedThrift); len(diags) != 0 {
+		for _, d := range diags {
+			fmt.Fprintln(os.Stderr, d.Error())
+		}
+		os.Exit(2)
+	}
+
 	generator := &GoGenerator{
 		ThriftFiles: parsedThrift,
 		Format:      true,
 		SignedBytes: *flagGoSignedBytes,
+		Context:     *flagGoContext,
+		Codec:       *flagGoCodec,
 	}
 	err = generator.Generate(outpath)
 	if err != nil {
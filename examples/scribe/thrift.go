@@ -4,6 +4,7 @@ package scribe
 
 import (
 	"fmt"
+	"github.com/ugodiggi/go-thrift/thrift"
 	"strconv"
 )
 
@@ -64,6 +65,18 @@ func (s *ScribeServer) Log(req *ScribeLogRequest, res *ScribeLogResponse) error
 	return err
 }
 
+func (s *ScribeServer) ProcessorMethods() map[string]thrift.ProcessorMethod {
+	m := make(map[string]thrift.ProcessorMethod, 1)
+	m["Log"] = thrift.ProcessorMethod{
+		NewRequest:  func() interface{} { return &ScribeLogRequest{} },
+		NewResponse: func() interface{} { return &ScribeLogResponse{} },
+		Call: func(req, res interface{}) error {
+			return s.Log(req.(*ScribeLogRequest), res.(*ScribeLogResponse))
+		},
+	}
+	return m
+}
+
 type ScribeLogRequest struct {
 	Messages []*LogEntry `thrift:"1,required" json:"messages"`
 }
@@ -15,9 +15,9 @@ func main() {
 	}
 
 	t := thrift.NewTransport(thrift.NewFramedReadWriteCloser(conn, 0), thrift.BinaryProtocol)
-	client := thrift.NewClient(t, false)
+	client := thrift.NewNativeClient(t, false)
 	scr := scribe.ScribeClient{Client: client}
-	res, err := scr.Log([]*scribe.LogEntry{{"category", "message"}})
+	res, err := scr.Log([]*scribe.LogEntry{{Category: "category", Message: "message"}})
 	if err != nil {
 		panic(err)
 	}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"net/rpc"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/ugodiggi/go-thrift/examples/scribe"
 	"github.com/ugodiggi/go-thrift/thrift"
@@ -22,20 +26,31 @@ func (s *scribeServiceImplementation) Log(messages []*scribe.LogEntry) (scribe.R
 
 func main() {
 	scribeService := new(scribeServiceImplementation)
-	rpc.RegisterName("Thrift", &scribe.ScribeServer{Implementation: scribeService})
+	server := &thrift.Server{
+		Processor: &scribe.ScribeServer{Implementation: scribeService},
+	}
 
 	ln, err := net.Listen("tcp", ":1463")
 	if err != nil {
 		panic(err)
 	}
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			fmt.Printf("ERROR: %+v\n", err)
-			continue
+
+	// Let the requests in flight finish before exiting.
+	done := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "shutdown: %s\n", err)
 		}
-		fmt.Printf("New connection %+v\n", conn)
-		t := thrift.NewTransport(thrift.NewFramedReadWriteCloser(conn, 0), thrift.BinaryProtocol)
-		go rpc.ServeCodec(thrift.NewServerCodec(t))
+		close(done)
+	}()
+
+	if err := server.Serve(ln); err != thrift.ErrServerClosed {
+		panic(err)
 	}
+	<-done
 }
@@ -0,0 +1,400 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Severity tells who is affected by a Change.
+type Severity int
+
+const (
+	// SourceBreaking changes keep the wire format but break code generated
+	// from the old file, e.g. renaming a field.
+	SourceBreaking Severity = iota + 1
+	// WireBreaking changes break peers still using the old file, e.g.
+	// changing the ID or type of a field.
+	WireBreaking
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SourceBreaking:
+		return "source-breaking"
+	case WireBreaking:
+		return "wire-breaking"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Change is an incompatible difference found by Compare. Filename and Pos
+// are in the new files, or in the old ones for removed definitions.
+type Change struct {
+	Severity Severity
+	Filename string
+	Pos      Pos
+	Message  string
+}
+
+func (c *Change) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", c.Filename, c.Pos.Line, c.Pos.Col, c.Severity, c.Message)
+}
+
+// Compare reports the incompatible changes from the file oldPath to the file
+// newPath, as returned by ParseFile, sorted by position. Files included by
+// both under the same name are compared as well. Types are compared after
+// following typedefs, so replacing a type by an equivalent typedef isn't a
+// change.
+func Compare(oldFiles map[string]*Thrift, oldPath string, newFiles map[string]*Thrift, newPath string) []*Change {
+	c := &comparer{
+		old:      schema{oldFiles, oldPath},
+		new:      schema{newFiles, newPath},
+		compared: make(map[string]bool),
+	}
+	c.compareFiles(oldPath, newPath)
+	sort.Slice(c.changes, func(i, j int) bool {
+		a, b := c.changes[i], c.changes[j]
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Pos.Line != b.Pos.Line {
+			return a.Pos.Line < b.Pos.Line
+		}
+		if a.Pos.Col != b.Pos.Col {
+			return a.Pos.Col < b.Pos.Col
+		}
+		return a.Message < b.Message
+	})
+	return c.changes
+}
+
+// schema is one version of the compared files.
+type schema struct {
+	files map[string]*Thrift
+	root  string
+}
+
+// lookup returns the path of the file defining name, possibly qualified by
+// an include, as seen from the file path, and the name in that file.
+func (s schema) lookup(path, name string) (string, string) {
+	if i := strings.Index(name, "."); i >= 0 {
+		if th := s.files[path]; th != nil {
+			return th.Includes[name[:i]], name[i+1:]
+		}
+	}
+	return path, name
+}
+
+// qualify names a definition the same way in both versions: by its name in
+// the root file, and prefixed with the file's base name elsewhere.
+func (s schema) qualify(path, name string) string {
+	if path == s.root {
+		return name
+	}
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "." + name
+}
+
+// resolve returns the wire type of t in the file path, with enums as i32
+// and all structs alike, and its source type, following typedefs.
+func (s schema) resolve(path string, t *Type) (wire, source string) {
+	if t == nil {
+		return "void", "void"
+	}
+	switch t.Name {
+	case "list", "set":
+		w, src := s.resolve(path, t.ValueType)
+		return t.Name + "<" + w + ">", t.Name + "<" + src + ">"
+	case "map":
+		kw, ksrc := s.resolve(path, t.KeyType)
+		vw, vsrc := s.resolve(path, t.ValueType)
+		return "map<" + kw + "," + vw + ">", "map<" + ksrc + "," + vsrc + ">"
+	case "binary":
+		return "string", t.Name
+	}
+	if builtinTypes[t.Name] {
+		return t.Name, t.Name
+	}
+	path, name := s.lookup(path, t.Name)
+	th := s.files[path]
+	if th == nil {
+		return t.Name, t.Name
+	}
+	if td := th.Typedefs[name]; td != nil {
+		return s.resolve(path, td.Type)
+	}
+	source = s.qualify(path, name)
+	switch {
+	case th.Enums[name] != nil:
+		return "i32", source
+	case th.SEnums[name] != nil:
+		return "string", source
+	case th.Structs[name] != nil, th.Exceptions[name] != nil, th.Unions[name] != nil:
+		return "struct", source
+	}
+	return t.Name, t.Name
+}
+
+type comparer struct {
+	old, new schema
+	compared map[string]bool
+	changes  []*Change
+
+	oldPath, newPath string // files being compared
+}
+
+func (c *comparer) report(sev Severity, filename string, pos Pos, format string, args ...interface{}) {
+	c.changes = append(c.changes, &Change{sev, filename, pos, fmt.Sprintf(format, args...)})
+}
+
+// changed reports a change in the new file.
+func (c *comparer) changed(sev Severity, pos Pos, format string, args ...interface{}) {
+	c.report(sev, c.newPath, pos, format, args...)
+}
+
+// removed reports a definition missing from the new file.
+func (c *comparer) removed(sev Severity, pos Pos, format string, args ...interface{}) {
+	c.report(sev, c.oldPath, pos, format, args...)
+}
+
+func (c *comparer) compareFiles(oldPath, newPath string) {
+	key := oldPath + "\x00" + newPath
+	if c.compared[key] {
+		return
+	}
+	c.compared[key] = true
+	oldTh, newTh := c.old.files[oldPath], c.new.files[newPath]
+	if oldTh == nil || newTh == nil {
+		return
+	}
+	c.oldPath, c.newPath = oldPath, newPath
+
+	for name, td := range oldTh.Typedefs {
+		if newTh.Typedefs[name] == nil {
+			c.removed(SourceBreaking, td.Pos, "typedef %s was removed", name)
+		}
+	}
+	for name, con := range oldTh.Constants {
+		if nc := newTh.Constants[name]; nc == nil {
+			c.removed(SourceBreaking, con.Pos, "constant %s was removed", name)
+		} else {
+			c.compareTypes(SourceBreaking, nc.Pos, "constant "+name, con.Type, nc.Type)
+		}
+	}
+	for name, e := range oldTh.Enums {
+		if ne := newTh.Enums[name]; ne == nil {
+			c.removed(SourceBreaking, e.Pos, "enum %s was removed", name)
+		} else {
+			c.compareEnums(e, ne)
+		}
+	}
+	for name, e := range oldTh.SEnums {
+		if ne := newTh.SEnums[name]; ne == nil {
+			c.removed(SourceBreaking, e.Pos, "senum %s was removed", name)
+		} else {
+			for v := range e.Values {
+				if ne.Values[v] == nil {
+					c.changed(WireBreaking, ne.Pos, "value %s of senum %s was removed", v, name)
+				}
+			}
+		}
+	}
+	oldStructs, newStructs := structKinds(oldTh), structKinds(newTh)
+	for name, st := range oldStructs {
+		ns := newStructs[name]
+		if ns.st == nil {
+			c.removed(SourceBreaking, st.st.Pos, "%s %s was removed", st.kind, name)
+			continue
+		}
+		if ns.kind != st.kind {
+			c.changed(SourceBreaking, ns.st.Pos, "%s %s became a %s", st.kind, name, ns.kind)
+		}
+		c.compareFields(ns.kind+" "+name, ns.st.Pos, st.st.Fields, ns.st.Fields)
+	}
+	for name, svc := range oldTh.Services {
+		if ns := newTh.Services[name]; ns == nil {
+			c.removed(WireBreaking, svc.Pos, "service %s was removed", name)
+		} else {
+			c.compareServices(svc, ns)
+		}
+	}
+
+	for alias, oldInc := range oldTh.Includes {
+		if newInc, ok := newTh.Includes[alias]; ok {
+			c.compareFiles(oldInc, newInc)
+			c.oldPath, c.newPath = oldPath, newPath
+		}
+	}
+}
+
+type structKind struct {
+	kind string
+	st   *Struct
+}
+
+func structKinds(th *Thrift) map[string]structKind {
+	m := make(map[string]structKind, len(th.Structs)+len(th.Exceptions)+len(th.Unions))
+	for name, st := range th.Structs {
+		m[name] = structKind{"struct", st}
+	}
+	for name, st := range th.Exceptions {
+		m[name] = structKind{"exception", st}
+	}
+	for name, st := range th.Unions {
+		m[name] = structKind{"union", st}
+	}
+	return m
+}
+
+func (c *comparer) compareEnums(e, ne *Enum) {
+	byValue := make(map[int]string, len(ne.Values))
+	for _, v := range ne.Values {
+		byValue[v.Value] = v.Name
+	}
+	for name, v := range e.Values {
+		if nv := ne.Values[name]; nv != nil {
+			if nv.Value != v.Value {
+				c.changed(WireBreaking, nv.Pos, "value %s of enum %s changed from %d to %d", name, e.Name, v.Value, nv.Value)
+			}
+		} else if newName, ok := byValue[v.Value]; ok {
+			c.changed(SourceBreaking, ne.Values[newName].Pos, "value %s of enum %s was renamed to %s", name, e.Name, newName)
+		} else {
+			c.changed(WireBreaking, ne.Pos, "value %s of enum %s was removed", name, e.Name)
+		}
+	}
+}
+
+// compareTypes reports a change of the type of what, with sev being the
+// severity of a change of the wire type.
+func (c *comparer) compareTypes(sev Severity, pos Pos, what string, oldType, newType *Type) {
+	oldWire, oldSource := c.old.resolve(c.oldPath, oldType)
+	newWire, newSource := c.new.resolve(c.newPath, newType)
+	switch {
+	case oldWire != newWire:
+		c.changed(sev, pos, "%s changed type from %s to %s", what, oldSource, newSource)
+	case oldSource != newSource:
+		c.changed(SourceBreaking, pos, "%s changed type from %s to %s", what, oldSource, newSource)
+	}
+}
+
+func requiredness(f *Field) string {
+	switch {
+	case f.Required:
+		return "required"
+	case f.Optional:
+		return "optional"
+	}
+	return "default"
+}
+
+// compareFields compares the fields of a struct, or the arguments or
+// exceptions of a method, by ID.
+func (c *comparer) compareFields(owner string, pos Pos, oldFields, newFields []*Field) {
+	newByID := make(map[int]*Field, len(newFields))
+	newByName := make(map[string]*Field, len(newFields))
+	for _, f := range newFields {
+		newByID[f.ID] = f
+		newByName[f.Name] = f
+	}
+	oldIDs := make(map[int]bool, len(oldFields))
+	for _, f := range oldFields {
+		oldIDs[f.ID] = true
+		nf := newByID[f.ID]
+		if nf == nil {
+			if moved := newByName[f.Name]; moved != nil {
+				c.changed(WireBreaking, moved.Pos, "field %s of %s changed ID from %d to %d", f.Name, owner, f.ID, moved.ID)
+			} else if f.Required {
+				c.changed(WireBreaking, pos, "required field %s of %s was removed", f.Name, owner)
+			} else {
+				c.changed(SourceBreaking, pos, "field %s of %s was removed", f.Name, owner)
+			}
+			continue
+		}
+		if nf.Name != f.Name {
+			c.changed(SourceBreaking, nf.Pos, "field %d of %s was renamed from %s to %s", f.ID, owner, f.Name, nf.Name)
+		}
+		if oldReq, newReq := requiredness(f), requiredness(nf); oldReq != newReq {
+			sev := SourceBreaking
+			if f.Required || nf.Required {
+				sev = WireBreaking
+			}
+			c.changed(sev, nf.Pos, "field %s of %s changed from %s to %s", nf.Name, owner, oldReq, newReq)
+		}
+		c.compareTypes(WireBreaking, nf.Pos, "field "+nf.Name+" of "+owner, f.Type, nf.Type)
+	}
+	for _, f := range newFields {
+		if !oldIDs[f.ID] && f.Required {
+			c.changed(WireBreaking, f.Pos, "required field %s was added to %s", f.Name, owner)
+		}
+	}
+}
+
+type methodIn struct {
+	m    *Method
+	path string
+}
+
+// methods returns the methods of svc, including inherited ones, with the
+// paths of the files defining them.
+func (s schema) methods(path string, svc *Service) map[string]methodIn {
+	ms := make(map[string]methodIn)
+	for seen := map[*Service]bool{}; svc != nil && !seen[svc]; {
+		seen[svc] = true
+		for name, m := range svc.Methods {
+			if _, ok := ms[name]; !ok {
+				ms[name] = methodIn{m, path}
+			}
+		}
+		if svc.Extends == "" {
+			break
+		}
+		var name string
+		path, name = s.lookup(path, svc.Extends)
+		svc = nil
+		if th := s.files[path]; th != nil {
+			svc = th.Services[name]
+		}
+	}
+	return ms
+}
+
+func (c *comparer) compareServices(svc, ns *Service) {
+	oldExtends, newExtends := "", ""
+	if svc.Extends != "" {
+		oldExtends = c.old.qualify(c.old.lookup(c.oldPath, svc.Extends))
+	}
+	if ns.Extends != "" {
+		newExtends = c.new.qualify(c.new.lookup(c.newPath, ns.Extends))
+	}
+	if oldExtends != newExtends {
+		c.changed(SourceBreaking, ns.Pos, "service %s changed base service from %q to %q", svc.Name, oldExtends, newExtends)
+	}
+
+	oldMethods, newMethods := c.old.methods(c.oldPath, svc), c.new.methods(c.newPath, ns)
+	for name, om := range oldMethods {
+		nm, ok := newMethods[name]
+		if !ok {
+			c.changed(WireBreaking, ns.Pos, "method %s of service %s was removed", name, svc.Name)
+			continue
+		}
+		c.compareMethods(svc.Name+"."+name, om, nm)
+	}
+}
+
+func (c *comparer) compareMethods(name string, om, nm methodIn) {
+	// Types are resolved in the files defining the methods, which differ
+	// for inherited ones.
+	oldPath, newPath := c.oldPath, c.newPath
+	c.oldPath, c.newPath = om.path, nm.path
+	defer func() { c.oldPath, c.newPath = oldPath, newPath }()
+
+	m, n := om.m, nm.m
+	if m.Oneway != n.Oneway {
+		c.changed(WireBreaking, n.Pos, "method %s changed from oneway=%t to oneway=%t", name, m.Oneway, n.Oneway)
+	}
+	c.compareTypes(WireBreaking, n.Pos, "result of method "+name, m.ReturnType, n.ReturnType)
+	c.compareFields("arguments of method "+name, n.Pos, m.Arguments, n.Arguments)
+	c.compareFields("exceptions of method "+name, n.Pos, m.Exceptions, n.Exceptions)
+}
@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func compare(t *testing.T, oldFiles, newFiles mapFilesystem) []string {
+	parse := func(fs mapFilesystem) (map[string]*Thrift, string) {
+		p := &Parser{Filesystem: fs, Files: map[string]*Thrift{}}
+		files, path, err := p.ParseFile("/a/main.thrift")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files, path
+	}
+	oldTh, oldPath := parse(oldFiles)
+	newTh, newPath := parse(newFiles)
+	var changes []string
+	for _, c := range Compare(oldTh, oldPath, newTh, newPath) {
+		changes = append(changes, c.String())
+	}
+	return changes
+}
+
+func TestCompare(t *testing.T) {
+	changes := compare(t, mapFilesystem{
+		"/a/main.thrift": `
+			include "other.thrift"
+			typedef i64 Timestamp
+			enum Color { RED = 1, GREEN = 2, BLUE = 3 }
+			struct S {
+				1: i32 a,
+				2: string b,
+				3: optional i64 c,
+				4: Timestamp d,
+				5: other.Item e,
+				6: required i32 f,
+				7: list<i32> g,
+			}
+			struct Gone {}
+			service Base {
+				void ping(),
+			}
+			service Svc extends Base {
+				S get(1: i32 id) throws (1: other.Oops oops),
+				oneway void log(1: string msg),
+				void drop(),
+			}
+		`,
+		"/a/other.thrift": `
+			struct Item { 1: i32 id }
+			exception Oops {}
+		`,
+	}, mapFilesystem{
+		"/a/main.thrift": `
+			include "other.thrift"
+			enum Color { RED = 1, VERT = 2 }
+			struct S {
+				1: i32 a,
+				2: binary b,
+				3: required i64 c,
+				4: i64 d,
+				5: other.Item e,
+				8: i32 f,
+				7: list<string> g,
+				9: required i32 h,
+			}
+			service Base {
+			}
+			service Svc {
+				S get(1: i64 id) throws (1: other.Oops oops),
+				void log(1: string msg),
+			}
+		`,
+		"/a/other.thrift": `
+			struct Item { 1: string id }
+			union Oops {}
+		`,
+	})
+	expected := []string{
+		"/a/main.thrift:0:0: source-breaking: field b of struct S changed type from string to binary",
+		"/a/main.thrift:0:0: wire-breaking: field c of struct S changed from optional to required",
+		"/a/main.thrift:0:0: wire-breaking: field f of struct S changed ID from 6 to 8",
+		"/a/main.thrift:0:0: wire-breaking: field g of struct S changed type from list<i32> to list<string>",
+		"/a/main.thrift:0:0: wire-breaking: field id of arguments of method Svc.get changed type from i32 to i64",
+		"/a/main.thrift:0:0: wire-breaking: method Svc.log changed from oneway=true to oneway=false",
+		"/a/main.thrift:0:0: wire-breaking: method drop of service Svc was removed",
+		"/a/main.thrift:0:0: wire-breaking: method ping of service Base was removed",
+		"/a/main.thrift:0:0: wire-breaking: method ping of service Svc was removed",
+		"/a/main.thrift:0:0: wire-breaking: required field h was added to struct S",
+		`/a/main.thrift:0:0: source-breaking: service Svc changed base service from "Base" to ""`,
+		"/a/main.thrift:0:0: source-breaking: struct Gone was removed",
+		"/a/main.thrift:0:0: source-breaking: typedef Timestamp was removed",
+		"/a/main.thrift:0:0: wire-breaking: value BLUE of enum Color was removed",
+		"/a/main.thrift:0:0: source-breaking: value GREEN of enum Color was renamed to VERT",
+		"/a/other.thrift:0:0: source-breaking: exception Oops became a union",
+		"/a/other.thrift:0:0: wire-breaking: field id of struct Item changed type from i32 to string",
+	}
+	if strings.Join(changes, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected changes\n%s\ninstead of\n%s", strings.Join(expected, "\n"), strings.Join(changes, "\n"))
+	}
+}
+
+func TestCompareUnchanged(t *testing.T) {
+	fs := mapFilesystem{
+		"/a/main.thrift": `
+			include "other.thrift"
+			typedef other.Item Thing
+			struct S {
+				1: Thing thing,
+				2: optional list<other.Item> items,
+			}
+			service Svc {
+				Thing get(1: i32 id),
+			}
+		`,
+		"/a/other.thrift": `
+			struct Item { 1: i32 id }
+		`,
+	}
+	// Replacing a typedef by its type, or adding optional fields and
+	// methods, is compatible.
+	changed := mapFilesystem{
+		"/a/main.thrift": `
+			include "other.thrift"
+			typedef other.Item Thing
+			struct S {
+				1: other.Item thing,
+				2: optional list<Thing> items,
+				3: optional i32 extra,
+			}
+			service Svc {
+				other.Item get(1: i32 id),
+				void put(1: Thing thing),
+			}
+		`,
+		"/a/other.thrift": fs["/a/other.thrift"],
+	}
+	if changes := compare(t, fs, changed); len(changes) != 0 {
+		t.Fatalf("Expected no changes instead of\n%s", strings.Join(changes, "\n"))
+	}
+}
@@ -0,0 +1,234 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error is an error in a Thrift file.
+type Error struct {
+	Filename string
+	Pos      Pos
+	Token    string   // offending token of a syntax error, empty at the end of the file
+	Expected []string // what a syntax error expected instead of Token
+	Message  string
+	Excerpt  string // the line at Pos, followed by a caret under Pos.Col
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Filename, e.Pos.Line, e.Pos.Col, e.Message)
+}
+
+// ErrorList is the error returned by Parser.Parse and Parser.ParseFile.
+// After a syntax error parsing resumes at the next line starting with a
+// top-level keyword, so a file may have several errors.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// statementStart matches the lines where parsing can resume.
+var statementStart = regexp.MustCompile(`(?m)^(include|namespace|const|enum|senum|typedef|template|struct|exception|union|service)\b`)
+
+// parseRecovering parses src, resuming after syntax errors until the rest
+// of the file parses. src is modified in the process.
+func parseRecovering(filename string, src []byte, opts ...Option) (interface{}, error) {
+	var errs ErrorList
+	seen := make(map[string]bool)
+	for {
+		v, err := Parse(filename, src, opts...)
+		if err == nil {
+			if len(errs) != 0 {
+				return nil, errs
+			}
+			return v, nil
+		}
+		syntaxErr := -1
+		for _, e := range toErrList(err) {
+			pe, ok := e.(*parserError)
+			if !ok {
+				errs = append(errs, &Error{Filename: filename, Message: e.Error()})
+				continue
+			}
+			if len(pe.expected) != 0 {
+				syntaxErr = pe.pos.offset
+			}
+			if key := pe.Error(); !seen[key] {
+				seen[key] = true
+				errs = append(errs, newError(filename, src, pe))
+			}
+		}
+		if syntaxErr < 0 || !skipStatement(src, syntaxErr) {
+			break
+		}
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := errs[i].Pos, errs[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Col < b.Col
+	})
+	return nil, errs
+}
+
+func toErrList(err error) errList {
+	if l, ok := err.(errList); ok {
+		return l
+	}
+	return errList{err}
+}
+
+// skipStatement blanks the statement containing offset, keeping the line
+// breaks so that the positions of the rest of src don't change. It reports
+// whether there was anything to blank.
+func skipStatement(src []byte, offset int) bool {
+	start, end := 0, len(src)
+	for _, loc := range statementStart.FindAllIndex(src, -1) {
+		if loc[0] < offset {
+			start = loc[0]
+		} else {
+			end = loc[0]
+			break
+		}
+	}
+	changed := false
+	for i := start; i < end; i++ {
+		switch src[i] {
+		case ' ', '\t', '\r', '\n':
+		default:
+			src[i] = ' '
+			changed = true
+		}
+	}
+	return changed
+}
+
+func newError(filename string, src []byte, pe *parserError) *Error {
+	e := &Error{
+		Filename: filename,
+		Pos:      offsetPos(src, pe.pos.offset),
+		Message:  pe.Inner.Error(),
+		Excerpt:  excerpt(src, pe.pos.offset),
+	}
+	if len(pe.expected) != 0 {
+		e.Token = tokenAt(src, pe.pos.offset)
+		e.Expected = describeExpected(pe.expected)
+		e.Message = "syntax error: unexpected " + describeToken(e.Token)
+		if len(e.Expected) != 0 {
+			e.Message += ", expected " + listJoin(e.Expected, ", ", "or")
+		}
+	}
+	return e
+}
+
+// offsetPos returns the position of the character at offset. Unlike the
+// generated parser it puts a line break at the end of its line, rather than
+// at column 0 of the next one.
+func offsetPos(src []byte, offset int) Pos {
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	return Pos{
+		Line: bytes.Count(src[:offset], []byte{'\n'}) + 1,
+		Col:  utf8.RuneCount(src[start:offset]) + 1,
+	}
+}
+
+// excerpt returns the line containing offset with a caret under offset on
+// the next line.
+func excerpt(src []byte, offset int) string {
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	end := len(src)
+	if i := bytes.IndexByte(src[offset:], '\n'); i >= 0 {
+		end = offset + i
+	}
+	line := strings.TrimRight(string(src[start:end]), "\r")
+	caret := make([]byte, 0, offset-start+1)
+	for _, c := range string(src[start:offset]) {
+		if c == '\t' {
+			caret = append(caret, '\t')
+		} else {
+			caret = append(caret, ' ')
+		}
+	}
+	return line + "\n" + string(caret) + "^"
+}
+
+func isTokenChar(c rune) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// tokenAt returns the token starting at offset: an identifier or number, a
+// string literal, or a single character.
+func tokenAt(src []byte, offset int) string {
+	if offset >= len(src) {
+		return ""
+	}
+	rest := src[offset:]
+	c, n := utf8.DecodeRune(rest)
+	switch {
+	case isTokenChar(c):
+		for n < len(rest) && isTokenChar(rune(rest[n])) {
+			n++
+		}
+	case c == '"' || c == '\'':
+		if i := bytes.IndexAny(rest[1:], string(c)+"\n"); i >= 0 && rest[i+1] == byte(c) {
+			n = i + 2
+		}
+	}
+	return string(rest[:n])
+}
+
+func describeToken(token string) string {
+	switch token {
+	case "":
+		return "end of file"
+	case "\n", "\r":
+		return "newline"
+	}
+	return fmt.Sprintf("%q", token)
+}
+
+// expectedNames describes what the generated parser expects, leaving out
+// whitespace and comments which are allowed almost everywhere.
+var expectedNames = map[string][]string{
+	`"#"`:      nil,
+	`"//"`:     nil,
+	`"/*"`:     nil,
+	`"/**"`:    nil,
+	`"\n"`:     nil,
+	`[ \t\r]`:  nil,
+	`[0-9]`:    {"number"},
+	`[-+]`:     {"number"},
+	`[+-]`:     {"number"},
+	`[A-Za-z]`: {"identifier"},
+	`"_"`:      {"identifier"},
+	`"\""`:     {"string literal"},
+	`"'"`:      {"string literal"},
+	`[,;]`:     {`","`, `";"`},
+	"EOF":      {"end of file"},
+}
+
+func describeExpected(expected []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, want := range expected {
+		names, ok := expectedNames[want]
+		if !ok {
+			names = []string{want}
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
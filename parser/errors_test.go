@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	p := &Parser{
+		Filesystem: mapFilesystem{
+			"/a/main.thrift": `struct S {
+  1: i32 a
+  2 string b
+}
+struct T {
+	1: i32 x =
+}
+enum E { A = 1 }
+service Svc {
+  void f(1: i32 a
+}
+`,
+		},
+		Files: map[string]*Thrift{},
+	}
+	_, _, err := p.ParseFile("/a/main.thrift")
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Expected an ErrorList instead of %#v", err)
+	}
+	expected := []string{
+		`/a/main.thrift:3:5: syntax error: unexpected "string", expected ":"`,
+		`/a/main.thrift:6:12: syntax error: unexpected newline, expected ".", "[", "{", identifier, number or string literal`,
+		`/a/main.thrift:11:1: syntax error: unexpected "}", expected "(", ")", ",", ";", "=" or number`,
+	}
+	if s := errs.Error(); s != strings.Join(expected, "\n") {
+		t.Fatalf("Expected errors\n%s\ninstead of\n%s", strings.Join(expected, "\n"), s)
+	}
+
+	e := errs[0]
+	if e.Filename != "/a/main.thrift" || e.Pos != (Pos{3, 5}) || e.Token != "string" {
+		t.Fatalf("Unexpected error %+v", e)
+	}
+	if len(e.Expected) != 1 || e.Expected[0] != `":"` {
+		t.Fatalf("Expected \":\" to be expected instead of %q", e.Expected)
+	}
+	if excerpt := "  2 string b\n    ^"; e.Excerpt != excerpt {
+		t.Fatalf("Expected the excerpt\n%s\ninstead of\n%s", excerpt, e.Excerpt)
+	}
+	if excerpt := "\t1: i32 x =\n\t          ^"; errs[1].Excerpt != excerpt {
+		t.Fatalf("Expected the excerpt\n%s\ninstead of\n%s", excerpt, errs[1].Excerpt)
+	}
+}
+
+func TestParseErrorAtEOF(t *testing.T) {
+	_, err := (&Parser{}).Parse(strings.NewReader("struct S {\n  1: i32 a,\n"))
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Expected a single error instead of %v", err)
+	}
+	if e := errs[0]; e.Pos != (Pos{3, 1}) || e.Token != "" || !strings.Contains(e.Message, "unexpected end of file") {
+		t.Fatalf("Unexpected error %+v", e)
+	}
+}
@@ -0,0 +1,450 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Formatter prints Thrift files in a canonical layout: two spaces of
+// indentation, field IDs and trailing comments aligned within a block,
+// every field, enum value and method followed by a comma and enum values
+// always numbered.
+type Formatter struct {
+	SortIncludes bool // sort each group of consecutive includes by path
+}
+
+// Format prints th, as returned by the parser, with the comments it kept.
+// Rendering templates doesn't add instances to what is printed.
+func (f *Formatter) Format(th *Thrift) []byte {
+	p := &printer{}
+	defs := th.Definitions
+	if f.SortIncludes {
+		defs = sortIncludes(defs)
+	}
+	var ls []*line
+	var seps []bool
+	for i, def := range defs {
+		l := p.definition(def)
+		ls = append(ls, l)
+		seps = append(seps, i > 0 && (def.Kind != defs[i-1].Kind || !singleLineKinds[def.Kind] || len(l.before) != 0))
+	}
+	p.lines("", ls, seps)
+	if th.Comments != nil && len(th.Comments.End) != 0 {
+		if len(ls) != 0 {
+			p.buf.WriteByte('\n')
+		}
+		p.comments("", trimBlank(th.Comments.End))
+	}
+	return p.buf.Bytes()
+}
+
+// Source formats src, the contents of filename. Syntax errors are returned
+// as an ErrorList. Comments are only kept where the parser records them, so
+// rather than dropping one elsewhere, Source fails.
+func (f *Formatter) Source(filename string, src []byte) ([]byte, error) {
+	th, err := (&Parser{}).parse(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	out := f.Format(th)
+	if lost := countComments(src) - countComments(out); lost > 0 {
+		return nil, fmt.Errorf("%s: can't format without losing %d comment(s), move them before or after a definition", filename, lost)
+	}
+	return out, nil
+}
+
+// singleLineKinds are the definitions printed on a line, which don't get
+// separated by blank lines when several of a kind follow each other.
+var singleLineKinds = map[string]bool{
+	"include":   true,
+	"namespace": true,
+	"const":     true,
+	"typedef":   true,
+}
+
+func sortIncludes(defs []*Definition) []*Definition {
+	defs = append([]*Definition(nil), defs...)
+	for i := 0; i < len(defs); i++ {
+		j := i
+		for j < len(defs) && defs[j].Kind == "include" {
+			j++
+		}
+		group := defs[i:j]
+		sort.SliceStable(group, func(a, b int) bool {
+			return group[a].Value.(*Include).Path < group[b].Value.(*Include).Path
+		})
+		i = j
+	}
+	return defs
+}
+
+// line is a definition or a member of a block as printed, with its
+// comments. Only the last line of text may be followed by a comment.
+type line struct {
+	before []string
+	text   string
+	after  string
+}
+
+func newLine(cs *Comments, text string) *line {
+	l := &line{text: text}
+	if cs != nil {
+		l.before, l.after = cs.Before, cs.After
+	}
+	return l
+}
+
+type printer struct {
+	buf bytes.Buffer
+}
+
+// lines prints ls at indent, with a blank line before those whose seps is
+// true. Trailing comments are aligned within runs of lines that aren't
+// separated by blank lines or comments.
+func (p *printer) lines(indent string, ls []*line, seps []bool) {
+	widths := make([]int, len(ls))
+	for start := 0; start < len(ls); {
+		end := start + 1
+		for end < len(ls) && !seps[end] && len(ls[end].before) == 0 && !strings.Contains(ls[end-1].text, "\n") {
+			end++
+		}
+		width := 0
+		for _, l := range ls[start:end] {
+			if n := len(lastLine(l.text)); l.after != "" && n > width {
+				width = n
+			}
+		}
+		for i := start; i < end; i++ {
+			widths[i] = width
+		}
+		start = end
+	}
+	for i, l := range ls {
+		if seps[i] {
+			p.buf.WriteByte('\n')
+		}
+		p.comments(indent, l.before)
+		text := indentText(indent, l.text)
+		p.buf.WriteString(text)
+		if l.after != "" {
+			p.buf.WriteString(strings.Repeat(" ", widths[i]-len(lastLine(l.text))+1))
+			p.buf.WriteString(l.after)
+		}
+		p.buf.WriteByte('\n')
+	}
+}
+
+// comments prints each of cs on its own lines at indent, "" being a blank
+// line.
+func (p *printer) comments(indent string, cs []string) {
+	for _, c := range cs {
+		if c == "" {
+			p.buf.WriteByte('\n')
+			continue
+		}
+		p.buf.WriteString(indent)
+		p.buf.WriteString(reindentComment(indent, c))
+		p.buf.WriteByte('\n')
+	}
+}
+
+// reindentComment moves the lines after the first of a /* */ comment to
+// indent. Lines starting with "*" are lined up under the first one, others
+// keep their indentation relative to each other.
+func reindentComment(indent, c string) string {
+	ls := strings.Split(c, "\n")
+	common := -1
+	for _, l := range ls[1:] {
+		trimmed := strings.TrimLeft(l, " \t")
+		if trimmed == "" || trimmed[0] == '*' {
+			continue
+		}
+		if n := len(l) - len(trimmed); common < 0 || n < common {
+			common = n
+		}
+	}
+	for i, l := range ls {
+		l = strings.TrimRight(l, " \t")
+		trimmed := strings.TrimLeft(l, " \t")
+		switch {
+		case i == 0 || l == "":
+		case trimmed[0] == '*':
+			l = indent + " " + trimmed
+		default:
+			l = indent + "   " + l[common:]
+		}
+		ls[i] = l
+	}
+	return strings.Join(ls, "\n")
+}
+
+func (p *printer) definition(def *Definition) *line {
+	switch v := def.Value.(type) {
+	case *Include:
+		return newLine(v.Comments, "include "+strconv.Quote(v.Path))
+	case *Namespace:
+		return newLine(v.Comments, "namespace "+v.Scope+" "+v.Name)
+	case *Constant:
+		value := "{}" // the parser returns nil for empty maps
+		if v.Value != nil {
+			value = valueString(v.Value)
+		}
+		return newLine(v.Comments, "const "+typeString(v.Type)+" "+v.Name+" = "+value)
+	case *Typedef:
+		return newLine(v.Comments, "typedef "+typeString(v.Type)+" "+v.Alias+annotationsSuffix(v.Annotations))
+	case *Enum:
+		ls := make([]*line, len(v.ValueList))
+		for i, ev := range v.ValueList {
+			ls[i] = newLine(ev.Comments, fmt.Sprintf("%s = %d%s,", ev.Name, ev.Value, annotationsSuffix(ev.Annotations)))
+		}
+		return p.block(v.Comments, "enum "+v.Name, ls, v.Annotations)
+	case *SEnum:
+		ls := make([]*line, len(v.ValueList))
+		for i, ev := range v.ValueList {
+			ls[i] = newLine(ev.Comments, ev.Value+annotationsSuffix(ev.Annotations)+",")
+		}
+		return p.block(v.Comments, "senum "+v.Name, ls, v.Annotations)
+	case *Struct:
+		return p.block(v.Comments, def.Kind+" "+v.Name, fieldLines(v.Fields, def.Kind != "union"), v.Annotations)
+	case *TemplateDef:
+		header := "template " + v.Name + "<" + strings.Join(v.TypeArgNames, ", ") + ">"
+		return p.block(v.Comments, header, fieldLines(v.Fields, true), v.Annotations)
+	case *Service:
+		header := "service " + v.Name
+		if v.Extends != "" {
+			header += " extends " + v.Extends
+		}
+		ls := make([]*line, len(v.MethodList))
+		for i, m := range v.MethodList {
+			ls[i] = newLine(m.Comments, methodText(m))
+		}
+		return p.block(v.Comments, header, ls, v.Annotations)
+	}
+	panic(fmt.Sprintf("parser: unknown definition %#v", def.Value))
+}
+
+// block returns a definition made of header followed by members in braces.
+func (p *printer) block(cs *Comments, header string, members []*line, annotations []*Annotation) *line {
+	var end []string
+	if cs != nil {
+		end = trimBlank(cs.End)
+	}
+	l := &line{}
+	if cs != nil {
+		l.before = cs.Before
+	}
+	if len(members) == 0 && len(end) == 0 {
+		l.text = header + " {}" + annotationsSuffix(annotations)
+		return l
+	}
+	sub := &printer{}
+	sub.lines("  ", members, make([]bool, len(members)))
+	sub.comments("  ", end)
+	l.text = header + " {\n" + sub.buf.String() + "}" + annotationsSuffix(annotations)
+	return l
+}
+
+// fieldLines returns the lines of fields, with their IDs aligned.
+func fieldLines(fields []*Field, explicit bool) []*line {
+	width := 0
+	for _, f := range fields {
+		if n := len(strconv.Itoa(f.ID)); n > width {
+			width = n
+		}
+	}
+	ls := make([]*line, len(fields))
+	for i, f := range fields {
+		ls[i] = newLine(f.Comments, fmt.Sprintf("%*d: %s,", width, f.ID, fieldText(f, explicit)))
+	}
+	return ls
+}
+
+// fieldText returns f without its ID. Fields of unions and exceptions
+// thrown by methods are optional without saying so, so optional is only
+// printed if explicit is true.
+func fieldText(f *Field, explicit bool) string {
+	s := ""
+	switch {
+	case f.Required:
+		s = "required "
+	case f.Optional && explicit:
+		s = "optional "
+	}
+	s += typeString(f.Type) + " " + f.Name
+	if f.Default != nil {
+		s += " = " + valueString(f.Default)
+	}
+	return s + annotationsSuffix(f.Annotations)
+}
+
+func methodText(m *Method) string {
+	s := ""
+	if m.Oneway {
+		s = "oneway "
+	}
+	if m.ReturnType == nil {
+		s += "void"
+	} else {
+		s += typeString(m.ReturnType)
+	}
+	s += " " + m.Name + "(" + argumentsText(m.Arguments, true) + ")"
+	if len(m.Exceptions) != 0 {
+		s += " throws (" + argumentsText(m.Exceptions, false) + ")"
+	}
+	return s + annotationsSuffix(m.Annotations) + ","
+}
+
+// argumentsText returns the arguments or exceptions of a method on a line,
+// or a line each if some have comments.
+func argumentsText(fields []*Field, explicit bool) string {
+	multiline := false
+	for _, f := range fields {
+		multiline = multiline || f.Comments != nil
+	}
+	if !multiline {
+		args := make([]string, len(fields))
+		for i, f := range fields {
+			args[i] = strconv.Itoa(f.ID) + ": " + fieldText(f, explicit)
+		}
+		return strings.Join(args, ", ")
+	}
+	ls := fieldLines(fields, explicit)
+	sub := &printer{}
+	sub.lines("  ", ls, make([]bool, len(ls)))
+	return "\n" + sub.buf.String()
+}
+
+func typeString(t *Type) string {
+	var s string
+	switch {
+	case t.TemplateInstance != nil:
+		args := make([]string, len(t.TemplateInstance.TypeArgs))
+		for i, arg := range t.TemplateInstance.TypeArgs {
+			args[i] = typeString(arg)
+		}
+		s = t.TemplateInstance.TemplateName + "<" + strings.Join(args, ", ") + ">"
+	case t.Name == "map":
+		s = "map<" + typeString(t.KeyType) + ", " + typeString(t.ValueType) + ">"
+	case t.Name == "list" || t.Name == "set":
+		s = t.Name + "<" + typeString(t.ValueType) + ">"
+	default:
+		s = t.Name
+	}
+	return s + annotationsSuffix(t.Annotations)
+}
+
+func annotationsSuffix(annotations []*Annotation) string {
+	if len(annotations) == 0 {
+		return ""
+	}
+	as := make([]string, len(annotations))
+	for i, a := range annotations {
+		as[i] = a.Name
+		if a.Value != "" {
+			as[i] += " = " + strconv.Quote(a.Value)
+		}
+	}
+	return " (" + strings.Join(as, ", ") + ")"
+}
+
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return doubleString(v)
+	case Identifier:
+		return string(v)
+	case []interface{}:
+		vs := make([]string, len(v))
+		for i, e := range v {
+			vs[i] = valueString(e)
+		}
+		return "[" + strings.Join(vs, ", ") + "]"
+	case []KeyValue:
+		kvs := make([]string, len(v))
+		for i, kv := range v {
+			kvs[i] = valueString(kv.Key) + ": " + valueString(kv.Value)
+		}
+		return "{" + strings.Join(kvs, ", ") + "}"
+	}
+	panic(fmt.Sprintf("parser: unknown value %#v", v))
+}
+
+// doubleString returns v with a decimal point, which the grammar requires
+// to tell doubles from integers.
+func doubleString(v float64) string {
+	format := byte('f')
+	if a := math.Abs(v); a != 0 && (a < 1e-4 || a >= 1e21) {
+		format = 'e'
+	}
+	s := strconv.FormatFloat(v, format, -1, 64)
+	if !strings.Contains(s, ".") {
+		if i := strings.IndexByte(s, 'e'); i >= 0 {
+			s = s[:i] + ".0" + s[i:]
+		} else {
+			s += ".0"
+		}
+	}
+	return s
+}
+
+func indentText(indent, text string) string {
+	if indent == "" {
+		return text
+	}
+	ls := strings.Split(text, "\n")
+	for i, l := range ls {
+		if l != "" {
+			ls[i] = indent + l
+		}
+	}
+	return strings.Join(ls, "\n")
+}
+
+func lastLine(text string) string {
+	return text[strings.LastIndex(text, "\n")+1:]
+}
+
+// trimBlank returns cs without the blank lines at its end.
+func trimBlank(cs []string) []string {
+	for len(cs) > 0 && cs[len(cs)-1] == "" {
+		cs = cs[:len(cs)-1]
+	}
+	return cs
+}
+
+// countComments returns the number of comments in Thrift source.
+func countComments(src []byte) int {
+	n := 0
+	for i := 0; i < len(src); i++ {
+		switch {
+		case src[i] == '"' || src[i] == '\'':
+			quote := src[i]
+			for i++; i < len(src) && src[i] != quote; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+		case src[i] == '#' || bytes.HasPrefix(src[i:], []byte("//")):
+			n++
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case bytes.HasPrefix(src[i:], []byte("/*")):
+			n++
+			if end := bytes.Index(src[i+2:], []byte("*/")); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(src)
+			}
+		}
+	}
+	return n
+}
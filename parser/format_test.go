@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	src := `// Header
+
+namespace go somepkg
+include "z.thrift"
+include "a.thrift" // for A
+
+/* Some
+       constants */
+const map<string,string> M = {"hello": "world"};
+const double D = 1.0e30;
+const list<i64> L = [1, 2, 3]
+typedef i64 (js.type = 'Long') Long (a="b")
+union U
+{
+	1: double dbl = 1.1; // a double
+	10: string str (x)
+}
+enum E {
+	A = 1,
+	// B comes next
+	B
+	// end of E
+}
+senum SE { X, Y }
+service Svc extends Base
+{
+	# login
+	string login(1:string password) throws (1:AuthError err),
+	oneway void ping(); // fire and forget
+
+	void put(1: i32 a,
+	  /** the value */
+	  2: optional i32 b)
+}
+struct Empty {}
+template Pair<K,V> { 1: K key, 2: required V value }
+// the end
+`
+	expected := `// Header
+
+namespace go somepkg
+
+include "a.thrift" // for A
+include "z.thrift"
+
+/* Some
+   constants */
+const map<string, string> M = {"hello": "world"}
+const double D = 1.0e+30
+const list<i64> L = [1, 2, 3]
+
+typedef i64 (js.type = "Long") Long (a = "b")
+
+union U {
+   1: double dbl = 1.1, // a double
+  10: string str (x),
+}
+
+enum E {
+  A = 1,
+  // B comes next
+  B = 2,
+  // end of E
+}
+
+senum SE {
+  X,
+  Y,
+}
+
+service Svc extends Base {
+  # login
+  string login(1: string password) throws (1: AuthError err),
+  oneway void ping(), // fire and forget
+
+  void put(
+    1: i32 a,
+    /** the value */
+    2: optional i32 b,
+  ),
+}
+
+struct Empty {}
+
+template Pair<K, V> {
+  1: K key,
+  2: required V value,
+}
+
+// the end
+`
+	out, err := (&Formatter{SortIncludes: true}).Source("x.thrift", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Fatalf("Expected\n%s\ninstead of\n%s", expected, out)
+	}
+}
+
+// withoutComments returns the JSON form of th without comments.
+func withoutComments(t *testing.T, th *Thrift) interface{} {
+	b, err := json.Marshal(th)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	var strip func(v interface{})
+	strip = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			delete(v, "Comment")
+			delete(v, "Comments")
+			for _, e := range v {
+				strip(e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				strip(e)
+			}
+		}
+	}
+	strip(v)
+	return v
+}
+
+func TestFormatTestfiles(t *testing.T) {
+	files, err := filepath.Glob("../testfiles/*.thrift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator, err := filepath.Glob("../testfiles/generator/*.thrift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &Formatter{}
+	for _, filename := range append(files, generator...) {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := f.Source(filename, src)
+		if err != nil {
+			t.Errorf("Formatting %s failed: %s", filename, err)
+			continue
+		}
+		if again, err := f.Source(filename, out); err != nil || string(again) != string(out) {
+			t.Errorf("Formatting %s again changed it (%v)", filename, err)
+		}
+		before, _ := parse(string(src))
+		after, err := parse(string(out))
+		if err != nil {
+			t.Errorf("Formatted %s doesn't parse: %s", filename, err)
+		} else if !reflect.DeepEqual(withoutComments(t, before), withoutComments(t, after)) {
+			t.Errorf("Formatting %s changed its definitions", filename)
+		}
+	}
+}
+
+func TestFormatLosingComments(t *testing.T) {
+	_, err := (&Formatter{}).Source("x.thrift", []byte("service S // c\n{\n}\n"))
+	if err == nil || err.Error() != "x.thrift: can't format without losing 1 comment(s), move them before or after a definition" {
+		t.Fatalf("Expected an error about the lost comment instead of %v", err)
+	}
+}
@@ -40,7 +40,13 @@ func (p *Parser) Parse(r io.Reader, opts ...Option) (*Thrift, error) {
 	if named, ok := r.(namedReader); ok {
 		name = named.Name()
 	}
-	i, err := Parse(name, b, opts...)
+	return p.parse(name, b, opts...)
+}
+
+// parse parses the contents of the file name. Errors are returned as an
+// ErrorList.
+func (p *Parser) parse(name string, b []byte, opts ...Option) (*Thrift, error) {
+	i, err := parseRecovering(name, b, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -70,11 +76,15 @@ func (p *Parser) ParseFile(filename string, opts ...Option) (map[string]*Thrift,
 		if err != nil {
 			return nil, "", err
 		}
-		thrift, err := p.Parse(rd, opts...)
+		b, err := ioutil.ReadAll(rd)
 		rd.Close()
 		if err != nil {
 			return nil, "", err
 		}
+		thrift, err := p.parse(path, b, opts...)
+		if err != nil {
+			return nil, "", err
+		}
 		p.Files[path] = thrift
 
 		basePath := filepath.Dir(path)
@@ -30,8 +30,9 @@ struct SomeStruct {
 	}
 
 	expectedStruct := &Struct{
-		Name:    "SomeStruct",
-		Comment: "Some comment",
+		Name:     "SomeStruct",
+		Comment:  "Some comment",
+		Comments: &Comments{Before: []string{"// Some comment"}},
 		Fields: []*Field{
 			{
 				ID:      1,
@@ -158,8 +159,9 @@ func TestServiceParsing(t *testing.T) {
 	}
 
 	expectedStruct := &Struct{
-		Name:    "SomeStruct",
-		Comment: "Some comment",
+		Name:     "SomeStruct",
+		Comment:  "Some comment",
+		Comments: &Comments{Before: []string{"// Some comment"}},
 		Fields: []*Field{
 			{
 				ID:      1,
@@ -232,18 +234,21 @@ func TestServiceParsing(t *testing.T) {
 		t.Errorf("Expected\n%s\ngot\n%s", pprint(expectedUnion), pprint(u))
 	}
 
+	add := &EnumValue{
+		Name:  "ADD",
+		Value: 1,
+	}
+	subtract := &EnumValue{
+		Name:  "SUBTRACT",
+		Value: 2,
+	}
 	expectedEnum := &Enum{
 		Name: "Operation",
 		Values: map[string]*EnumValue{
-			"ADD": &EnumValue{
-				Name:  "ADD",
-				Value: 1,
-			},
-			"SUBTRACT": &EnumValue{
-				Name:  "SUBTRACT",
-				Value: 2,
-			},
+			"ADD":      add,
+			"SUBTRACT": subtract,
 		},
+		ValueList: []*EnumValue{add, subtract},
 	}
 	if e := thrift.Enums["Operation"]; e == nil {
 		t.Errorf("enum Operation missing")
@@ -269,6 +274,11 @@ func TestServiceParsing(t *testing.T) {
 				"login": &Method{
 					Name:    "login",
 					Comment: "authenticate method comment2 some other\t\t\t   comments",
+					Comments: &Comments{Before: []string{
+						"# authenticate method",
+						"// comment2",
+						"/* some other\n\t\t\t   comments */",
+					}},
 					ReturnType: &Type{
 						Name: "string",
 					},
@@ -384,23 +394,27 @@ func TestParseSEnumAnnotations(t *testing.T) {
 		t.Fatalf("Parse senum annotations failed: %v", err)
 	}
 
+	one := &SEnumValue{
+		Value:       "ONE",
+		Annotations: []*Annotation{{Name: "a1", Value: "v1"}},
+	}
+	two := &SEnumValue{
+		Value:       "TWO",
+		Annotations: []*Annotation{{Name: "a2", Value: "v2"}},
+	}
+	three := &SEnumValue{
+		Value:       "THREE",
+		Annotations: []*Annotation{{Name: "a3", Value: "v3"}},
+	}
 	expected := map[string]*SEnum{
 		"E": &SEnum{
 			Name: "E",
 			Values: map[string]*SEnumValue{
-				"ONE": &SEnumValue{
-					Value:       "ONE",
-					Annotations: []*Annotation{{Name: "a1", Value: "v1"}},
-				},
-				"TWO": &SEnumValue{
-					Value:       "TWO",
-					Annotations: []*Annotation{{Name: "a2", Value: "v2"}},
-				},
-				"THREE": &SEnumValue{
-					Value:       "THREE",
-					Annotations: []*Annotation{{Name: "a3", Value: "v3"}},
-				},
+				"ONE":   one,
+				"TWO":   two,
+				"THREE": three,
 			},
+			ValueList:   []*SEnumValue{one, two, three},
 			Annotations: []*Annotation{{Name: "a4", Value: "v4"}},
 		},
 	}
@@ -494,6 +508,11 @@ func TestParseStructLikeAnnotations(t *testing.T) {
 			Annotations: []*Annotation{{Name: "a3", Value: "v3"}},
 		},
 	}
+	expected.Definitions = []*Definition{
+		{Kind: "struct", Value: expected.Structs["S"]},
+		{Kind: "union", Value: expected.Unions["U"]},
+		{Kind: "exception", Value: expected.Exceptions["E"]},
+	}
 	if !reflect.DeepEqual(expected, thrift) {
 		t.Errorf("Unexpected annotation parsing got\n%s\n instead of\n%v", pprint(thrift), pprint(expected))
 	}
@@ -509,22 +528,24 @@ func TestParseServiceAnnotations(t *testing.T) {
 		t.Fatalf("Parse service annotations failed: %v", err)
 	}
 
+	foo := &Method{
+		Name: "foo",
+		Arguments: []*Field{
+			&Field{
+				ID:   1,
+				Name: "f1",
+				Type: &Type{Name: "i32"},
+			},
+		},
+		Annotations: []*Annotation{{Name: "a1", Value: "v1"}},
+	}
 	expected := map[string]*Service{
 		"S": &Service{
 			Name: "S",
 			Methods: map[string]*Method{
-				"foo": &Method{
-					Name: "foo",
-					Arguments: []*Field{
-						&Field{
-							ID:   1,
-							Name: "f1",
-							Type: &Type{Name: "i32"},
-						},
-					},
-					Annotations: []*Annotation{{Name: "a1", Value: "v1"}},
-				},
+				"foo": foo,
 			},
+			MethodList:  []*Method{foo},
 			Annotations: []*Annotation{{Name: "a2", Value: "v2"}},
 		},
 	}
@@ -2,142 +2,350 @@ package parser
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 )
 
+var builtinTypes = map[string]bool{
+	"bool":   true,
+	"byte":   true,
+	"i16":    true,
+	"i32":    true,
+	"i64":    true,
+	"double": true,
+	"string": true,
+	"binary": true,
+	"list":   true,
+	"set":    true,
+	"map":    true,
+	"void":   true,
+}
+
+// tmplArgName returns the part of an instance name standing for a type
+// argument. Container and template arguments spell out their own arguments
+// so that different instances get different names.
+func tmplArgName(t *Type) string {
+	if ti := t.TemplateInstance; ti != nil {
+		names := []string{strings.Replace(ti.TemplateName, ".", "_", -1)}
+		for _, a := range ti.TypeArgs {
+			names = append(names, tmplArgName(a))
+		}
+		return strings.Join(names, "_")
+	}
+	switch t.Name {
+	case "list", "set":
+		return t.Name + "_" + tmplArgName(t.ValueType)
+	case "map":
+		return "map_" + tmplArgName(t.KeyType) + "_" + tmplArgName(t.ValueType)
+	}
+	return strings.Replace(t.Name, ".", "_", -1)
+}
+
+// tmplInstanceName returns the name of the struct rendered for a template
+// instance, e.g. Pair__i32__string for Pair<i32, string>. The name of a
+// template from an included file keeps its qualifier, other_Pair__i32__string
+// for other.Pair<i32, string>, as the struct is rendered into the file that
+// uses it.
 func tmplInstanceName(ti *TemplateInstance) string {
-	name := ti.TemplateName + "__"
+	name := strings.Replace(ti.TemplateName, ".", "_", -1) + "__"
 	for i, a := range ti.TypeArgs {
 		if i > 0 {
 			name += "__"
 		}
-		name += a.Name
+		name += tmplArgName(a)
 	}
 	return name
 }
 
-func tmplResolveArgs(typeArgNames []string, typeArgs []*Type, fields []*Field) ([]*Field, error) {
-	tas := make(map[string]*Type)
-	if len(typeArgs) != len(typeArgNames) {
-		return nil, fmt.Errorf("Template args mismatch. Expected %d args, got %d", len(typeArgNames), len(typeArgs))
+// copyType returns a deep copy of t.
+func copyType(t *Type) *Type {
+	if t == nil {
+		return nil
 	}
-	for i, n := range typeArgNames {
-		tas[n] = typeArgs[i]
+	c := *t
+	c.KeyType = copyType(t.KeyType)
+	c.ValueType = copyType(t.ValueType)
+	if ti := t.TemplateInstance; ti != nil {
+		args := make([]*Type, len(ti.TypeArgs))
+		for i, a := range ti.TypeArgs {
+			args[i] = copyType(a)
+		}
+		c.TemplateInstance = &TemplateInstance{TemplateName: ti.TemplateName, TypeArgs: args}
 	}
+	return &c
+}
+
+// maxTemplateDepth bounds the chain of instances rendered for the
+// instances used by templates, in case a recursive template grows its
+// arguments in a way instanceGrows misses.
+const maxTemplateDepth = 64
 
-	var resolveType func(*Type) *Type
-	resolveType = func(t *Type) *Type {
-		if t == nil {
-			return t
+// tmplRenderer renders template instances into the files that use them.
+type tmplRenderer struct {
+	files map[string]*Thrift
+	paths map[*Thrift]string
+	seen  map[*Thrift]map[string]bool
+	left  []tmplPending
+	chain []*TemplateInstance // instances being rendered, outermost first
+}
+
+type tmplPending struct {
+	ti    *TemplateInstance
+	in    *Thrift             // file using the instance
+	chain []*TemplateInstance // instances whose rendering led to this one
+}
+
+func (r *tmplRenderer) collectType(t *Type, in *Thrift) {
+	if t == nil {
+		return
+	}
+	if ti := t.TemplateInstance; ti != nil {
+		name := tmplInstanceName(ti)
+		if !r.seen[in][name] {
+			r.seen[in][name] = true
+			r.left = append(r.left, tmplPending{ti, in, r.chain})
 		}
-		if tt, ok := tas[t.Name]; ok {
-			return tt
+		for _, a := range ti.TypeArgs {
+			r.collectType(a, in)
 		}
-		t.KeyType = resolveType(t.KeyType)
-		t.ValueType = resolveType(t.ValueType)
-		return t
 	}
+	r.collectType(t.KeyType, in)
+	r.collectType(t.ValueType, in)
+}
 
-	result := []*Field{}
+func (r *tmplRenderer) collectFields(fields []*Field, in *Thrift) {
 	for _, f := range fields {
-		ff := &Field{
+		r.collectType(f.Type, in)
+	}
+}
+
+// templateDef finds the template named name, which may be qualified with an
+// include, as seen from the file in.
+func (r *tmplRenderer) templateDef(name string, in *Thrift) (*TemplateDef, *Thrift, error) {
+	th := in
+	if i := strings.Index(name, "."); i >= 0 {
+		th = r.files[in.Includes[name[:i]]]
+		if th == nil {
+			return nil, nil, fmt.Errorf("Undefined include %s", name[:i])
+		}
+		name = name[i+1:]
+	}
+	if td := th.TemplateDefs[name]; td != nil {
+		return td, th, nil
+	}
+	return nil, nil, fmt.Errorf("Undefined template %s", name)
+}
+
+// qualify returns the name of the type called name in the file from, as
+// seen from the file to.
+func (r *tmplRenderer) qualify(name string, from, to *Thrift) (string, error) {
+	if from == to {
+		return name, nil
+	}
+	path := r.paths[from]
+	if i := strings.Index(name, "."); i >= 0 {
+		path = from.Includes[name[:i]]
+		name = name[i+1:]
+	}
+	if path == r.paths[to] {
+		return name, nil
+	}
+	aliases := make([]string, 0, len(to.Includes))
+	for alias := range to.Includes {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		if to.Includes[alias] == path {
+			return alias + "." + name, nil
+		}
+	}
+	return "", fmt.Errorf("Type %s isn't included by %s", name, to.Filename)
+}
+
+// resolveType returns a copy of the type t of a template defined in from,
+// with the template arguments replaced by args and the other types
+// qualified as seen from to.
+func (r *tmplRenderer) resolveType(t *Type, args map[string]*Type, from, to *Thrift) (*Type, error) {
+	if t == nil {
+		return nil, nil
+	}
+	if a, ok := args[t.Name]; ok && t.TemplateInstance == nil {
+		return copyType(a), nil
+	}
+	c := *t
+	var err error
+	if c.KeyType, err = r.resolveType(t.KeyType, args, from, to); err != nil {
+		return nil, err
+	}
+	if c.ValueType, err = r.resolveType(t.ValueType, args, from, to); err != nil {
+		return nil, err
+	}
+	if ti := t.TemplateInstance; ti != nil {
+		nti := &TemplateInstance{TypeArgs: make([]*Type, len(ti.TypeArgs))}
+		if nti.TemplateName, err = r.qualify(ti.TemplateName, from, to); err != nil {
+			return nil, err
+		}
+		for i, a := range ti.TypeArgs {
+			if nti.TypeArgs[i], err = r.resolveType(a, args, from, to); err != nil {
+				return nil, err
+			}
+		}
+		c.TemplateInstance = nti
+		c.Name = tmplInstanceName(nti)
+	} else if !builtinTypes[c.Name] {
+		if c.Name, err = r.qualify(c.Name, from, to); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// typeContains reports whether inner is outer or one of the types it's
+// made of.
+func typeContains(outer, inner *Type) bool {
+	if outer == nil {
+		return false
+	}
+	if tmplArgName(outer) == tmplArgName(inner) {
+		return true
+	}
+	if ti := outer.TemplateInstance; ti != nil {
+		for _, a := range ti.TypeArgs {
+			if typeContains(a, inner) {
+				return true
+			}
+		}
+	}
+	return typeContains(outer.KeyType, inner) || typeContains(outer.ValueType, inner)
+}
+
+// instanceGrows reports whether ti is a different instance of the same
+// template as prev whose arguments contain those of prev, as when
+// R<T> uses R<list<T>>. Rendering it would lead to ever larger instances.
+func instanceGrows(ti, prev *TemplateInstance) bool {
+	if ti.TemplateName != prev.TemplateName || len(ti.TypeArgs) != len(prev.TypeArgs) ||
+		tmplInstanceName(ti) == tmplInstanceName(prev) {
+		return false
+	}
+	for i, a := range ti.TypeArgs {
+		if !typeContains(a, prev.TypeArgs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRecursion fails if rendering the instance would never end.
+func checkRecursion(pending tmplPending) error {
+	if len(pending.chain) >= maxTemplateDepth {
+		return fmt.Errorf("Instance %s nested too deeply in other instances", tmplInstanceName(pending.ti))
+	}
+	for _, prev := range pending.chain {
+		if instanceGrows(pending.ti, prev) {
+			return fmt.Errorf("Instance %s uses the larger instance %s of itself", tmplInstanceName(prev), tmplInstanceName(pending.ti))
+		}
+	}
+	return nil
+}
+
+// render adds the struct for a template instance to the file using it.
+func (r *tmplRenderer) render(ti *TemplateInstance, in *Thrift) error {
+	tDef, from, err := r.templateDef(ti.TemplateName, in)
+	if err != nil {
+		return err
+	}
+	if len(ti.TypeArgs) != len(tDef.TypeArgNames) {
+		return fmt.Errorf("Template args mismatch. Expected %d args, got %d", len(tDef.TypeArgNames), len(ti.TypeArgs))
+	}
+	args := make(map[string]*Type, len(ti.TypeArgs))
+	for i, n := range tDef.TypeArgNames {
+		args[n] = ti.TypeArgs[i]
+	}
+
+	fields := make([]*Field, len(tDef.Fields))
+	for i, f := range tDef.Fields {
+		typ, err := r.resolveType(f.Type, args, from, in)
+		if err != nil {
+			return err
+		}
+		fields[i] = &Field{
 			Pos:         f.Pos,
 			Comment:     f.Comment,
 			ID:          f.ID,
 			Name:        f.Name,
 			Optional:    f.Optional,
-			Type:        resolveType(f.Type),
+			Type:        typ,
 			Default:     f.Default,
 			Annotations: f.Annotations,
 		}
-		result = append(result, ff)
 	}
-	return result, nil
+	// The arguments may have been other instances.
+	r.collectFields(fields, in)
+
+	name := tmplInstanceName(ti)
+	in.Structs[name] = &Struct{
+		Pos:         tDef.Pos,
+		Comment:     tDef.Comment,
+		Name:        name,
+		Fields:      fields,
+		Annotations: tDef.Annotations,
+	}
+	return nil
 }
 
+// RenderTemplates adds a struct for every template instance to the files
+// using it, where the instance's type refers to it by tmplInstanceName.
+// Instances can be used wherever a type can, and templates can be defined
+// in included files.
 func (p *Parser) RenderTemplates() (*Parser, error) {
-	// Find all template instances.
-	instances := make(map[string]*TemplateInstance)
-	var collectType func(t *Type)
-	collectType = func(t *Type) {
-		if t == nil {
-			return
-		}
-		if ti := t.TemplateInstance; ti != nil {
-			name := tmplInstanceName(ti)
-			if _, ok := instances[name]; !ok {
-				instances[name] = ti
-			}
-		}
-		collectType(t.KeyType)
-		collectType(t.ValueType)
+	r := &tmplRenderer{
+		files: p.Files,
+		paths: make(map[*Thrift]string, len(p.Files)),
+		seen:  make(map[*Thrift]map[string]bool, len(p.Files)),
 	}
-	collect := func(s *Struct) {
-		for _, f := range s.Fields {
-			collectType(f.Type)
-		}
+
+	// Find all template instances.
+	for path, f := range p.Files {
+		r.paths[f] = path
+		r.seen[f] = make(map[string]bool)
 	}
 	for _, f := range p.Files {
 		for _, s := range f.Structs {
-			collect(s)
+			r.collectFields(s.Fields, f)
 		}
 		for _, s := range f.Exceptions {
-			collect(s)
+			r.collectFields(s.Fields, f)
 		}
 		for _, s := range f.Unions {
-			collect(s)
+			r.collectFields(s.Fields, f)
 		}
 		for _, s := range f.Services {
 			for _, m := range s.Methods {
-				collectType(m.ReturnType)
-				for _, arg := range m.Arguments {
-					collectType(arg.Type)
-				}
-				for _, exc := range m.Exceptions {
-					collectType(exc.Type)
-				}
+				r.collectType(m.ReturnType, f)
+				r.collectFields(m.Arguments, f)
+				r.collectFields(m.Exceptions, f)
 			}
 		}
-		// TODO(ugo):
-		// f.Constants
-		// f.Enums
-		// f.Typedefs
-	}
-
-	instancesLeft := []*TemplateInstance{}
-	for _, i := range instances {
-		instancesLeft = append(instancesLeft, i)
-	}
-
-	// Traverse all template instances, rendering them.
-	// More TemplateInstances may come out now.
-	for n := len(instancesLeft); n > 0; n = len(instancesLeft) {
-		var ti *TemplateInstance
-		ti, instancesLeft = instancesLeft[n-1], instancesLeft[:n-1]
-		found := false
-		for _, f := range p.Files {
-			tDef, ok := f.TemplateDefs[ti.TemplateName]
-			if !ok {
-				continue
-			} else {
-				found = true
-			}
+		for _, t := range f.Typedefs {
+			r.collectType(t.Type, f)
+		}
+		for _, c := range f.Constants {
+			r.collectType(c.Type, f)
+		}
+	}
 
-			name := tmplInstanceName(ti)
-			fields, err := tmplResolveArgs(tDef.TypeArgNames, ti.TypeArgs, tDef.Fields)
-			if err != nil {
-				return nil, errorForTemplateName(ti.TemplateName, err)
-			}
-			f.Structs[name] = &Struct{
-				Pos:         tDef.Pos,
-				Comment:     tDef.Comment,
-				Name:        name,
-				Fields:      fields,
-				Annotations: tDef.Annotations,
-			}
-			break
+	// Render the instances. Instances used by the templates show up as
+	// they're rendered.
+	for n := len(r.left); n > 0; n = len(r.left) {
+		var pending tmplPending
+		pending, r.left = r.left[n-1], r.left[:n-1]
+		if err := checkRecursion(pending); err != nil {
+			return nil, errorForTemplateName(pending.ti.TemplateName, err)
 		}
-		if !found {
-			return nil, fmt.Errorf("Undefined template %s", ti.TemplateName)
+		r.chain = append(pending.chain[:len(pending.chain):len(pending.chain)], pending.ti)
+		if err := r.render(pending.ti, pending.in); err != nil {
+			return nil, errorForTemplateName(pending.ti.TemplateName, err)
 		}
 	}
 
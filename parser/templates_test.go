@@ -1,9 +1,36 @@
 package parser
 
-import "testing"
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
 
-func init() {
-	inTests = true
+type mapFilesystem map[string]string
+
+func (fs mapFilesystem) Open(filename string) (io.ReadCloser, error) {
+	contents, ok := fs[filename]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", filename)
+	}
+	return ioutil.NopCloser(strings.NewReader(contents)), nil
+}
+
+func (fs mapFilesystem) Abs(dir, path string) (string, error) {
+	return filepath.Join(dir, path), nil
+}
+
+func structNames(th *Thrift) []string {
+	var names []string
+	for name := range th.Structs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func TestParseTemplates(t *testing.T) {
@@ -302,3 +329,124 @@ struct SomeStruct {
 	}
 	assertStructsEqual(t, expectedStructs, thrift.Structs)
 }
+
+func TestRenderTemplates(t *testing.T) {
+	thrift, err := parse(`
+		template Pair<K, V> {
+			1: K key,
+			2: V value,
+		}
+		template Box<T> {
+			1: list<T> items,
+			2: Pair<string, T> named,
+		}
+		typedef Pair<i32, string> IntString
+		const Pair<i32, string> ONE = {"key": 1, "value": "one"}
+		struct S {
+			1: Box<i32> ints,
+			2: Pair<list<i32>, i64> a,
+			3: Pair<list<string>, i64> b,
+			4: Pair<Box<string>, i32> c,
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"Box__i32", "Box__string", "Pair__Box_string__i32", "Pair__i32__string", "Pair__list_i32__i64",
+		"Pair__list_string__i64", "Pair__string__i32", "Pair__string__string", "S",
+	}
+	if names := structNames(thrift); strings.Join(names, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Expected structs %v instead of %v", expected, names)
+	}
+	if name := thrift.Typedefs["IntString"].Name; name != "Pair__i32__string" {
+		t.Fatalf("Expected the typedef of Pair__i32__string instead of %s", name)
+	}
+	if name := thrift.Constants["ONE"].Type.Name; name != "Pair__i32__string" {
+		t.Fatalf("Expected a constant of type Pair__i32__string instead of %s", name)
+	}
+	if typ := thrift.Structs["Pair__list_string__i64"].Fields[0].Type; typ.Name != "list" || typ.ValueType.Name != "string" {
+		t.Fatalf("Expected list<string> instead of %s", pprint(typ))
+	}
+	if typ := thrift.Structs["Box__i32"].Fields[1].Type; typ.Name != "Pair__string__i32" {
+		t.Fatalf("Expected Pair__string__i32 instead of %s", pprint(typ))
+	}
+	// Rendering mustn't change the templates.
+	if typ := thrift.TemplateDefs["Box"].Fields[0].Type; typ.ValueType.Name != "T" {
+		t.Fatalf("Template Box was modified: %s", pprint(typ))
+	}
+}
+
+func TestRenderTemplatesAcrossIncludes(t *testing.T) {
+	p := &Parser{
+		Filesystem: mapFilesystem{
+			"/a/main.thrift": `
+				include "other.thrift"
+				struct Item {
+					1: i32 id
+				}
+				struct S {
+					1: other.Pair<i32, Item> p,
+				}
+			`,
+			"/a/other.thrift": `
+				struct Meta {
+					1: string note
+				}
+				template Pair<K, V> {
+					1: K key,
+					2: V value,
+					3: Meta meta,
+					4: Wrapper<V> wrapped,
+				}
+				template Wrapper<T> {
+					1: T inner
+				}
+			`,
+		},
+		Files: map[string]*Thrift{},
+	}
+	if _, _, err := p.ParseFile("/a/main.thrift"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RenderTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	main, other := p.Files["/a/main.thrift"], p.Files["/a/other.thrift"]
+	if names := structNames(other); strings.Join(names, " ") != "Meta" {
+		t.Fatalf("Expected no instances in other.thrift, got %v", names)
+	}
+	expected := "Item S other_Pair__i32__Item other_Wrapper__Item"
+	if names := structNames(main); strings.Join(names, " ") != expected {
+		t.Fatalf("Expected structs %s instead of %v", expected, names)
+	}
+	if name := main.Structs["S"].Fields[0].Type.Name; name != "other_Pair__i32__Item" {
+		t.Fatalf("Expected a field of type other_Pair__i32__Item instead of %s", name)
+	}
+	var types []string
+	for _, f := range main.Structs["other_Pair__i32__Item"].Fields {
+		types = append(types, f.Type.Name)
+	}
+	if s := strings.Join(types, " "); s != "i32 Item other.Meta other_Wrapper__Item" {
+		t.Fatalf("Unexpected field types %s", s)
+	}
+	if name := main.Structs["other_Wrapper__Item"].Fields[0].Type.Name; name != "Item" {
+		t.Fatalf("Expected a field of type Item instead of %s", name)
+	}
+}
+
+func TestRenderTemplatesErrors(t *testing.T) {
+	for _, idl := range []string{
+		`struct S { 1: Missing<i32> f }`,
+		`template Pair<K, V> { 1: K key, 2: V value }
+		 struct S { 1: Pair<i32> f }`,
+		`template R<T> { 1: optional R<list<T>> next }
+		 struct S { 1: optional R<i32> r }`,
+	} {
+		if _, err := parse(idl); err == nil {
+			t.Fatalf("Expected an error rendering %s", idl)
+		}
+	}
+}
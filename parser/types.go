@@ -16,6 +16,31 @@ type Pos struct {
 	Col  int
 }
 
+// Comments are the comments around a definition as written, for tools like
+// formatters that need to put them back. Each is the full text of a comment,
+// markers included. Blank lines before a definition are kept as "" in
+// Before, but the grammar skips those between top-level definitions.
+type Comments struct {
+	Before []string `json:",omitempty"` // on the lines before the definition
+	After  string   `json:",omitempty"` // at the end of the definition's line
+	End    []string `json:",omitempty"` // before the closing brace, or the end of the file
+}
+
+// Include is an include statement.
+type Include struct {
+	Pos      Pos
+	Path     string    // as written
+	Comments *Comments `json:",omitempty"`
+}
+
+// Namespace is a namespace statement.
+type Namespace struct {
+	Pos      Pos
+	Scope    string
+	Name     string
+	Comments *Comments `json:",omitempty"`
+}
+
 // TemplateInstance contains the reference to the template that this type is an instance of,
 // for types that are instances of a template.
 type TemplateInstance struct {
@@ -44,6 +69,7 @@ type Typedef struct {
 	Pos         Pos
 	Alias       string
 	Annotations []*Annotation `json:",omitempty"`
+	Comments    *Comments     `json:",omitempty"`
 }
 
 type EnumValue struct {
@@ -52,6 +78,7 @@ type EnumValue struct {
 	Name        string
 	Value       int
 	Annotations []*Annotation `json:",omitempty"`
+	Comments    *Comments     `json:",omitempty"`
 }
 
 // Enum is the definition of a thrift enum.
@@ -60,7 +87,9 @@ type Enum struct {
 	Comment     string
 	Name        string
 	Values      map[string]*EnumValue
+	ValueList   []*EnumValue  `json:"-"` // Values in declaration order
 	Annotations []*Annotation `json:",omitempty"`
+	Comments    *Comments     `json:",omitempty"`
 }
 
 type SEnumValue struct {
@@ -68,6 +97,7 @@ type SEnumValue struct {
 	Comment     string
 	Value       string
 	Annotations []*Annotation `json:",omitempty"`
+	Comments    *Comments     `json:",omitempty"`
 }
 
 // SEnum is the definition of a thrift senum - analogous to an enum, but its value is the string value.
@@ -76,15 +106,18 @@ type SEnum struct {
 	Comment     string
 	Name        string
 	Values      map[string]*SEnumValue
+	ValueList   []*SEnumValue `json:"-"` // Values in declaration order
 	Annotations []*Annotation `json:",omitempty"`
+	Comments    *Comments     `json:",omitempty"`
 }
 
 type Constant struct {
-	Pos     Pos
-	Comment string
-	Name    string
-	Type    *Type
-	Value   interface{}
+	Pos      Pos
+	Comment  string
+	Name     string
+	Type     *Type
+	Value    interface{}
+	Comments *Comments `json:",omitempty"`
 }
 
 // Field is the definition of a struct's field.
@@ -94,9 +127,11 @@ type Field struct {
 	ID          int
 	Name        string
 	Optional    bool
+	Required    bool `json:",omitempty"` // declared required, rather than by default
 	Type        *Type
 	Default     interface{}   `json:",omitempty"`
 	Annotations []*Annotation `json:",omitempty"`
+	Comments    *Comments     `json:",omitempty"`
 }
 
 // Struct is the definition of a thrift struct.
@@ -106,6 +141,7 @@ type Struct struct {
 	Name        string
 	Fields      []*Field
 	Annotations []*Annotation `json:",omitempty"`
+	Comments    *Comments     `json:",omitempty"`
 }
 
 // TemplateDef is the definition of a templated thrift struct.
@@ -125,6 +161,7 @@ type Method struct {
 	Arguments   []*Field
 	Exceptions  []*Field      `json:",omitempty"`
 	Annotations []*Annotation `json:",omitempty"`
+	Comments    *Comments     `json:",omitempty"`
 }
 
 // Service is the definition of a thrift service.
@@ -134,7 +171,11 @@ type Service struct {
 	Name        string
 	Extends     string `json:",omitempty"`
 	Methods     map[string]*Method
+	MethodList  []*Method     `json:"-"` // Methods in declaration order
 	Annotations []*Annotation `json:",omitempty"`
+	Comments    *Comments     `json:",omitempty"`
+
+	duplicateMethods []*Method // methods whose name was taken, for Validate
 }
 
 // Thrift is the output of parsing a whole thrift file.
@@ -152,6 +193,16 @@ type Thrift struct {
 	Unions       map[string]*Struct      `json:",omitempty"`
 	TemplateDefs map[string]*TemplateDef `json:",omitempty"`
 	Services     map[string]*Service     `json:",omitempty"`
+
+	// Definitions holds the statements of the file in declaration order.
+	Definitions []*Definition `json:"-"`
+	Comments    *Comments     `json:",omitempty"` // End holds the comments ending the file
+}
+
+// Definition is a statement of a Thrift file.
+type Definition struct {
+	Kind  string      // "include", "namespace", "const", "typedef", "enum", "senum", "struct", "exception", "union", "template" or "service"
+	Value interface{} // *Include, *Namespace, *Constant, *Typedef, *Enum, *SEnum, *Struct, *TemplateDef or *Service
 }
 
 type Identifier string
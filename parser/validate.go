@@ -0,0 +1,180 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Diagnostic is a problem found by Validate.
+type Diagnostic struct {
+	Filename string
+	Pos      Pos
+	Message  string
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", d.Filename, d.Pos.Line, d.Pos.Col, d.Message)
+}
+
+// Validate checks what the grammar can't for files as returned by
+// ParseFile: that field IDs and method names are unique, that referenced
+// types and extended services exist, that enum values fit in an i32 and
+// that unions have no required fields. Templates should be rendered first,
+// as instances are otherwise unknown types. It returns the problems found
+// sorted by file and position.
+func Validate(files map[string]*Thrift) []*Diagnostic {
+	v := &validator{files: files}
+	filenames := make([]string, 0, len(files))
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		v.filename, v.th = filename, files[filename]
+		v.validateFile()
+	}
+	sort.Slice(v.diags, func(i, j int) bool {
+		a, b := v.diags[i], v.diags[j]
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Pos.Line != b.Pos.Line {
+			return a.Pos.Line < b.Pos.Line
+		}
+		if a.Pos.Col != b.Pos.Col {
+			return a.Pos.Col < b.Pos.Col
+		}
+		return a.Message < b.Message
+	})
+	return v.diags
+}
+
+type validator struct {
+	files    map[string]*Thrift
+	filename string
+	th       *Thrift
+	diags    []*Diagnostic
+}
+
+func (v *validator) errorf(pos Pos, format string, args ...interface{}) {
+	v.diags = append(v.diags, &Diagnostic{v.filename, pos, fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validateFile() {
+	th := v.th
+	for _, td := range th.Typedefs {
+		v.validateType(td.Type, td.Pos)
+	}
+	for _, c := range th.Constants {
+		v.validateType(c.Type, c.Pos)
+	}
+	for _, e := range th.Enums {
+		for _, ev := range e.Values {
+			if ev.Value < math.MinInt32 || ev.Value > math.MaxInt32 {
+				v.errorf(ev.Pos, "value %d of %s.%s is out of the i32 range", ev.Value, e.Name, ev.Name)
+			}
+		}
+	}
+	for _, st := range th.Structs {
+		v.validateFields(st.Fields, "struct "+st.Name, false)
+	}
+	for _, st := range th.Exceptions {
+		v.validateFields(st.Fields, "exception "+st.Name, false)
+	}
+	for _, st := range th.Unions {
+		v.validateFields(st.Fields, "union "+st.Name, true)
+	}
+	for _, svc := range th.Services {
+		v.validateService(svc)
+	}
+}
+
+func (v *validator) validateFields(fields []*Field, owner string, union bool) {
+	ids := make(map[int]*Field, len(fields))
+	names := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if other := ids[f.ID]; other != nil {
+			v.errorf(f.Pos, "field %s of %s has the same ID %d as %s", f.Name, owner, f.ID, other.Name)
+		} else {
+			ids[f.ID] = f
+		}
+		if names[f.Name] {
+			v.errorf(f.Pos, "duplicate field %s in %s", f.Name, owner)
+		}
+		names[f.Name] = true
+		if union && f.Required {
+			v.errorf(f.Pos, "field %s of %s can't be required", f.Name, owner)
+		}
+		v.validateType(f.Type, f.Pos)
+	}
+}
+
+func (v *validator) validateService(svc *Service) {
+	for _, m := range svc.duplicateMethods {
+		v.errorf(m.Pos, "duplicate method %s in service %s", m.Name, svc.Name)
+	}
+	if svc.Extends != "" {
+		if th, name := v.lookup(svc.Extends); th == nil || th.Services[name] == nil {
+			v.errorf(svc.Pos, "service %s extends unknown service %s", svc.Name, svc.Extends)
+		}
+	}
+	for _, m := range svc.Methods {
+		owner := "method " + svc.Name + "." + m.Name
+		if m.ReturnType != nil {
+			v.validateType(m.ReturnType, m.Pos)
+		}
+		v.validateFields(m.Arguments, owner, false)
+		v.validateFields(m.Exceptions, owner, false)
+		for _, a := range m.Annotations {
+			if a.Name == "idempotent" && a.Value != "true" && a.Value != "false" {
+				v.errorf(a.Pos, "idempotent annotation of %s must be \"true\" or \"false\"", owner)
+			}
+		}
+		for _, ex := range m.Exceptions {
+			if th, name := v.lookup(ex.Type.Name); th != nil && th.Exceptions[name] == nil && v.defined(ex.Type.Name) {
+				v.errorf(ex.Pos, "%s thrown by %s isn't an exception", ex.Type.Name, owner)
+			}
+		}
+	}
+}
+
+// lookup returns the file defining name, possibly qualified by an include,
+// and the name in that file.
+func (v *validator) lookup(name string) (*Thrift, string) {
+	if i := strings.Index(name, "."); i >= 0 {
+		return v.files[v.th.Includes[name[:i]]], name[i+1:]
+	}
+	return v.th, name
+}
+
+func (v *validator) defined(name string) bool {
+	th, name := v.lookup(name)
+	if th == nil {
+		return false
+	}
+	return th.Typedefs[name] != nil || th.Enums[name] != nil || th.SEnums[name] != nil ||
+		th.Structs[name] != nil || th.Exceptions[name] != nil || th.Unions[name] != nil
+}
+
+// validateType checks that the types referenced by t exist. pos is used
+// for types without a position of their own.
+func (v *validator) validateType(t *Type, pos Pos) {
+	if t == nil {
+		return
+	}
+	if t.Pos != (Pos{}) {
+		pos = t.Pos
+	}
+	switch {
+	case t.Name == "void":
+		v.errorf(pos, "void is only allowed as a return type")
+	case t.Name == "list" || t.Name == "set" || t.Name == "map":
+		v.validateType(t.KeyType, pos)
+		v.validateType(t.ValueType, pos)
+	case builtinTypes[t.Name]:
+	case !v.defined(t.Name):
+		v.errorf(pos, "unknown type %s", t.Name)
+	}
+}
@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func validate(t *testing.T, fs mapFilesystem) []string {
+	inTests = false
+	defer func() { inTests = true }()
+
+	p := &Parser{Filesystem: fs, Files: map[string]*Thrift{}}
+	if _, _, err := p.ParseFile("/a/main.thrift"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RenderTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	var diags []string
+	for _, d := range Validate(p.Files) {
+		diags = append(diags, d.Error())
+	}
+	return diags
+}
+
+func TestValidate(t *testing.T) {
+	diags := validate(t, mapFilesystem{
+		"/a/main.thrift": `include "other.thrift"
+struct S {
+  1: i32 a,
+  1: i32 b,
+  2: Missing c,
+  3: other.Missing d,
+  4: list<map<string, Nope>> e,
+  5: void f,
+}
+union U {
+  1: required i32 a,
+  2: optional i32 b,
+}
+enum E {
+  BIG = 2147483648,
+}
+typedef Unknown T
+service Base extends other.Nowhere {
+  void m(1: i32 a, 1: i32 b) throws (1: S s),
+  void m(),
+  i32 n() (idempotent = "yes"),
+}
+`,
+		"/a/other.thrift": `struct Ok {
+  1: i32 a,
+  1: i32 b,
+}
+`,
+	})
+	expected := []string{
+		"/a/main.thrift:4:3: field b of struct S has the same ID 1 as a",
+		"/a/main.thrift:5:6: unknown type Missing",
+		"/a/main.thrift:6:6: unknown type other.Missing",
+		"/a/main.thrift:7:23: unknown type Nope",
+		"/a/main.thrift:8:6: void is only allowed as a return type",
+		"/a/main.thrift:11:3: field a of union U can't be required",
+		"/a/main.thrift:15:3: value 2147483648 of E.BIG is out of the i32 range",
+		"/a/main.thrift:17:9: unknown type Unknown",
+		"/a/main.thrift:18:1: service Base extends unknown service other.Nowhere",
+		"/a/main.thrift:19:20: field b of method Base.m has the same ID 1 as a",
+		"/a/main.thrift:19:38: S thrown by method Base.m isn't an exception",
+		"/a/main.thrift:20:3: duplicate method m in service Base",
+		"/a/main.thrift:21:12: idempotent annotation of method Base.n must be \"true\" or \"false\"",
+		"/a/other.thrift:3:3: field b of struct Ok has the same ID 1 as a",
+	}
+	if strings.Join(diags, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected diagnostics\n%s\ninstead of\n%s", strings.Join(expected, "\n"), strings.Join(diags, "\n"))
+	}
+}
+
+func TestValidateValid(t *testing.T) {
+	diags := validate(t, mapFilesystem{
+		"/a/main.thrift": `include "other.thrift"
+typedef other.Ok Alias
+template Pair<K, V> {
+  1: K key,
+  2: V value,
+}
+exception Oops {
+  1: string msg,
+}
+union U {
+  1: i32 a,
+  2: Alias b,
+}
+service Svc extends other.Base {
+  Pair<i32, U> get(1: map<string, other.Ok> m) throws (1: Oops oops),
+}
+`,
+		"/a/other.thrift": `struct Ok {
+  1: i32 a,
+}
+service Base {
+  oneway void ping(),
+}
+`,
+	})
+	if len(diags) != 0 {
+		t.Fatalf("Expected no diagnostics instead of\n%s", strings.Join(diags, "\n"))
+	}
+}
+
+func TestValidateDuplicateMethod(t *testing.T) {
+	fs := mapFilesystem{
+		"/a/main.thrift": `service S {
+  i32 m(),
+  string m(1: i32 a),
+}
+`,
+	}
+	diags := validate(t, fs)
+	expected := "/a/main.thrift:3:3: duplicate method m in service S"
+	if len(diags) != 1 || diags[0] != expected {
+		t.Fatalf("Expected diagnostic\n%s\ninstead of\n%s", expected, strings.Join(diags, "\n"))
+	}
+
+	// The first declaration of a method is kept, the others are only
+	// reported.
+	p := &Parser{Filesystem: fs, Files: map[string]*Thrift{}}
+	if _, _, err := p.ParseFile("/a/main.thrift"); err != nil {
+		t.Fatal(err)
+	}
+	m := p.Files["/a/main.thrift"].Services["S"].Methods["m"]
+	if m == nil || m.ReturnType.Name != "i32" || len(m.Arguments) != 0 {
+		t.Fatalf("Expected the first declaration of m, got %s", pprint(m))
+	}
+}
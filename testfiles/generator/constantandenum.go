@@ -9,13 +9,13 @@ import (
 
 var _ = fmt.Sprintf
 
-const Fst = MyEnumFirst
-
 var Stringy = map[MyEnum]string{
 	MyEnumFirst:  "1st",
 	MyEnumSecond: "2nd",
 }
 
+const Fst = MyEnumFirst
+
 type MyEnum int32
 
 const (
@@ -0,0 +1,134 @@
+// This file is automatically generated. Do not modify.
+
+package gentest
+
+import (
+	"fmt"
+	"strconv"
+)
+
+var _ = fmt.Sprintf
+
+type Limit int32
+
+const DefaultLimit = 100
+
+var BusinessHours = &Window{Start: &[]int32{9}[0], End: &[]int32{17}[0], Zone: &[]string{"UTC"}[0]}
+
+type Level int32
+
+const (
+	LevelLow  Level = 1
+	LevelHigh Level = 2
+)
+
+var (
+	LevelByName = map[string]Level{
+		"Level.LOW":  LevelLow,
+		"Level.HIGH": LevelHigh,
+	}
+	LevelByValue = map[Level]string{
+		LevelLow:  "Level.LOW",
+		LevelHigh: "Level.HIGH",
+	}
+)
+
+func (e Level) String() string {
+	name := LevelByValue[e]
+	if name == "" {
+		name = fmt.Sprintf("Unknown enum value Level(%d)", e)
+	}
+	return name
+}
+
+func (e Level) MarshalJSON() ([]byte, error) {
+	name := LevelByValue[e]
+	if name == "" {
+		name = strconv.Itoa(int(e))
+	}
+	return []byte("\"" + name + "\""), nil
+}
+
+func (e *Level) UnmarshalJSON(b []byte) error {
+	st := string(b)
+	if st[0] == '"' {
+		*e = Level(LevelByName[st[1:len(st)-1]])
+		return nil
+	}
+	i, err := strconv.Atoi(st)
+	*e = Level(i)
+	return err
+}
+
+type Window struct {
+	Start *int32  `thrift:"1,required" json:"start"`
+	End   *int32  `thrift:"2,required" json:"end"`
+	Zone  *string `thrift:"3" json:"zone,omitempty"`
+}
+
+func NewWindow() *Window {
+	s := &Window{}
+	s.SetDefaults()
+	return s
+}
+
+func (s *Window) SetDefaults() {
+	s.Start = new(int32)
+	*s.Start = 0
+	s.End = new(int32)
+	*s.End = 24
+	s.Zone = new(string)
+	*s.Zone = "UTC"
+}
+
+type Settings struct {
+	Enabled     *bool              `thrift:"1,required" json:"enabled"`
+	Retries     *byte              `thrift:"2,required" json:"retries"`
+	Timeout     *int64             `thrift:"3,required" json:"timeout"`
+	Ratio       *float64           `thrift:"4,required" json:"ratio"`
+	Name        *string            `thrift:"5,required" json:"name"`
+	Token       []byte             `thrift:"6,required" json:"token"`
+	Level       *Level             `thrift:"7,required" json:"level"`
+	Limit       *Limit             `thrift:"8,required" json:"limit"`
+	Fallback    *Level             `thrift:"9" json:"fallback,omitempty"`
+	LevelNumber *int32             `thrift:"10,required" json:"levelNumber"`
+	Tags        []*string          `thrift:"11,required" json:"tags"`
+	Ports       map[int32]struct{} `thrift:"12,required" json:"ports"`
+	Levels      map[string]Level   `thrift:"13,required" json:"levels"`
+	Hours       *Window            `thrift:"14,required" json:"hours"`
+	Lunch       *Window            `thrift:"15" json:"lunch,omitempty"`
+	NoDefault   *int32             `thrift:"16,required" json:"noDefault"`
+}
+
+func NewSettings() *Settings {
+	s := &Settings{}
+	s.SetDefaults()
+	return s
+}
+
+func (s *Settings) SetDefaults() {
+	s.Enabled = new(bool)
+	*s.Enabled = true
+	s.Retries = new(byte)
+	*s.Retries = 3
+	s.Timeout = new(int64)
+	*s.Timeout = 30000
+	s.Ratio = new(float64)
+	*s.Ratio = 0.5
+	s.Name = new(string)
+	*s.Name = "default"
+	s.Token = []byte("abc")
+	s.Level = new(Level)
+	*s.Level = LevelHigh
+	s.Limit = new(Limit)
+	*s.Limit = 100
+	s.Fallback = new(Level)
+	*s.Fallback = LevelLow
+	s.LevelNumber = new(int32)
+	*s.LevelNumber = 2
+	s.Tags = []*string{&[]string{"a"}[0], &[]string{"b"}[0]}
+	s.Ports = map[int32]struct{}{80: {}, 443: {}}
+	s.Levels = map[string]Level{"x": LevelLow}
+	s.Hours = &Window{Start: &[]int32{9}[0], End: &[]int32{17}[0], Zone: &[]string{"UTC"}[0]}
+	s.Lunch = &Window{Start: &[]int32{12}[0], End: &[]int32{13}[0], Zone: &[]string{"UTC"}[0]}
+}
@@ -0,0 +1,36 @@
+namespace go gentest
+
+enum Level {
+	LOW = 1,
+	HIGH = 2,
+}
+
+typedef i32 Limit
+
+const i32 DEFAULT_LIMIT = 100
+const Window BUSINESS_HOURS = {"start": 9, "end": 17}
+
+struct Window {
+	1: i32 start = 0,
+	2: i32 end = 24,
+	3: optional string zone = "UTC",
+}
+
+struct Settings {
+	1: bool enabled = true,
+	2: byte retries = 3,
+	3: i64 timeout = 30000,
+	4: double ratio = 0.5,
+	5: string name = "default",
+	6: binary token = "abc",
+	7: Level level = Level.HIGH,
+	8: Limit limit = DEFAULT_LIMIT,
+	9: optional Level fallback = Level.LOW,
+	10: i32 levelNumber = Level.HIGH,
+	11: list<string> tags = ["a", "b"],
+	12: set<i32> ports = [80, 443],
+	13: map<string, Level> levels = {"x": Level.LOW},
+	14: Window hours = BUSINESS_HOURS,
+	15: optional Window lunch = {"start": 12, "end": 13},
+	16: i32 noDefault,
+}
@@ -0,0 +1,52 @@
+// This file is automatically generated. Do not modify.
+
+package gentest
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Sprintf
+
+type Direction string
+
+const (
+	DirectionNorth Direction = "NORTH"
+	DirectionSouth Direction = "SOUTH"
+	DirectionEast  Direction = "EAST"
+	DirectionWest  Direction = "WEST"
+)
+
+// IsValid reports whether e is one of the values of Direction.
+func (e Direction) IsValid() bool {
+	switch e {
+	case DirectionNorth, DirectionSouth, DirectionEast, DirectionWest:
+		return true
+	}
+	return false
+}
+
+type Empty string
+
+// IsValid reports whether e is one of the values of Empty, which has none.
+func (e Empty) IsValid() bool {
+	return false
+}
+
+type Route struct {
+	Heading   *Direction          `thrift:"1,required" json:"heading"`
+	Turn      *Direction          `thrift:"2" json:"turn,omitempty"`
+	Legs      []*Direction        `thrift:"3,required" json:"legs"`
+	Distances map[Direction]int32 `thrift:"4,required" json:"distances"`
+}
+
+func NewRoute() *Route {
+	s := &Route{}
+	s.SetDefaults()
+	return s
+}
+
+func (s *Route) SetDefaults() {
+	s.Heading = new(Direction)
+	*s.Heading = "NORTH"
+}
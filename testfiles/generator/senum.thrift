@@ -0,0 +1,17 @@
+namespace go gentest
+
+senum Direction {
+	NORTH,
+	SOUTH,
+	EAST,
+	WEST,
+}
+
+senum Empty {}
+
+struct Route {
+	1: Direction heading = "NORTH",
+	2: optional Direction turn,
+	3: list<Direction> legs,
+	4: map<Direction, i32> distances,
+}
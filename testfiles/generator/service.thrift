@@ -0,0 +1,14 @@
+namespace go gentest
+
+exception Unavailable {
+	1: string reason
+}
+
+service Base {
+	string version() (idempotent = "true")
+}
+
+service Counter extends Base {
+	i64 incr(1: string key, 2: i64 delta) throws (1: Unavailable unavailable),
+	oneway void reset(1: string key)
+}
@@ -9,8 +9,8 @@ import (
 var _ = fmt.Sprintf
 
 type Binary []byte
-type Int32 int32
 type String string
+type Int32 int32
 
 type St struct {
 	B *Binary `thrift:"1,required" json:"b"`
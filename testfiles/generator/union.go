@@ -0,0 +1,54 @@
+// This file is automatically generated. Do not modify.
+
+package gentest
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Sprintf
+
+type Value struct {
+	Number *int64    `thrift:"1,union" json:"number,omitempty"`
+	Text   *string   `thrift:"2,union" json:"text,omitempty"`
+	Items  []*string `thrift:"3,union" json:"items,omitempty"`
+	Data   []byte    `thrift:"4,union" json:"data,omitempty"`
+}
+
+const (
+	ValueFieldNumber = 1
+	ValueFieldText   = 2
+	ValueFieldItems  = 3
+	ValueFieldData   = 4
+)
+
+// Which returns the ID of the field set in the union, or 0 if none is.
+func (s *Value) Which() int {
+	switch {
+	case s.Number != nil:
+		return ValueFieldNumber
+	case s.Text != nil:
+		return ValueFieldText
+	case s.Items != nil:
+		return ValueFieldItems
+	case s.Data != nil:
+		return ValueFieldData
+	}
+	return 0
+}
+
+func (s *Value) SetNumber(v int64) {
+	*s = Value{Number: &v}
+}
+
+func (s *Value) SetText(v string) {
+	*s = Value{Text: &v}
+}
+
+func (s *Value) SetItems(v []*string) {
+	*s = Value{Items: v}
+}
+
+func (s *Value) SetData(v []byte) {
+	*s = Value{Data: v}
+}
@@ -0,0 +1,8 @@
+namespace go gentest
+
+union Value {
+	1: i64 number,
+	2: string text,
+	3: list<string> items,
+	4: binary data,
+}
@@ -0,0 +1,2153 @@
+// This file is automatically generated. Do not modify.
+
+package gentest
+
+import (
+	"fmt"
+	"github.com/ugodiggi/go-thrift/thrift"
+	"strconv"
+)
+
+var _ = fmt.Sprintf
+
+type Blob []byte
+type Name string
+type Count int32
+type Names []string
+
+type Color int32
+
+const (
+	ColorRed   Color = 1
+	ColorGreen Color = 2
+)
+
+var (
+	ColorByName = map[string]Color{
+		"Color.RED":   ColorRed,
+		"Color.GREEN": ColorGreen,
+	}
+	ColorByValue = map[Color]string{
+		ColorRed:   "Color.RED",
+		ColorGreen: "Color.GREEN",
+	}
+)
+
+func (e Color) String() string {
+	name := ColorByValue[e]
+	if name == "" {
+		name = fmt.Sprintf("Unknown enum value Color(%d)", e)
+	}
+	return name
+}
+
+func (e Color) MarshalJSON() ([]byte, error) {
+	name := ColorByValue[e]
+	if name == "" {
+		name = strconv.Itoa(int(e))
+	}
+	return []byte("\"" + name + "\""), nil
+}
+
+func (e *Color) UnmarshalJSON(b []byte) error {
+	st := string(b)
+	if st[0] == '"' {
+		*e = Color(ColorByName[st[1:len(st)-1]])
+		return nil
+	}
+	i, err := strconv.Atoi(st)
+	*e = Color(i)
+	return err
+}
+
+type Unit string
+
+const (
+	UnitCm   Unit = "CM"
+	UnitInch Unit = "INCH"
+)
+
+// IsValid reports whether e is one of the values of Unit.
+func (e Unit) IsValid() bool {
+	switch e {
+	case UnitCm, UnitInch:
+		return true
+	}
+	return false
+}
+
+type Point struct {
+	X int32 `thrift:"1,required" json:"x"`
+	Y int32 `thrift:"2,required" json:"y"`
+}
+
+func (s *Point) EncodeThrift(w thrift.ProtocolWriter) error {
+	if err := w.WriteStructBegin("Point"); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("X", thrift.TypeI32, 1); err != nil {
+		return err
+	}
+	if err := w.WriteI32(s.X); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Y", thrift.TypeI32, 2); err != nil {
+		return err
+	}
+	if err := w.WriteI32(s.Y); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldStop(); err != nil {
+		return err
+	}
+	return w.WriteStructEnd()
+}
+
+func (s *Point) DecodeThrift(r thrift.ProtocolReader) error {
+	if err := r.ReadStructBegin(); err != nil {
+		return err
+	}
+	var issetX, issetY bool
+	for {
+		ftype, id, err := r.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if ftype == thrift.TypeStop {
+			break
+		}
+		switch id {
+		case 1:
+			if ftype != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Point", FieldName: "X", Type: ftype}
+			}
+			if v, err := r.ReadI32(); err != nil {
+				return err
+			} else {
+				s.X = v
+			}
+			issetX = true
+		case 2:
+			if ftype != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Point", FieldName: "Y", Type: ftype}
+			}
+			if v, err := r.ReadI32(); err != nil {
+				return err
+			} else {
+				s.Y = v
+			}
+			issetY = true
+		default:
+			if err := thrift.SkipValue(r, ftype); err != nil {
+				return err
+			}
+		}
+		if err := r.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := r.ReadStructEnd(); err != nil {
+		return err
+	}
+	if !issetX {
+		return &thrift.MissingRequiredField{StructName: "Point", FieldName: "X"}
+	}
+	if !issetY {
+		return &thrift.MissingRequiredField{StructName: "Point", FieldName: "Y"}
+	}
+	return nil
+}
+
+type Basics struct {
+	Flag  bool    `thrift:"1,required" json:"flag"`
+	Small byte    `thrift:"2,required" json:"small"`
+	Short int16   `thrift:"3,required" json:"short"`
+	Int   int32   `thrift:"4,required" json:"int"`
+	Long  int64   `thrift:"5,required" json:"long"`
+	Real  float64 `thrift:"6,required" json:"real"`
+	Text  string  `thrift:"7,required" json:"text"`
+	Data  []byte  `thrift:"8,required" json:"data"`
+	Color Color   `thrift:"9,required" json:"color"`
+	Blob  Blob    `thrift:"10,required" json:"blob"`
+	Name  Name    `thrift:"11,required" json:"name"`
+	Count Count   `thrift:"12,required" json:"count"`
+}
+
+func (s *Basics) EncodeThrift(w thrift.ProtocolWriter) error {
+	if err := w.WriteStructBegin("Basics"); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Flag", thrift.TypeBool, 1); err != nil {
+		return err
+	}
+	if err := w.WriteBool(s.Flag); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Small", thrift.TypeByte, 2); err != nil {
+		return err
+	}
+	if err := w.WriteByte(s.Small); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Short", thrift.TypeI16, 3); err != nil {
+		return err
+	}
+	if err := w.WriteI16(s.Short); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Int", thrift.TypeI32, 4); err != nil {
+		return err
+	}
+	if err := w.WriteI32(s.Int); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Long", thrift.TypeI64, 5); err != nil {
+		return err
+	}
+	if err := w.WriteI64(s.Long); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Real", thrift.TypeDouble, 6); err != nil {
+		return err
+	}
+	if err := w.WriteDouble(s.Real); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Text", thrift.TypeString, 7); err != nil {
+		return err
+	}
+	if err := w.WriteString(s.Text); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Data", thrift.TypeString, 8); err != nil {
+		return err
+	}
+	if err := w.WriteBytes(s.Data); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Color", thrift.TypeI32, 9); err != nil {
+		return err
+	}
+	if err := w.WriteI32(int32(s.Color)); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Blob", thrift.TypeString, 10); err != nil {
+		return err
+	}
+	if err := w.WriteBytes([]byte(s.Blob)); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Name", thrift.TypeString, 11); err != nil {
+		return err
+	}
+	if err := w.WriteString(string(s.Name)); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Count", thrift.TypeI32, 12); err != nil {
+		return err
+	}
+	if err := w.WriteI32(int32(s.Count)); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldStop(); err != nil {
+		return err
+	}
+	return w.WriteStructEnd()
+}
+
+func (s *Basics) DecodeThrift(r thrift.ProtocolReader) error {
+	if err := r.ReadStructBegin(); err != nil {
+		return err
+	}
+	var issetFlag, issetSmall, issetShort, issetInt, issetLong, issetReal, issetText, issetData, issetColor, issetBlob, issetName, issetCount bool
+	for {
+		ftype, id, err := r.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if ftype == thrift.TypeStop {
+			break
+		}
+		switch id {
+		case 1:
+			if ftype != thrift.TypeBool {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Flag", Type: ftype}
+			}
+			if v, err := r.ReadBool(); err != nil {
+				return err
+			} else {
+				s.Flag = v
+			}
+			issetFlag = true
+		case 2:
+			if ftype != thrift.TypeByte {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Small", Type: ftype}
+			}
+			if v, err := r.ReadByte(); err != nil {
+				return err
+			} else {
+				s.Small = v
+			}
+			issetSmall = true
+		case 3:
+			if ftype != thrift.TypeI16 {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Short", Type: ftype}
+			}
+			if v, err := r.ReadI16(); err != nil {
+				return err
+			} else {
+				s.Short = v
+			}
+			issetShort = true
+		case 4:
+			if ftype != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Int", Type: ftype}
+			}
+			if v, err := r.ReadI32(); err != nil {
+				return err
+			} else {
+				s.Int = v
+			}
+			issetInt = true
+		case 5:
+			if ftype != thrift.TypeI64 {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Long", Type: ftype}
+			}
+			if v, err := r.ReadI64(); err != nil {
+				return err
+			} else {
+				s.Long = v
+			}
+			issetLong = true
+		case 6:
+			if ftype != thrift.TypeDouble {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Real", Type: ftype}
+			}
+			if v, err := r.ReadDouble(); err != nil {
+				return err
+			} else {
+				s.Real = v
+			}
+			issetReal = true
+		case 7:
+			if ftype != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Text", Type: ftype}
+			}
+			if v, err := r.ReadString(); err != nil {
+				return err
+			} else {
+				s.Text = v
+			}
+			issetText = true
+		case 8:
+			if ftype != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Data", Type: ftype}
+			}
+			if v, err := r.ReadBytes(); err != nil {
+				return err
+			} else {
+				s.Data = v
+			}
+			issetData = true
+		case 9:
+			if ftype != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Color", Type: ftype}
+			}
+			if v, err := r.ReadI32(); err != nil {
+				return err
+			} else {
+				s.Color = Color(v)
+			}
+			issetColor = true
+		case 10:
+			if ftype != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Blob", Type: ftype}
+			}
+			if v, err := r.ReadBytes(); err != nil {
+				return err
+			} else {
+				s.Blob = Blob(v)
+			}
+			issetBlob = true
+		case 11:
+			if ftype != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Name", Type: ftype}
+			}
+			if v, err := r.ReadString(); err != nil {
+				return err
+			} else {
+				s.Name = Name(v)
+			}
+			issetName = true
+		case 12:
+			if ftype != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Basics", FieldName: "Count", Type: ftype}
+			}
+			if v, err := r.ReadI32(); err != nil {
+				return err
+			} else {
+				s.Count = Count(v)
+			}
+			issetCount = true
+		default:
+			if err := thrift.SkipValue(r, ftype); err != nil {
+				return err
+			}
+		}
+		if err := r.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := r.ReadStructEnd(); err != nil {
+		return err
+	}
+	if !issetFlag {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Flag"}
+	}
+	if !issetSmall {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Small"}
+	}
+	if !issetShort {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Short"}
+	}
+	if !issetInt {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Int"}
+	}
+	if !issetLong {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Long"}
+	}
+	if !issetReal {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Real"}
+	}
+	if !issetText {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Text"}
+	}
+	if !issetData {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Data"}
+	}
+	if !issetColor {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Color"}
+	}
+	if !issetBlob {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Blob"}
+	}
+	if !issetName {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Name"}
+	}
+	if !issetCount {
+		return &thrift.MissingRequiredField{StructName: "Basics", FieldName: "Count"}
+	}
+	return nil
+}
+
+type Optionals struct {
+	Flag  *bool   `thrift:"1" json:"flag,omitempty"`
+	Long  *int64  `thrift:"2" json:"long,omitempty"`
+	Text  *string `thrift:"3" json:"text,omitempty"`
+	Data  []byte  `thrift:"4" json:"data,omitempty"`
+	Color *Color  `thrift:"5" json:"color,omitempty"`
+	Count *Count  `thrift:"6" json:"count,omitempty"`
+	Point *Point  `thrift:"7" json:"point,omitempty"`
+	Ints  []int32 `thrift:"8" json:"ints,omitempty"`
+}
+
+func (s *Optionals) EncodeThrift(w thrift.ProtocolWriter) error {
+	if err := w.WriteStructBegin("Optionals"); err != nil {
+		return err
+	}
+	if s.Flag != nil {
+		if err := w.WriteFieldBegin("Flag", thrift.TypeBool, 1); err != nil {
+			return err
+		}
+		if err := w.WriteBool(*s.Flag); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if s.Long != nil {
+		if err := w.WriteFieldBegin("Long", thrift.TypeI64, 2); err != nil {
+			return err
+		}
+		if err := w.WriteI64(*s.Long); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if s.Text != nil {
+		if err := w.WriteFieldBegin("Text", thrift.TypeString, 3); err != nil {
+			return err
+		}
+		if err := w.WriteString(*s.Text); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if s.Data != nil {
+		if err := w.WriteFieldBegin("Data", thrift.TypeString, 4); err != nil {
+			return err
+		}
+		if err := w.WriteBytes(s.Data); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if s.Color != nil {
+		if err := w.WriteFieldBegin("Color", thrift.TypeI32, 5); err != nil {
+			return err
+		}
+		if err := w.WriteI32(int32(*s.Color)); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if s.Count != nil {
+		if err := w.WriteFieldBegin("Count", thrift.TypeI32, 6); err != nil {
+			return err
+		}
+		if err := w.WriteI32(int32(*s.Count)); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if s.Point != nil {
+		if err := w.WriteFieldBegin("Point", thrift.TypeStruct, 7); err != nil {
+			return err
+		}
+		if err := s.Point.EncodeThrift(w); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if s.Ints != nil {
+		if err := w.WriteFieldBegin("Ints", thrift.TypeList, 8); err != nil {
+			return err
+		}
+		if err := w.WriteListBegin(thrift.TypeI32, len(s.Ints)); err != nil {
+			return err
+		}
+		for _, e1 := range s.Ints {
+			if err := w.WriteI32(e1); err != nil {
+				return err
+			}
+		}
+		if err := w.WriteListEnd(); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteFieldStop(); err != nil {
+		return err
+	}
+	return w.WriteStructEnd()
+}
+
+func (s *Optionals) DecodeThrift(r thrift.ProtocolReader) error {
+	if err := r.ReadStructBegin(); err != nil {
+		return err
+	}
+	for {
+		ftype, id, err := r.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if ftype == thrift.TypeStop {
+			break
+		}
+		switch id {
+		case 1:
+			if ftype != thrift.TypeBool {
+				return &thrift.FieldTypeMismatch{StructName: "Optionals", FieldName: "Flag", Type: ftype}
+			}
+			if v, err := r.ReadBool(); err != nil {
+				return err
+			} else {
+				s.Flag = &v
+			}
+		case 2:
+			if ftype != thrift.TypeI64 {
+				return &thrift.FieldTypeMismatch{StructName: "Optionals", FieldName: "Long", Type: ftype}
+			}
+			if v, err := r.ReadI64(); err != nil {
+				return err
+			} else {
+				s.Long = &v
+			}
+		case 3:
+			if ftype != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Optionals", FieldName: "Text", Type: ftype}
+			}
+			if v, err := r.ReadString(); err != nil {
+				return err
+			} else {
+				s.Text = &v
+			}
+		case 4:
+			if ftype != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Optionals", FieldName: "Data", Type: ftype}
+			}
+			if v, err := r.ReadBytes(); err != nil {
+				return err
+			} else {
+				s.Data = v
+			}
+		case 5:
+			if ftype != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Optionals", FieldName: "Color", Type: ftype}
+			}
+			if v, err := r.ReadI32(); err != nil {
+				return err
+			} else {
+				x := Color(v)
+				s.Color = &x
+			}
+		case 6:
+			if ftype != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Optionals", FieldName: "Count", Type: ftype}
+			}
+			if v, err := r.ReadI32(); err != nil {
+				return err
+			} else {
+				x := Count(v)
+				s.Count = &x
+			}
+		case 7:
+			if ftype != thrift.TypeStruct {
+				return &thrift.FieldTypeMismatch{StructName: "Optionals", FieldName: "Point", Type: ftype}
+			}
+			s.Point = &Point{}
+			if err := s.Point.DecodeThrift(r); err != nil {
+				return err
+			}
+		case 8:
+			if ftype != thrift.TypeList {
+				return &thrift.FieldTypeMismatch{StructName: "Optionals", FieldName: "Ints", Type: ftype}
+			}
+			var l1 []int32
+			et1, n1, err := r.ReadListBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && et1 != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Optionals", FieldName: "Ints", Type: et1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				e1, err := r.ReadI32()
+				if err != nil {
+					return err
+				}
+				l1 = append(l1, e1)
+			}
+			if err := r.ReadListEnd(); err != nil {
+				return err
+			}
+			s.Ints = l1
+		default:
+			if err := thrift.SkipValue(r, ftype); err != nil {
+				return err
+			}
+		}
+		if err := r.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := r.ReadStructEnd(); err != nil {
+		return err
+	}
+	return nil
+}
+
+type Containers struct {
+	Strings      []string            `thrift:"1,required" json:"strings"`
+	Points       []*Point            `thrift:"2,required" json:"points"`
+	Ints         map[int32]struct{}  `thrift:"3,required" json:"ints"`
+	Blobs        map[string]struct{} `thrift:"4,required" json:"blobs"`
+	PointsByName map[string]*Point   `thrift:"5,required" json:"pointsByName"`
+	Nested       map[int32][]string  `thrift:"6,required" json:"nested"`
+	Colors       [][]Color           `thrift:"7,required" json:"colors"`
+	Names        Names               `thrift:"8,required" json:"names"`
+	Counts       map[Name]Count      `thrift:"9,required" json:"counts"`
+	Bytes        []byte              `thrift:"10,required" json:"bytes"`
+}
+
+func (s *Containers) EncodeThrift(w thrift.ProtocolWriter) error {
+	if err := w.WriteStructBegin("Containers"); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Strings", thrift.TypeList, 1); err != nil {
+		return err
+	}
+	if err := w.WriteListBegin(thrift.TypeString, len(s.Strings)); err != nil {
+		return err
+	}
+	for _, e1 := range s.Strings {
+		if err := w.WriteString(e1); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteListEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Points", thrift.TypeList, 2); err != nil {
+		return err
+	}
+	if err := w.WriteListBegin(thrift.TypeStruct, len(s.Points)); err != nil {
+		return err
+	}
+	for _, e1 := range s.Points {
+		if err := e1.EncodeThrift(w); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteListEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Ints", thrift.TypeSet, 3); err != nil {
+		return err
+	}
+	if err := w.WriteSetBegin(thrift.TypeI32, len(s.Ints)); err != nil {
+		return err
+	}
+	for k1 := range s.Ints {
+		if err := w.WriteI32(k1); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteSetEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Blobs", thrift.TypeSet, 4); err != nil {
+		return err
+	}
+	if err := w.WriteSetBegin(thrift.TypeString, len(s.Blobs)); err != nil {
+		return err
+	}
+	for k1 := range s.Blobs {
+		if err := w.WriteString(k1); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteSetEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("PointsByName", thrift.TypeMap, 5); err != nil {
+		return err
+	}
+	if err := w.WriteMapBegin(thrift.TypeString, thrift.TypeStruct, len(s.PointsByName)); err != nil {
+		return err
+	}
+	for k1, v1 := range s.PointsByName {
+		if err := w.WriteString(k1); err != nil {
+			return err
+		}
+		if err := v1.EncodeThrift(w); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteMapEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Nested", thrift.TypeMap, 6); err != nil {
+		return err
+	}
+	if err := w.WriteMapBegin(thrift.TypeI32, thrift.TypeList, len(s.Nested)); err != nil {
+		return err
+	}
+	for k1, v1 := range s.Nested {
+		if err := w.WriteI32(k1); err != nil {
+			return err
+		}
+		if err := w.WriteListBegin(thrift.TypeString, len(v1)); err != nil {
+			return err
+		}
+		for _, e2 := range v1 {
+			if err := w.WriteString(e2); err != nil {
+				return err
+			}
+		}
+		if err := w.WriteListEnd(); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteMapEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Colors", thrift.TypeList, 7); err != nil {
+		return err
+	}
+	if err := w.WriteListBegin(thrift.TypeList, len(s.Colors)); err != nil {
+		return err
+	}
+	for _, e1 := range s.Colors {
+		if err := w.WriteListBegin(thrift.TypeI32, len(e1)); err != nil {
+			return err
+		}
+		for _, e2 := range e1 {
+			if err := w.WriteI32(int32(e2)); err != nil {
+				return err
+			}
+		}
+		if err := w.WriteListEnd(); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteListEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Names", thrift.TypeList, 8); err != nil {
+		return err
+	}
+	if err := w.WriteListBegin(thrift.TypeString, len([]string(s.Names))); err != nil {
+		return err
+	}
+	for _, e1 := range []string(s.Names) {
+		if err := w.WriteString(e1); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteListEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Counts", thrift.TypeMap, 9); err != nil {
+		return err
+	}
+	if err := w.WriteMapBegin(thrift.TypeString, thrift.TypeI32, len(s.Counts)); err != nil {
+		return err
+	}
+	for k1, v1 := range s.Counts {
+		if err := w.WriteString(string(k1)); err != nil {
+			return err
+		}
+		if err := w.WriteI32(int32(v1)); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteMapEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Bytes", thrift.TypeString, 10); err != nil {
+		return err
+	}
+	if err := w.WriteBytes(s.Bytes); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldStop(); err != nil {
+		return err
+	}
+	return w.WriteStructEnd()
+}
+
+func (s *Containers) DecodeThrift(r thrift.ProtocolReader) error {
+	if err := r.ReadStructBegin(); err != nil {
+		return err
+	}
+	var issetStrings, issetPoints, issetInts, issetBlobs, issetPointsByName, issetNested, issetColors, issetNames, issetCounts, issetBytes bool
+	for {
+		ftype, id, err := r.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if ftype == thrift.TypeStop {
+			break
+		}
+		switch id {
+		case 1:
+			if ftype != thrift.TypeList {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Strings", Type: ftype}
+			}
+			var l1 []string
+			et1, n1, err := r.ReadListBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && et1 != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Strings", Type: et1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				e1, err := r.ReadString()
+				if err != nil {
+					return err
+				}
+				l1 = append(l1, e1)
+			}
+			if err := r.ReadListEnd(); err != nil {
+				return err
+			}
+			s.Strings = l1
+			issetStrings = true
+		case 2:
+			if ftype != thrift.TypeList {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Points", Type: ftype}
+			}
+			var l1 []*Point
+			et1, n1, err := r.ReadListBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && et1 != thrift.TypeStruct {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Points", Type: et1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				e1 := &Point{}
+				if err := e1.DecodeThrift(r); err != nil {
+					return err
+				}
+				l1 = append(l1, e1)
+			}
+			if err := r.ReadListEnd(); err != nil {
+				return err
+			}
+			s.Points = l1
+			issetPoints = true
+		case 3:
+			if ftype != thrift.TypeSet {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Ints", Type: ftype}
+			}
+			m1 := make(map[int32]struct{})
+			et1, n1, err := r.ReadSetBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && et1 != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Ints", Type: et1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				k1, err := r.ReadI32()
+				if err != nil {
+					return err
+				}
+				m1[k1] = struct{}{}
+			}
+			if err := r.ReadSetEnd(); err != nil {
+				return err
+			}
+			s.Ints = m1
+			issetInts = true
+		case 4:
+			if ftype != thrift.TypeSet {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Blobs", Type: ftype}
+			}
+			m1 := make(map[string]struct{})
+			et1, n1, err := r.ReadSetBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && et1 != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Blobs", Type: et1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				k1, err := r.ReadString()
+				if err != nil {
+					return err
+				}
+				m1[k1] = struct{}{}
+			}
+			if err := r.ReadSetEnd(); err != nil {
+				return err
+			}
+			s.Blobs = m1
+			issetBlobs = true
+		case 5:
+			if ftype != thrift.TypeMap {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "PointsByName", Type: ftype}
+			}
+			m1 := make(map[string]*Point)
+			kt1, vt1, n1, err := r.ReadMapBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && kt1 != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "PointsByName", Type: kt1}
+			}
+			if n1 > 0 && vt1 != thrift.TypeStruct {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "PointsByName", Type: vt1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				k1, err := r.ReadString()
+				if err != nil {
+					return err
+				}
+				v1 := &Point{}
+				if err := v1.DecodeThrift(r); err != nil {
+					return err
+				}
+				m1[k1] = v1
+			}
+			if err := r.ReadMapEnd(); err != nil {
+				return err
+			}
+			s.PointsByName = m1
+			issetPointsByName = true
+		case 6:
+			if ftype != thrift.TypeMap {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Nested", Type: ftype}
+			}
+			m1 := make(map[int32][]string)
+			kt1, vt1, n1, err := r.ReadMapBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && kt1 != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Nested", Type: kt1}
+			}
+			if n1 > 0 && vt1 != thrift.TypeList {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Nested", Type: vt1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				k1, err := r.ReadI32()
+				if err != nil {
+					return err
+				}
+				var v1 []string
+				et2, n2, err := r.ReadListBegin()
+				if err != nil {
+					return err
+				}
+				if n2 > 0 && et2 != thrift.TypeString {
+					return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Nested", Type: et2}
+				}
+				for i2 := 0; i2 < n2; i2++ {
+					e2, err := r.ReadString()
+					if err != nil {
+						return err
+					}
+					v1 = append(v1, e2)
+				}
+				if err := r.ReadListEnd(); err != nil {
+					return err
+				}
+				m1[k1] = v1
+			}
+			if err := r.ReadMapEnd(); err != nil {
+				return err
+			}
+			s.Nested = m1
+			issetNested = true
+		case 7:
+			if ftype != thrift.TypeList {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Colors", Type: ftype}
+			}
+			var l1 [][]Color
+			et1, n1, err := r.ReadListBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && et1 != thrift.TypeList {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Colors", Type: et1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				var e1 []Color
+				et2, n2, err := r.ReadListBegin()
+				if err != nil {
+					return err
+				}
+				if n2 > 0 && et2 != thrift.TypeI32 {
+					return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Colors", Type: et2}
+				}
+				for i2 := 0; i2 < n2; i2++ {
+					var e2 Color
+					if v, err := r.ReadI32(); err != nil {
+						return err
+					} else {
+						e2 = Color(v)
+					}
+					e1 = append(e1, e2)
+				}
+				if err := r.ReadListEnd(); err != nil {
+					return err
+				}
+				l1 = append(l1, e1)
+			}
+			if err := r.ReadListEnd(); err != nil {
+				return err
+			}
+			s.Colors = l1
+			issetColors = true
+		case 8:
+			if ftype != thrift.TypeList {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Names", Type: ftype}
+			}
+			var l1 []string
+			et1, n1, err := r.ReadListBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && et1 != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Names", Type: et1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				e1, err := r.ReadString()
+				if err != nil {
+					return err
+				}
+				l1 = append(l1, e1)
+			}
+			if err := r.ReadListEnd(); err != nil {
+				return err
+			}
+			s.Names = Names(l1)
+			issetNames = true
+		case 9:
+			if ftype != thrift.TypeMap {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Counts", Type: ftype}
+			}
+			m1 := make(map[Name]Count)
+			kt1, vt1, n1, err := r.ReadMapBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && kt1 != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Counts", Type: kt1}
+			}
+			if n1 > 0 && vt1 != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Counts", Type: vt1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				var k1 Name
+				if v, err := r.ReadString(); err != nil {
+					return err
+				} else {
+					k1 = Name(v)
+				}
+				var v1 Count
+				if v, err := r.ReadI32(); err != nil {
+					return err
+				} else {
+					v1 = Count(v)
+				}
+				m1[k1] = v1
+			}
+			if err := r.ReadMapEnd(); err != nil {
+				return err
+			}
+			s.Counts = m1
+			issetCounts = true
+		case 10:
+			if ftype != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Containers", FieldName: "Bytes", Type: ftype}
+			}
+			if v, err := r.ReadBytes(); err != nil {
+				return err
+			} else {
+				s.Bytes = v
+			}
+			issetBytes = true
+		default:
+			if err := thrift.SkipValue(r, ftype); err != nil {
+				return err
+			}
+		}
+		if err := r.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := r.ReadStructEnd(); err != nil {
+		return err
+	}
+	if !issetStrings {
+		return &thrift.MissingRequiredField{StructName: "Containers", FieldName: "Strings"}
+	}
+	if !issetPoints {
+		return &thrift.MissingRequiredField{StructName: "Containers", FieldName: "Points"}
+	}
+	if !issetInts {
+		return &thrift.MissingRequiredField{StructName: "Containers", FieldName: "Ints"}
+	}
+	if !issetBlobs {
+		return &thrift.MissingRequiredField{StructName: "Containers", FieldName: "Blobs"}
+	}
+	if !issetPointsByName {
+		return &thrift.MissingRequiredField{StructName: "Containers", FieldName: "PointsByName"}
+	}
+	if !issetNested {
+		return &thrift.MissingRequiredField{StructName: "Containers", FieldName: "Nested"}
+	}
+	if !issetColors {
+		return &thrift.MissingRequiredField{StructName: "Containers", FieldName: "Colors"}
+	}
+	if !issetNames {
+		return &thrift.MissingRequiredField{StructName: "Containers", FieldName: "Names"}
+	}
+	if !issetCounts {
+		return &thrift.MissingRequiredField{StructName: "Containers", FieldName: "Counts"}
+	}
+	if !issetBytes {
+		return &thrift.MissingRequiredField{StructName: "Containers", FieldName: "Bytes"}
+	}
+	return nil
+}
+
+type Measure struct {
+	Unit        Unit            `thrift:"1,required" json:"unit"`
+	Fallback    *Unit           `thrift:"2" json:"fallback,omitempty"`
+	Conversions map[Unit][]Unit `thrift:"3,required" json:"conversions"`
+}
+
+func (s *Measure) EncodeThrift(w thrift.ProtocolWriter) error {
+	if err := w.WriteStructBegin("Measure"); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Unit", thrift.TypeString, 1); err != nil {
+		return err
+	}
+	if err := w.WriteString(string(s.Unit)); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if s.Fallback != nil {
+		if err := w.WriteFieldBegin("Fallback", thrift.TypeString, 2); err != nil {
+			return err
+		}
+		if err := w.WriteString(string(*s.Fallback)); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteFieldBegin("Conversions", thrift.TypeMap, 3); err != nil {
+		return err
+	}
+	if err := w.WriteMapBegin(thrift.TypeString, thrift.TypeList, len(s.Conversions)); err != nil {
+		return err
+	}
+	for k1, v1 := range s.Conversions {
+		if err := w.WriteString(string(k1)); err != nil {
+			return err
+		}
+		if err := w.WriteListBegin(thrift.TypeString, len(v1)); err != nil {
+			return err
+		}
+		for _, e2 := range v1 {
+			if err := w.WriteString(string(e2)); err != nil {
+				return err
+			}
+		}
+		if err := w.WriteListEnd(); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteMapEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldStop(); err != nil {
+		return err
+	}
+	return w.WriteStructEnd()
+}
+
+func (s *Measure) DecodeThrift(r thrift.ProtocolReader) error {
+	if err := r.ReadStructBegin(); err != nil {
+		return err
+	}
+	var issetUnit, issetConversions bool
+	for {
+		ftype, id, err := r.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if ftype == thrift.TypeStop {
+			break
+		}
+		switch id {
+		case 1:
+			if ftype != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Measure", FieldName: "Unit", Type: ftype}
+			}
+			if v, err := r.ReadString(); err != nil {
+				return err
+			} else {
+				s.Unit = Unit(v)
+			}
+			issetUnit = true
+		case 2:
+			if ftype != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Measure", FieldName: "Fallback", Type: ftype}
+			}
+			if v, err := r.ReadString(); err != nil {
+				return err
+			} else {
+				x := Unit(v)
+				s.Fallback = &x
+			}
+		case 3:
+			if ftype != thrift.TypeMap {
+				return &thrift.FieldTypeMismatch{StructName: "Measure", FieldName: "Conversions", Type: ftype}
+			}
+			m1 := make(map[Unit][]Unit)
+			kt1, vt1, n1, err := r.ReadMapBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && kt1 != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Measure", FieldName: "Conversions", Type: kt1}
+			}
+			if n1 > 0 && vt1 != thrift.TypeList {
+				return &thrift.FieldTypeMismatch{StructName: "Measure", FieldName: "Conversions", Type: vt1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				var k1 Unit
+				if v, err := r.ReadString(); err != nil {
+					return err
+				} else {
+					k1 = Unit(v)
+				}
+				var v1 []Unit
+				et2, n2, err := r.ReadListBegin()
+				if err != nil {
+					return err
+				}
+				if n2 > 0 && et2 != thrift.TypeString {
+					return &thrift.FieldTypeMismatch{StructName: "Measure", FieldName: "Conversions", Type: et2}
+				}
+				for i2 := 0; i2 < n2; i2++ {
+					var e2 Unit
+					if v, err := r.ReadString(); err != nil {
+						return err
+					} else {
+						e2 = Unit(v)
+					}
+					v1 = append(v1, e2)
+				}
+				if err := r.ReadListEnd(); err != nil {
+					return err
+				}
+				m1[k1] = v1
+			}
+			if err := r.ReadMapEnd(); err != nil {
+				return err
+			}
+			s.Conversions = m1
+			issetConversions = true
+		default:
+			if err := thrift.SkipValue(r, ftype); err != nil {
+				return err
+			}
+		}
+		if err := r.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := r.ReadStructEnd(); err != nil {
+		return err
+	}
+	if !issetUnit {
+		return &thrift.MissingRequiredField{StructName: "Measure", FieldName: "Unit"}
+	}
+	if !issetConversions {
+		return &thrift.MissingRequiredField{StructName: "Measure", FieldName: "Conversions"}
+	}
+	return nil
+}
+
+type Defaults struct {
+	Limit  int32   `thrift:"1,required" json:"limit"`
+	Name   *string `thrift:"2" json:"name,omitempty"`
+	Colors []Color `thrift:"3,required" json:"colors"`
+	Origin *Point  `thrift:"4,required" json:"origin"`
+	Corner *Point  `thrift:"5" json:"corner,omitempty"`
+}
+
+func NewDefaults() *Defaults {
+	s := &Defaults{}
+	s.SetDefaults()
+	return s
+}
+
+func (s *Defaults) SetDefaults() {
+	s.Limit = 10
+	s.Name = new(string)
+	*s.Name = "none"
+	s.Colors = []Color{ColorRed}
+	s.Origin = &Point{X: 0, Y: 0}
+}
+
+func (s *Defaults) EncodeThrift(w thrift.ProtocolWriter) error {
+	if err := w.WriteStructBegin("Defaults"); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Limit", thrift.TypeI32, 1); err != nil {
+		return err
+	}
+	if err := w.WriteI32(s.Limit); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if s.Name != nil {
+		if err := w.WriteFieldBegin("Name", thrift.TypeString, 2); err != nil {
+			return err
+		}
+		if err := w.WriteString(*s.Name); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteFieldBegin("Colors", thrift.TypeList, 3); err != nil {
+		return err
+	}
+	if err := w.WriteListBegin(thrift.TypeI32, len(s.Colors)); err != nil {
+		return err
+	}
+	for _, e1 := range s.Colors {
+		if err := w.WriteI32(int32(e1)); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteListEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if s.Origin == nil {
+		return &thrift.MissingRequiredField{StructName: "Defaults", FieldName: "Origin"}
+	}
+	if err := w.WriteFieldBegin("Origin", thrift.TypeStruct, 4); err != nil {
+		return err
+	}
+	if err := s.Origin.EncodeThrift(w); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if s.Corner != nil {
+		if err := w.WriteFieldBegin("Corner", thrift.TypeStruct, 5); err != nil {
+			return err
+		}
+		if err := s.Corner.EncodeThrift(w); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteFieldStop(); err != nil {
+		return err
+	}
+	return w.WriteStructEnd()
+}
+
+func (s *Defaults) DecodeThrift(r thrift.ProtocolReader) error {
+	s.SetDefaults()
+	if err := r.ReadStructBegin(); err != nil {
+		return err
+	}
+	var issetLimit, issetColors, issetOrigin bool
+	for {
+		ftype, id, err := r.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if ftype == thrift.TypeStop {
+			break
+		}
+		switch id {
+		case 1:
+			if ftype != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Defaults", FieldName: "Limit", Type: ftype}
+			}
+			if v, err := r.ReadI32(); err != nil {
+				return err
+			} else {
+				s.Limit = v
+			}
+			issetLimit = true
+		case 2:
+			if ftype != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Defaults", FieldName: "Name", Type: ftype}
+			}
+			if v, err := r.ReadString(); err != nil {
+				return err
+			} else {
+				s.Name = &v
+			}
+		case 3:
+			if ftype != thrift.TypeList {
+				return &thrift.FieldTypeMismatch{StructName: "Defaults", FieldName: "Colors", Type: ftype}
+			}
+			var l1 []Color
+			et1, n1, err := r.ReadListBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && et1 != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Defaults", FieldName: "Colors", Type: et1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				var e1 Color
+				if v, err := r.ReadI32(); err != nil {
+					return err
+				} else {
+					e1 = Color(v)
+				}
+				l1 = append(l1, e1)
+			}
+			if err := r.ReadListEnd(); err != nil {
+				return err
+			}
+			s.Colors = l1
+			issetColors = true
+		case 4:
+			if ftype != thrift.TypeStruct {
+				return &thrift.FieldTypeMismatch{StructName: "Defaults", FieldName: "Origin", Type: ftype}
+			}
+			s.Origin = &Point{}
+			if err := s.Origin.DecodeThrift(r); err != nil {
+				return err
+			}
+			issetOrigin = true
+		case 5:
+			if ftype != thrift.TypeStruct {
+				return &thrift.FieldTypeMismatch{StructName: "Defaults", FieldName: "Corner", Type: ftype}
+			}
+			s.Corner = &Point{}
+			if err := s.Corner.DecodeThrift(r); err != nil {
+				return err
+			}
+		default:
+			if err := thrift.SkipValue(r, ftype); err != nil {
+				return err
+			}
+		}
+		if err := r.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := r.ReadStructEnd(); err != nil {
+		return err
+	}
+	if !issetLimit {
+		return &thrift.MissingRequiredField{StructName: "Defaults", FieldName: "Limit"}
+	}
+	if !issetColors {
+		return &thrift.MissingRequiredField{StructName: "Defaults", FieldName: "Colors"}
+	}
+	if !issetOrigin {
+		return &thrift.MissingRequiredField{StructName: "Defaults", FieldName: "Origin"}
+	}
+	return nil
+}
+
+type Failure struct {
+	Message string `thrift:"1,required" json:"message"`
+	Code    *int32 `thrift:"2" json:"code,omitempty"`
+}
+
+func (s *Failure) EncodeThrift(w thrift.ProtocolWriter) error {
+	if err := w.WriteStructBegin("Failure"); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Message", thrift.TypeString, 1); err != nil {
+		return err
+	}
+	if err := w.WriteString(s.Message); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if s.Code != nil {
+		if err := w.WriteFieldBegin("Code", thrift.TypeI32, 2); err != nil {
+			return err
+		}
+		if err := w.WriteI32(*s.Code); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteFieldStop(); err != nil {
+		return err
+	}
+	return w.WriteStructEnd()
+}
+
+func (s *Failure) DecodeThrift(r thrift.ProtocolReader) error {
+	if err := r.ReadStructBegin(); err != nil {
+		return err
+	}
+	var issetMessage bool
+	for {
+		ftype, id, err := r.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if ftype == thrift.TypeStop {
+			break
+		}
+		switch id {
+		case 1:
+			if ftype != thrift.TypeString {
+				return &thrift.FieldTypeMismatch{StructName: "Failure", FieldName: "Message", Type: ftype}
+			}
+			if v, err := r.ReadString(); err != nil {
+				return err
+			} else {
+				s.Message = v
+			}
+			issetMessage = true
+		case 2:
+			if ftype != thrift.TypeI32 {
+				return &thrift.FieldTypeMismatch{StructName: "Failure", FieldName: "Code", Type: ftype}
+			}
+			if v, err := r.ReadI32(); err != nil {
+				return err
+			} else {
+				s.Code = &v
+			}
+		default:
+			if err := thrift.SkipValue(r, ftype); err != nil {
+				return err
+			}
+		}
+		if err := r.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := r.ReadStructEnd(); err != nil {
+		return err
+	}
+	if !issetMessage {
+		return &thrift.MissingRequiredField{StructName: "Failure", FieldName: "Message"}
+	}
+	return nil
+}
+
+func (e *Failure) Error() string {
+	return fmt.Sprintf("Failure{Message: %+v, Code: %+v}", e.Message, e.Code)
+}
+
+type Shape struct {
+	Point  *Point   `thrift:"1,union" json:"point,omitempty"`
+	Radius *float64 `thrift:"2,union" json:"radius,omitempty"`
+}
+
+const (
+	ShapeFieldPoint  = 1
+	ShapeFieldRadius = 2
+)
+
+// Which returns the ID of the field set in the union, or 0 if none is.
+func (s *Shape) Which() int {
+	switch {
+	case s.Point != nil:
+		return ShapeFieldPoint
+	case s.Radius != nil:
+		return ShapeFieldRadius
+	}
+	return 0
+}
+
+func (s *Shape) SetPoint(v *Point) {
+	*s = Shape{Point: v}
+}
+
+func (s *Shape) SetRadius(v float64) {
+	*s = Shape{Radius: &v}
+}
+
+func (s *Shape) EncodeThrift(w thrift.ProtocolWriter) error {
+	set := 0
+	if s.Point != nil {
+		set++
+	}
+	if s.Radius != nil {
+		set++
+	}
+	if set != 1 {
+		return &thrift.InvalidUnionError{StructName: "Shape", Fields: set}
+	}
+	if err := w.WriteStructBegin("Shape"); err != nil {
+		return err
+	}
+	if s.Point != nil {
+		if err := w.WriteFieldBegin("Point", thrift.TypeStruct, 1); err != nil {
+			return err
+		}
+		if err := s.Point.EncodeThrift(w); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if s.Radius != nil {
+		if err := w.WriteFieldBegin("Radius", thrift.TypeDouble, 2); err != nil {
+			return err
+		}
+		if err := w.WriteDouble(*s.Radius); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteFieldStop(); err != nil {
+		return err
+	}
+	return w.WriteStructEnd()
+}
+
+func (s *Shape) DecodeThrift(r thrift.ProtocolReader) error {
+	*s = Shape{}
+	set := 0
+	if err := r.ReadStructBegin(); err != nil {
+		return err
+	}
+	for {
+		ftype, id, err := r.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if ftype == thrift.TypeStop {
+			break
+		}
+		switch id {
+		case 1:
+			if ftype != thrift.TypeStruct {
+				return &thrift.FieldTypeMismatch{StructName: "Shape", FieldName: "Point", Type: ftype}
+			}
+			s.Point = &Point{}
+			if err := s.Point.DecodeThrift(r); err != nil {
+				return err
+			}
+			set++
+		case 2:
+			if ftype != thrift.TypeDouble {
+				return &thrift.FieldTypeMismatch{StructName: "Shape", FieldName: "Radius", Type: ftype}
+			}
+			if v, err := r.ReadDouble(); err != nil {
+				return err
+			} else {
+				s.Radius = &v
+			}
+			set++
+		default:
+			if err := thrift.SkipValue(r, ftype); err != nil {
+				return err
+			}
+		}
+		if err := r.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := r.ReadStructEnd(); err != nil {
+		return err
+	}
+	if set != 1 {
+		return &thrift.InvalidUnionError{StructName: "Shape", Fields: set}
+	}
+	return nil
+}
+
+type Geometry interface {
+	Area(shape *Shape) (float64, error)
+	Draw(shapes []*Shape) error
+}
+
+type GeometryServer struct {
+	Implementation Geometry
+}
+
+func (s *GeometryServer) Area(req *GeometryAreaRequest, res *GeometryAreaResponse) error {
+	val, err := s.Implementation.Area(req.Shape)
+	switch e := err.(type) {
+	case *Failure:
+		res.Failure = e
+		err = nil
+	}
+	res.Value = &val
+	return err
+}
+
+func (s *GeometryServer) Draw(req *GeometryDrawRequest, _ *struct{}) error {
+	err := s.Implementation.Draw(req.Shapes)
+	return err
+}
+
+func (s *GeometryServer) ProcessorMethods() map[string]thrift.ProcessorMethod {
+	m := make(map[string]thrift.ProcessorMethod, 2)
+	m["area"] = thrift.ProcessorMethod{
+		NewRequest:  func() interface{} { return &GeometryAreaRequest{} },
+		NewResponse: func() interface{} { return &GeometryAreaResponse{} },
+		Call: func(req, res interface{}) error {
+			return s.Area(req.(*GeometryAreaRequest), res.(*GeometryAreaResponse))
+		},
+	}
+	m["draw"] = thrift.ProcessorMethod{
+		NewRequest: func() interface{} { return &GeometryDrawRequest{} },
+		Call: func(req, res interface{}) error {
+			return s.Draw(req.(*GeometryDrawRequest), nil)
+		},
+	}
+	return m
+}
+
+type GeometryAreaRequest struct {
+	Shape *Shape `thrift:"1,required" json:"shape"`
+}
+
+func (s *GeometryAreaRequest) EncodeThrift(w thrift.ProtocolWriter) error {
+	if err := w.WriteStructBegin("GeometryAreaRequest"); err != nil {
+		return err
+	}
+	if s.Shape == nil {
+		return &thrift.MissingRequiredField{StructName: "GeometryAreaRequest", FieldName: "Shape"}
+	}
+	if err := w.WriteFieldBegin("Shape", thrift.TypeStruct, 1); err != nil {
+		return err
+	}
+	if err := s.Shape.EncodeThrift(w); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldStop(); err != nil {
+		return err
+	}
+	return w.WriteStructEnd()
+}
+
+func (s *GeometryAreaRequest) DecodeThrift(r thrift.ProtocolReader) error {
+	if err := r.ReadStructBegin(); err != nil {
+		return err
+	}
+	var issetShape bool
+	for {
+		ftype, id, err := r.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if ftype == thrift.TypeStop {
+			break
+		}
+		switch id {
+		case 1:
+			if ftype != thrift.TypeStruct {
+				return &thrift.FieldTypeMismatch{StructName: "GeometryAreaRequest", FieldName: "Shape", Type: ftype}
+			}
+			s.Shape = &Shape{}
+			if err := s.Shape.DecodeThrift(r); err != nil {
+				return err
+			}
+			issetShape = true
+		default:
+			if err := thrift.SkipValue(r, ftype); err != nil {
+				return err
+			}
+		}
+		if err := r.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := r.ReadStructEnd(); err != nil {
+		return err
+	}
+	if !issetShape {
+		return &thrift.MissingRequiredField{StructName: "GeometryAreaRequest", FieldName: "Shape"}
+	}
+	return nil
+}
+
+type GeometryAreaResponse struct {
+	Value   *float64 `thrift:"0" json:"value,omitempty"`
+	Failure *Failure `thrift:"1" json:"failure,omitempty"`
+}
+
+func (s *GeometryAreaResponse) EncodeThrift(w thrift.ProtocolWriter) error {
+	if err := w.WriteStructBegin("GeometryAreaResponse"); err != nil {
+		return err
+	}
+	if s.Value != nil {
+		if err := w.WriteFieldBegin("Value", thrift.TypeDouble, 0); err != nil {
+			return err
+		}
+		if err := w.WriteDouble(*s.Value); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if s.Failure != nil {
+		if err := w.WriteFieldBegin("Failure", thrift.TypeStruct, 1); err != nil {
+			return err
+		}
+		if err := s.Failure.EncodeThrift(w); err != nil {
+			return err
+		}
+		if err := w.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteFieldStop(); err != nil {
+		return err
+	}
+	return w.WriteStructEnd()
+}
+
+func (s *GeometryAreaResponse) DecodeThrift(r thrift.ProtocolReader) error {
+	if err := r.ReadStructBegin(); err != nil {
+		return err
+	}
+	for {
+		ftype, id, err := r.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if ftype == thrift.TypeStop {
+			break
+		}
+		switch id {
+		case 0:
+			if ftype != thrift.TypeDouble {
+				return &thrift.FieldTypeMismatch{StructName: "GeometryAreaResponse", FieldName: "Value", Type: ftype}
+			}
+			if v, err := r.ReadDouble(); err != nil {
+				return err
+			} else {
+				s.Value = &v
+			}
+		case 1:
+			if ftype != thrift.TypeStruct {
+				return &thrift.FieldTypeMismatch{StructName: "GeometryAreaResponse", FieldName: "Failure", Type: ftype}
+			}
+			s.Failure = &Failure{}
+			if err := s.Failure.DecodeThrift(r); err != nil {
+				return err
+			}
+		default:
+			if err := thrift.SkipValue(r, ftype); err != nil {
+				return err
+			}
+		}
+		if err := r.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := r.ReadStructEnd(); err != nil {
+		return err
+	}
+	return nil
+}
+
+type GeometryDrawRequest struct {
+	Shapes []*Shape `thrift:"1,required" json:"shapes"`
+}
+
+func (s *GeometryDrawRequest) EncodeThrift(w thrift.ProtocolWriter) error {
+	if err := w.WriteStructBegin("GeometryDrawRequest"); err != nil {
+		return err
+	}
+	if err := w.WriteFieldBegin("Shapes", thrift.TypeList, 1); err != nil {
+		return err
+	}
+	if err := w.WriteListBegin(thrift.TypeStruct, len(s.Shapes)); err != nil {
+		return err
+	}
+	for _, e1 := range s.Shapes {
+		if err := e1.EncodeThrift(w); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteListEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := w.WriteFieldStop(); err != nil {
+		return err
+	}
+	return w.WriteStructEnd()
+}
+
+func (s *GeometryDrawRequest) DecodeThrift(r thrift.ProtocolReader) error {
+	if err := r.ReadStructBegin(); err != nil {
+		return err
+	}
+	var issetShapes bool
+	for {
+		ftype, id, err := r.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if ftype == thrift.TypeStop {
+			break
+		}
+		switch id {
+		case 1:
+			if ftype != thrift.TypeList {
+				return &thrift.FieldTypeMismatch{StructName: "GeometryDrawRequest", FieldName: "Shapes", Type: ftype}
+			}
+			var l1 []*Shape
+			et1, n1, err := r.ReadListBegin()
+			if err != nil {
+				return err
+			}
+			if n1 > 0 && et1 != thrift.TypeStruct {
+				return &thrift.FieldTypeMismatch{StructName: "GeometryDrawRequest", FieldName: "Shapes", Type: et1}
+			}
+			for i1 := 0; i1 < n1; i1++ {
+				e1 := &Shape{}
+				if err := e1.DecodeThrift(r); err != nil {
+					return err
+				}
+				l1 = append(l1, e1)
+			}
+			if err := r.ReadListEnd(); err != nil {
+				return err
+			}
+			s.Shapes = l1
+			issetShapes = true
+		default:
+			if err := thrift.SkipValue(r, ftype); err != nil {
+				return err
+			}
+		}
+		if err := r.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := r.ReadStructEnd(); err != nil {
+		return err
+	}
+	if !issetShapes {
+		return &thrift.MissingRequiredField{StructName: "GeometryDrawRequest", FieldName: "Shapes"}
+	}
+	return nil
+}
+
+func (r *GeometryDrawRequest) Oneway() bool {
+	return true
+}
+
+type GeometryClient struct {
+	Client RPCClient
+}
+
+func (s *GeometryClient) Area(shape *Shape) (ret float64, err error) {
+	req := &GeometryAreaRequest{
+		Shape: shape,
+	}
+	res := &GeometryAreaResponse{}
+	err = s.Client.Call("area", req, res)
+	if err == nil {
+		switch {
+		case res.Failure != nil:
+			err = res.Failure
+		}
+	}
+	if err == nil && res.Value != nil {
+		ret = *res.Value
+	}
+	return
+}
+
+func (s *GeometryClient) Draw(shapes []*Shape) (err error) {
+	req := &GeometryDrawRequest{
+		Shapes: shapes,
+	}
+	var res interface{} = nil
+	err = s.Client.Call("draw", req, res)
+	return
+}
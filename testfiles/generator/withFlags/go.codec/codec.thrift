@@ -0,0 +1,89 @@
+namespace go gentest
+
+enum Color {
+	RED = 1,
+	GREEN = 2,
+}
+
+senum Unit {
+	CM,
+	INCH,
+}
+
+typedef binary Blob
+typedef string Name
+typedef i32 Count
+typedef list<string> Names
+
+struct Point {
+	1: i32 x,
+	2: i32 y,
+}
+
+struct Basics {
+	1: bool flag,
+	2: byte small,
+	3: i16 short,
+	4: i32 int,
+	5: i64 long,
+	6: double real,
+	7: string text,
+	8: binary data,
+	9: Color color,
+	10: Blob blob,
+	11: Name name,
+	12: Count count,
+}
+
+struct Optionals {
+	1: optional bool flag,
+	2: optional i64 long,
+	3: optional string text,
+	4: optional binary data,
+	5: optional Color color,
+	6: optional Count count,
+	7: optional Point point,
+	8: optional list<i32> ints,
+}
+
+struct Containers {
+	1: list<string> strings,
+	2: list<Point> points,
+	3: set<i32> ints,
+	4: set<binary> blobs,
+	5: map<string, Point> pointsByName,
+	6: map<i32, list<string>> nested,
+	7: list<list<Color>> colors,
+	8: Names names,
+	9: map<Name, Count> counts,
+	10: list<byte> bytes,
+}
+
+struct Measure {
+	1: Unit unit,
+	2: optional Unit fallback,
+	3: map<Unit, list<Unit>> conversions,
+}
+
+struct Defaults {
+	1: i32 limit = 10,
+	2: optional string name = "none",
+	3: list<Color> colors = [Color.RED],
+	4: Point origin = {"x": 0, "y": 0},
+	5: optional Point corner,
+}
+
+exception Failure {
+	1: string message,
+	2: optional i32 code,
+}
+
+union Shape {
+	1: Point point,
+	2: double radius,
+}
+
+service Geometry {
+	double area(1: Shape shape) throws (1: Failure failure),
+	oneway void draw(1: list<Shape> shapes),
+}
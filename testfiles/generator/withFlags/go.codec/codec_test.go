@@ -0,0 +1,294 @@
+package gentest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/ugodiggi/go-thrift/thrift"
+)
+
+// Types without the generated methods, which thrift.EncodeStruct and
+// thrift.DecodeStruct handle by reflection.
+type (
+	reflectBasics              Basics
+	reflectOptionals           Optionals
+	reflectContainers          Containers
+	reflectMeasure             Measure
+	reflectFailure             Failure
+	reflectShape               Shape
+	reflectGeometryAreaRequest GeometryAreaRequest
+	reflectGeometryAreaReply   GeometryAreaResponse
+)
+
+type codecTest struct {
+	name      string
+	value     interface{}
+	new       func() interface{}
+	reflected func(v interface{}) interface{} // v as a type without generated methods
+}
+
+func float64Ptr(v float64) *float64 { return &v }
+func int32Ptr(v int32) *int32       { return &v }
+
+// Maps and sets have at most one entry so that they're encoded the same
+// regardless of iteration order.
+var codecTests = []codecTest{
+	{
+		"Basics",
+		&Basics{
+			Flag: true, Small: 200, Short: -3, Int: 70000, Long: -5000000000, Real: 1.5,
+			Text: "text", Data: []byte{0, 1, 2}, Color: ColorGreen, Blob: Blob("blob"), Name: "name", Count: 7,
+		},
+		func() interface{} { return &Basics{} },
+		func(v interface{}) interface{} { return (*reflectBasics)(v.(*Basics)) },
+	},
+	{
+		"empty Optionals",
+		&Optionals{},
+		func() interface{} { return &Optionals{} },
+		func(v interface{}) interface{} { return (*reflectOptionals)(v.(*Optionals)) },
+	},
+	{
+		"Optionals",
+		func() *Optionals {
+			flag, long, text, color, count := false, int64(0), "", ColorRed, Count(0)
+			return &Optionals{
+				Flag: &flag, Long: &long, Text: &text, Data: []byte("d"), Color: &color, Count: &count,
+				Point: &Point{1, 2}, Ints: []int32{1, 2, 3},
+			}
+		}(),
+		func() interface{} { return &Optionals{} },
+		func(v interface{}) interface{} { return (*reflectOptionals)(v.(*Optionals)) },
+	},
+	{
+		"Containers",
+		&Containers{
+			Strings:      []string{"a", "b"},
+			Points:       []*Point{{1, 2}, {3, 4}},
+			Ints:         map[int32]struct{}{5: {}},
+			Blobs:        map[string]struct{}{"blob": {}},
+			PointsByName: map[string]*Point{"origin": {}},
+			Nested:       map[int32][]string{1: {"x", "y"}},
+			Colors:       [][]Color{{ColorRed, ColorGreen}, nil},
+			Names:        Names{"n"},
+			Counts:       map[Name]Count{"c": 9},
+			Bytes:        []byte("bytes"),
+		},
+		func() interface{} { return &Containers{} },
+		func(v interface{}) interface{} { return (*reflectContainers)(v.(*Containers)) },
+	},
+	{
+		"Measure",
+		func() *Measure {
+			fallback := UnitInch
+			return &Measure{Unit: UnitCm, Fallback: &fallback, Conversions: map[Unit][]Unit{UnitCm: {UnitInch}}}
+		}(),
+		func() interface{} { return &Measure{} },
+		func(v interface{}) interface{} { return (*reflectMeasure)(v.(*Measure)) },
+	},
+	{
+		"Failure",
+		&Failure{Message: "failed", Code: int32Ptr(500)},
+		func() interface{} { return &Failure{} },
+		func(v interface{}) interface{} { return (*reflectFailure)(v.(*Failure)) },
+	},
+	{
+		"Shape",
+		&Shape{Radius: float64Ptr(2)},
+		func() interface{} { return &Shape{} },
+		func(v interface{}) interface{} { return (*reflectShape)(v.(*Shape)) },
+	},
+	{
+		"GeometryAreaRequest",
+		&GeometryAreaRequest{Shape: &Shape{Point: &Point{3, 4}}},
+		func() interface{} { return &GeometryAreaRequest{} },
+		func(v interface{}) interface{} { return (*reflectGeometryAreaRequest)(v.(*GeometryAreaRequest)) },
+	},
+	{
+		"GeometryAreaResponse",
+		&GeometryAreaResponse{Value: float64Ptr(12.5)},
+		func() interface{} { return &GeometryAreaResponse{} },
+		func(v interface{}) interface{} { return (*reflectGeometryAreaReply)(v.(*GeometryAreaResponse)) },
+	},
+}
+
+var codecProtocols = map[string]thrift.ProtocolBuilder{
+	"binary":  thrift.BinaryProtocol,
+	"compact": thrift.CompactProtocol,
+}
+
+func TestCodecMatchesReflection(t *testing.T) {
+	for pname, protocol := range codecProtocols {
+		for _, test := range codecTests {
+			generated := &bytes.Buffer{}
+			if err := thrift.EncodeStruct(protocol.NewProtocolWriter(generated), test.value); err != nil {
+				t.Fatalf("%s %s: %s", pname, test.name, err)
+			}
+			reflected := &bytes.Buffer{}
+			if err := thrift.EncodeStruct(protocol.NewProtocolWriter(reflected), test.reflected(test.value)); err != nil {
+				t.Fatalf("%s %s: %s", pname, test.name, err)
+			}
+			if !bytes.Equal(generated.Bytes(), reflected.Bytes()) {
+				t.Fatalf("%s %s: generated encoder wrote\n%v\ninstead of\n%v", pname, test.name, generated.Bytes(), reflected.Bytes())
+			}
+
+			decoded := test.new()
+			if err := thrift.DecodeStruct(protocol.NewProtocolReader(bytes.NewReader(generated.Bytes())), decoded); err != nil {
+				t.Fatalf("%s %s: %s", pname, test.name, err)
+			}
+			decodedReflected := test.new()
+			if err := thrift.DecodeStruct(protocol.NewProtocolReader(generated), test.reflected(decodedReflected)); err != nil {
+				t.Fatalf("%s %s: %s", pname, test.name, err)
+			}
+			if !reflect.DeepEqual(decoded, decodedReflected) {
+				t.Fatalf("%s %s: generated decoder read\n%+v\ninstead of\n%+v", pname, test.name, decoded, decodedReflected)
+			}
+			if !reflect.DeepEqual(decoded, test.value) {
+				t.Fatalf("%s %s: decoded\n%+v\ninstead of\n%+v", pname, test.name, decoded, test.value)
+			}
+		}
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	err := thrift.EncodeStruct(thrift.BinaryProtocol.NewProtocolWriter(&bytes.Buffer{}), &GeometryAreaRequest{})
+	if e, ok := err.(*thrift.MissingRequiredField); !ok || e.StructName != "GeometryAreaRequest" || e.FieldName != "Shape" {
+		t.Fatalf("Expected a missing required field error, got %+v", err)
+	}
+
+	// A Point whose x is a string.
+	buf := &bytes.Buffer{}
+	w := thrift.BinaryProtocol.NewProtocolWriter(buf)
+	w.WriteStructBegin("Point")
+	w.WriteFieldBegin("X", thrift.TypeString, 1)
+	w.WriteString("1")
+	w.WriteFieldEnd()
+	w.WriteFieldStop()
+	w.WriteStructEnd()
+	err = thrift.DecodeStruct(thrift.BinaryProtocol.NewProtocolReader(bytes.NewReader(buf.Bytes())), &Point{})
+	if e, ok := err.(*thrift.FieldTypeMismatch); !ok || e.FieldName != "X" || e.Type != thrift.TypeString {
+		t.Fatalf("Expected a type mismatch error, got %+v", err)
+	}
+
+	// A Point without y.
+	buf.Reset()
+	w.WriteStructBegin("Point")
+	w.WriteFieldBegin("X", thrift.TypeI32, 1)
+	w.WriteI32(1)
+	w.WriteFieldEnd()
+	w.WriteFieldStop()
+	w.WriteStructEnd()
+	err = thrift.DecodeStruct(thrift.BinaryProtocol.NewProtocolReader(buf), &Point{})
+	if e, ok := err.(*thrift.MissingRequiredField); !ok || e.StructName != "Point" || e.FieldName != "Y" {
+		t.Fatalf("Expected a missing required field error, got %+v", err)
+	}
+}
+
+func TestCodecUnion(t *testing.T) {
+	for _, shape := range []*Shape{{}, {Point: &Point{}, Radius: float64Ptr(1)}} {
+		for _, v := range []interface{}{shape, (*reflectShape)(shape)} {
+			err := thrift.EncodeStruct(thrift.BinaryProtocol.NewProtocolWriter(&bytes.Buffer{}), v)
+			if _, ok := err.(*thrift.InvalidUnionError); !ok {
+				t.Fatalf("Expected an invalid union error for %T %+v, got %+v", v, shape, err)
+			}
+		}
+	}
+
+	shape := &Shape{}
+	if shape.Which() != 0 {
+		t.Fatalf("Expected no field set, got %d", shape.Which())
+	}
+	shape.SetPoint(&Point{1, 2})
+	shape.SetRadius(3)
+	if shape.Which() != ShapeFieldRadius || shape.Point != nil || *shape.Radius != 3 {
+		t.Fatalf("Expected only the radius to be set, got %+v", shape)
+	}
+
+	// A Shape with both fields.
+	buf := &bytes.Buffer{}
+	w := thrift.BinaryProtocol.NewProtocolWriter(buf)
+	w.WriteStructBegin("Shape")
+	w.WriteFieldBegin("Radius", thrift.TypeDouble, 2)
+	w.WriteDouble(1)
+	w.WriteFieldEnd()
+	w.WriteFieldBegin("Radius", thrift.TypeDouble, 2)
+	w.WriteDouble(2)
+	w.WriteFieldEnd()
+	w.WriteFieldStop()
+	w.WriteStructEnd()
+	data := buf.Bytes()
+	for _, v := range []interface{}{&Shape{}, &reflectShape{}} {
+		err := thrift.DecodeStruct(thrift.BinaryProtocol.NewProtocolReader(bytes.NewReader(data)), v)
+		if e, ok := err.(*thrift.InvalidUnionError); !ok || e.Fields != 2 {
+			t.Fatalf("Expected an invalid union error for %T, got %+v", v, err)
+		}
+	}
+}
+
+func TestCodecDefaults(t *testing.T) {
+	buf := &bytes.Buffer{}
+	value := &Defaults{Limit: 1, Colors: []Color{ColorGreen}, Origin: &Point{1, 2}}
+	if err := thrift.EncodeStruct(thrift.BinaryProtocol.NewProtocolWriter(buf), value); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Defaults{}
+	if err := thrift.DecodeStruct(thrift.BinaryProtocol.NewProtocolReader(buf), decoded); err != nil {
+		t.Fatal(err)
+	}
+	name := "none"
+	expected := &Defaults{Limit: 1, Name: &name, Colors: []Color{ColorGreen}, Origin: &Point{1, 2}}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("Expected %+v instead %+v", expected, decoded)
+	}
+
+	expected = &Defaults{Limit: 10, Name: &name, Colors: []Color{ColorRed}, Origin: &Point{}}
+	if d := NewDefaults(); !reflect.DeepEqual(d, expected) {
+		t.Fatalf("Expected %+v instead %+v", expected, d)
+	}
+}
+
+func benchmarkEncode(b *testing.B, v interface{}) {
+	buf := &bytes.Buffer{}
+	w := thrift.BinaryProtocol.NewProtocolWriter(buf)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := thrift.EncodeStruct(w, v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDecode(b *testing.B, v interface{}, newValue func() interface{}) {
+	buf := &bytes.Buffer{}
+	if err := thrift.EncodeStruct(thrift.BinaryProtocol.NewProtocolWriter(buf), v); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+	rd := bytes.NewReader(data)
+	r := thrift.BinaryProtocol.NewProtocolReader(rd)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rd.Reset(data)
+		if err := thrift.DecodeStruct(r, newValue()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeGenerated(b *testing.B) {
+	benchmarkEncode(b, codecTests[3].value)
+}
+
+func BenchmarkEncodeReflection(b *testing.B) {
+	benchmarkEncode(b, (*reflectContainers)(codecTests[3].value.(*Containers)))
+}
+
+func BenchmarkDecodeGenerated(b *testing.B) {
+	benchmarkDecode(b, codecTests[3].value, func() interface{} { return &Containers{} })
+}
+
+func BenchmarkDecodeReflection(b *testing.B) {
+	benchmarkDecode(b, codecTests[3].value, func() interface{} { return &reflectContainers{} })
+}
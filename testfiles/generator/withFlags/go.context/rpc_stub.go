@@ -0,0 +1,11 @@
+package gentest
+
+import "context"
+
+type RPCClient interface {
+	Call(method string, request interface{}, response interface{}) error
+}
+
+type ContextRPCClient interface {
+	CallContext(ctx context.Context, method string, request interface{}, response interface{}) error
+}
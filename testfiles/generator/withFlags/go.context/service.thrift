@@ -0,0 +1,11 @@
+namespace go gentest
+
+exception NotFound {
+	1: string message
+}
+
+service Store {
+	string get(1: string key) throws (1: NotFound notFound),
+	void put(1: string key, 2: string value),
+	oneway void ping()
+}
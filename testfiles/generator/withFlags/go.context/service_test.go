@@ -0,0 +1,71 @@
+package gentest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ugodiggi/go-thrift/thrift"
+)
+
+// headerStore answers Get with the "key" request header of the call and
+// sends the key back as the "key" response header.
+type headerStore struct{}
+
+func (headerStore) Get(ctx context.Context, key string) (string, error) {
+	if key == "missing" {
+		return "", &NotFound{Message: key}
+	}
+	thrift.SetResponseHeader(ctx, "key", key)
+	return thrift.RequestHeaders(ctx)["key"], nil
+}
+
+func (headerStore) Put(ctx context.Context, key string, value string) error {
+	return nil
+}
+
+func (headerStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func TestServiceContext(t *testing.T) {
+	srv := &thrift.Server{
+		Processor: &StoreServer{Implementation: headerStore{}},
+		NewTransport: func(conn net.Conn) thrift.Transport {
+			return thrift.NewHeaderTransport(conn, 0)
+		},
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := thrift.NewNativeClient(thrift.NewHeaderTransport(conn, 0), false)
+	defer c.Close()
+	var store Store = &StoreClient{Client: c}
+
+	headers := make(map[string]string)
+	ctx := thrift.WithRequestHeaders(context.Background(), map[string]string{"key": "value"})
+	ctx = thrift.WithResponseHeaders(ctx, headers)
+	v, err := store.Get(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "value" {
+		t.Fatalf("Expected the request header as value, got %q", v)
+	}
+	if headers["key"] != "k" {
+		t.Fatalf("Expected the response header, got %q", headers["key"])
+	}
+	if _, err := store.Get(context.Background(), "missing"); err == nil {
+		t.Fatal("Expected NotFound")
+	} else if _, ok := err.(*NotFound); !ok {
+		t.Fatalf("Expected NotFound, got %+v", err)
+	}
+}
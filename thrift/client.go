@@ -5,43 +5,72 @@
 package thrift
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net"
-	"net/rpc"
+	"sync"
 )
 
-// Implements rpc.ClientCodec
-type clientCodec struct {
-	conn           Transport
-	onewayRequests chan pendingRequest
-	twowayRequests chan pendingRequest
-	enableOneway   bool
-}
-
-type pendingRequest struct {
-	method string
-	seq    uint64
-}
-
 type oneway interface {
 	Oneway() bool
 }
 
 var (
-	// ErrTooManyPendingRequests is the error when there's too many requests that have been
-	// sent that have not yet received responses.
-	ErrTooManyPendingRequests = errors.New("thrift.client: too many pending requests")
 	// ErrOnewayNotEnabled is the error when trying to make a one-way RPC call but the
 	// client was not created with one-way support enabled.
 	ErrOnewayNotEnabled = errors.New("thrift.client: one way support not enabled on codec")
+	// ErrShutdown is the error returned by calls on a client whose connection
+	// has been closed.
+	ErrShutdown = errors.New("thrift.client: connection is shut down")
 )
 
-const maxPendingRequests = 1000
+// Client is a Thrift RPC client. It assigns the sequence IDs of the messages it
+// sends and matches replies to calls by sequence ID, so it may be used by
+// multiple goroutines simultaneously. Client implements the RPCClient and
+// ContextRPCClient interfaces of generated code.
+type Client struct {
+	conn         Transport
+	enableOneway bool
+
+	sending sync.Mutex // serializes writing requests to conn
+
+	mu       sync.Mutex // protects following
+	seq      int32
+	pending  map[int32]*clientCall
+	closing  bool // user has called Close
+	shutdown bool // connection is gone, either closed or broken
+
+	done chan struct{} // closed once the connection is gone
+}
+
+type clientCall struct {
+	response interface{}
+	headers  map[string]string // of the response
+	err      error
+	done     chan struct{}
+}
+
+// DialClient connects to a Thrift RPC server at the specified network address
+// using the specified protocol.
+func DialClient(network, address string, framed bool, protocol ProtocolBuilder, supportOnewayRequests bool) (*Client, error) {
+	return DialClientContext(context.Background(), network, address, framed, protocol, supportOnewayRequests)
+}
 
-// Dial connects to a Thrift RPC server at the specified network address using the specified protocol.
-func Dial(network, address string, framed bool, protocol ProtocolBuilder, supportOnewayRequests bool) (*rpc.Client, error) {
-	conn, err := net.Dial(network, address)
+// DialClientContext connects to a Thrift RPC server at the specified network
+// address using the specified protocol. The context only bounds the time taken
+// to connect.
+func DialClientContext(ctx context.Context, network, address string, framed bool, protocol ProtocolBuilder, supportOnewayRequests bool) (*Client, error) {
+	conn, err := dialTransport(ctx, network, address, framed, protocol)
+	if err != nil {
+		return nil, err
+	}
+	return NewNativeClient(conn, supportOnewayRequests), nil
+}
+
+func dialTransport(ctx context.Context, network, address string, framed bool, protocol ProtocolBuilder) (Transport, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
 	if err != nil {
 		return nil, err
 	}
@@ -49,123 +78,210 @@ func Dial(network, address string, framed bool, protocol ProtocolBuilder, suppor
 	if framed {
 		c = NewFramedReadWriteCloser(conn, DefaultMaxFrameSize)
 	}
-	codec := &clientCodec{
-		conn: NewTransport(c, protocol),
-	}
-	if supportOnewayRequests {
-		codec.enableOneway = true
-		codec.onewayRequests = make(chan pendingRequest, maxPendingRequests)
-		codec.twowayRequests = make(chan pendingRequest, maxPendingRequests)
-	}
-	return rpc.NewClientWithCodec(codec), nil
-}
-
-// NewClient returns a new rpc.Client to handle requests to the set of
-// services at the other end of the connection.
-func NewClient(conn Transport, supportOnewayRequests bool) *rpc.Client {
-	return rpc.NewClientWithCodec(NewClientCodec(conn, supportOnewayRequests))
+	return NewTransport(c, protocol), nil
 }
 
-// NewClientCodec returns a new rpc.ClientCodec using Thrift RPC on conn using the specified protocol.
-func NewClientCodec(conn Transport, supportOnewayRequests bool) rpc.ClientCodec {
-	c := &clientCodec{
-		conn: conn,
-	}
-	if supportOnewayRequests {
-		c.enableOneway = true
-		c.onewayRequests = make(chan pendingRequest, maxPendingRequests)
-		c.twowayRequests = make(chan pendingRequest, maxPendingRequests)
+// NewNativeClient returns a new Client to handle requests to the set of
+// services at the other end of the connection. One-way requests, those
+// whose request struct reports Oneway() == true, are rejected with
+// ErrOnewayNotEnabled unless supportOnewayRequests is set.
+func NewNativeClient(conn Transport, supportOnewayRequests bool) *Client {
+	c := &Client{
+		conn:         conn,
+		enableOneway: supportOnewayRequests,
+		pending:      make(map[int32]*clientCall),
+		done:         make(chan struct{}),
 	}
+	go c.input()
 	return c
 }
 
-func (c *clientCodec) WriteRequest(request *rpc.Request, thriftStruct interface{}) error {
-	if err := c.conn.WriteMessageBegin(request.ServiceMethod, MessageTypeCall, int32(request.Seq)); err != nil {
-		return err
-	}
-	if err := EncodeStruct(c.conn, thriftStruct); err != nil {
-		return err
-	}
-	if err := c.conn.WriteMessageEnd(); err != nil {
-		return err
-	}
-	if err := c.conn.Flush(); err != nil {
+// Call invokes the named function, waits for it to complete, and returns its error status.
+// A response of nil discards the result. Server side failures are returned as an
+// *ApplicationException. Failing to write the request, including failing to encode
+// it, closes the connection since a partial message may have been sent.
+func (c *Client) Call(method string, request interface{}, response interface{}) error {
+	return c.CallContext(context.Background(), method, request, response)
+}
+
+// CallContext is like Call but gives up waiting for the response when ctx is
+// done, in which case ctx.Err() is returned. The response to an abandoned
+// call is discarded when it arrives, so the connection remains usable.
+func (c *Client) CallContext(ctx context.Context, method string, request interface{}, response interface{}) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
+
 	ow := false
-	if o, ok := thriftStruct.(oneway); ok {
+	if o, ok := request.(oneway); ok {
 		ow = o.Oneway()
 	}
-	if c.enableOneway {
-		var err error
-		if ow {
-			select {
-			case c.onewayRequests <- pendingRequest{request.ServiceMethod, request.Seq}:
-			default:
-				err = ErrTooManyPendingRequests
-			}
-		} else {
-			select {
-			case c.twowayRequests <- pendingRequest{request.ServiceMethod, request.Seq}:
-			default:
-				err = ErrTooManyPendingRequests
-			}
-		}
-		if err != nil {
-			return err
-		}
-	} else if ow {
+	if ow && !c.enableOneway {
 		return ErrOnewayNotEnabled
 	}
 
-	return nil
-}
+	c.mu.Lock()
+	if c.closing || c.shutdown {
+		c.mu.Unlock()
+		return ErrShutdown
+	}
+	c.seq++
+	seq := c.seq
+	var call *clientCall
+	if !ow {
+		call = &clientCall{response: response, done: make(chan struct{})}
+		c.pending[seq] = call
+	}
+	c.mu.Unlock()
 
-func (c *clientCodec) ReadResponseHeader(response *rpc.Response) error {
-	if c.enableOneway {
-		select {
-		case ow := <-c.onewayRequests:
-			response.ServiceMethod = ow.method
-			response.Seq = ow.seq
-			return nil
-		case _ = <-c.twowayRequests:
+	headers, _ := ctx.Value(requestHeadersKey{}).(map[string]string)
+	if err := c.send(method, ow, seq, request, headers); err != nil {
+		if call != nil {
+			c.mu.Lock()
+			delete(c.pending, seq)
+			c.mu.Unlock()
 		}
+		return err
+	}
+	if ow {
+		return nil
 	}
 
-	name, messageType, seq, err := c.conn.ReadMessageBegin()
-	if err != nil {
-		return err
+	select {
+	case <-call.done:
+		return call.result(ctx)
+	case <-ctx.Done():
 	}
-	response.ServiceMethod = name
-	response.Seq = uint64(seq)
-	if messageType == MessageTypeException {
-		exception := &ApplicationException{}
-		if err := DecodeStruct(c.conn, exception); err != nil {
-			return err
+	c.mu.Lock()
+	_, ok := c.pending[seq]
+	delete(c.pending, seq)
+	c.mu.Unlock()
+	if !ok {
+		// The response is already being read, wait for it rather than
+		// letting it be written to response after returning.
+		<-call.done
+		return call.result(ctx)
+	}
+	return ctx.Err()
+}
+
+// responseHeadersMu serializes writing response headers to the maps given
+// to WithResponseHeaders, which may be shared by concurrent calls.
+var responseHeadersMu sync.Mutex
+
+// result hands the headers of the response over to ctx, if it asks for them
+// with WithResponseHeaders, and returns the error of the call. It runs on
+// the goroutine of the caller once the call is done.
+func (call *clientCall) result(ctx context.Context) error {
+	if headers, ok := ctx.Value(responseHeadersKey{}).(map[string]string); ok && len(call.headers) > 0 {
+		responseHeadersMu.Lock()
+		for k, v := range call.headers {
+			headers[k] = v
 		}
-		response.Error = exception.String()
-		return c.conn.ReadMessageEnd()
+		responseHeadersMu.Unlock()
 	}
-	return nil
+	return call.err
 }
 
-func (c *clientCodec) ReadResponseBody(thriftStruct interface{}) error {
-	if thriftStruct == nil {
-		// Should only get called if ReadResponseHeader set the Error value in
-		// which case we've already read the body (ApplicationException)
-		return nil
+func (c *Client) send(method string, ow bool, seq int32, request interface{}, headers map[string]string) error {
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	writeNext(c.conn, nil, headers)
+
+	mtype := byte(MessageTypeCall)
+	if ow {
+		mtype = MessageTypeOneway
+	}
+	err := c.conn.WriteMessageBegin(method, mtype, seq)
+	if err == nil {
+		err = EncodeStruct(c.conn, request)
+	}
+	if err == nil {
+		err = c.conn.WriteMessageEnd()
 	}
+	if err == nil {
+		err = c.conn.Flush()
+	}
+	if err != nil {
+		// Part of the message may already be buffered or sent, so the
+		// stream can't be trusted anymore.
+		c.conn.Close()
+	}
+	return err
+}
 
-	if err := DecodeStruct(c.conn, thriftStruct); err != nil {
-		return err
+// input reads responses from the connection and hands them over to the
+// pending calls until the connection fails.
+func (c *Client) input() {
+	var err error
+	for err == nil {
+		var mtype byte
+		var seq int32
+		_, mtype, seq, err = c.conn.ReadMessageBegin()
+		if err != nil {
+			break
+		}
+		c.mu.Lock()
+		call := c.pending[seq]
+		delete(c.pending, seq)
+		c.mu.Unlock()
+		if call != nil {
+			if msg := readMessage(c.conn); msg != nil {
+				call.headers = msg.headers
+			}
+		}
+
+		switch {
+		case call == nil:
+			// Response to an abandoned call.
+			err = SkipValue(c.conn, TypeStruct)
+		case mtype == MessageTypeException:
+			exc := &ApplicationException{}
+			if err = DecodeStruct(c.conn, exc); err == nil {
+				call.err = exc
+			}
+		case call.response == nil:
+			err = SkipValue(c.conn, TypeStruct)
+		default:
+			err = DecodeStruct(c.conn, call.response)
+			call.err = err
+		}
+		if err == nil {
+			err = c.conn.ReadMessageEnd()
+		}
+		if call != nil {
+			if err != nil && call.err == nil {
+				call.err = err
+			}
+			close(call.done)
+		}
 	}
 
-	return c.conn.ReadMessageEnd()
+	// The stream can't be trusted after a failed read, so don't leave the
+	// connection open. It may already be closed by Close.
+	c.conn.Close()
+	c.mu.Lock()
+	c.shutdown = true
+	if c.closing || err == io.EOF {
+		err = ErrShutdown
+	}
+	for seq, call := range c.pending {
+		delete(c.pending, seq)
+		call.err = err
+		close(call.done)
+	}
+	c.mu.Unlock()
+	close(c.done)
 }
 
-func (c *clientCodec) Close() error {
-	if cl, ok := c.conn.(io.Closer); ok {
-		return cl.Close()
+// Close closes the connection. Pending calls fail with ErrShutdown.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		return ErrShutdown
 	}
-	return nil
+	c.closing = true
+	c.mu.Unlock()
+	return c.conn.Close()
 }
@@ -0,0 +1,215 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/rpc"
+)
+
+// Implements rpc.ClientCodec
+type clientCodec struct {
+	conn           Transport
+	onewayRequests chan pendingRequest
+	twowayRequests chan pendingRequest
+	enableOneway   bool
+}
+
+type pendingRequest struct {
+	method string
+	seq    uint64
+}
+
+var (
+	// ErrTooManyPendingRequests is the error when there's too many requests that have been
+	// sent that have not yet received responses.
+	ErrTooManyPendingRequests = errors.New("thrift.client: too many pending requests")
+)
+
+const maxPendingRequests = 1000
+
+// Dial connects to a Thrift RPC server at the specified network address using
+// the specified protocol, and returns a net/rpc client for it. DialClient
+// returns a native Client instead.
+func Dial(network, address string, framed bool, protocol ProtocolBuilder, supportOnewayRequests bool) (*rpc.Client, error) {
+	conn, err := dialTransport(context.Background(), network, address, framed, protocol)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn, supportOnewayRequests), nil
+}
+
+// NewClient returns a new rpc.Client to handle requests to the set of
+// services at the other end of the connection. NewNativeClient returns a
+// native Client instead.
+func NewClient(conn Transport, supportOnewayRequests bool) *rpc.Client {
+	return rpc.NewClientWithCodec(NewClientCodec(conn, supportOnewayRequests))
+}
+
+// ContextClient is a net/rpc based client whose calls honour context deadlines
+// and cancellation. It implements both the RPCClient and the ContextRPCClient
+// interfaces of generated code.
+//
+// net/rpc has no way to abandon a single pending call, so when the context of
+// a call is done before its response arrives the connection is torn down: the
+// call fails with the context's error and all later calls fail with
+// rpc.ErrShutdown. A new client has to be created in that case.
+type ContextClient struct {
+	*rpc.Client
+}
+
+// DialContext connects to a Thrift RPC server at the specified network address using
+// the specified protocol. The context only bounds the time taken to connect.
+// DialClientContext returns a native Client instead.
+func DialContext(ctx context.Context, network, address string, framed bool, protocol ProtocolBuilder, supportOnewayRequests bool) (*ContextClient, error) {
+	conn, err := dialTransport(ctx, network, address, framed, protocol)
+	if err != nil {
+		return nil, err
+	}
+	return NewContextClient(conn, supportOnewayRequests), nil
+}
+
+// NewContextClient returns a new ContextClient to handle requests to the set of
+// services at the other end of the connection. NewNativeClient returns a
+// native Client instead, which keeps the connection when a call is abandoned.
+func NewContextClient(conn Transport, supportOnewayRequests bool) *ContextClient {
+	return &ContextClient{NewClient(conn, supportOnewayRequests)}
+}
+
+// CallContext invokes the named function, waits for it to complete, and returns
+// its error status. If ctx is done first the connection is closed and ctx.Err()
+// is returned.
+func (c *ContextClient) CallContext(ctx context.Context, method string, request interface{}, response interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	call := c.Go(method, request, response, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-ctx.Done():
+	}
+	// The response could still arrive and be decoded into response after
+	// returning, so the only safe option is to shut down the connection and
+	// wait for the call to be failed by the client.
+	c.Close()
+	<-call.Done
+	if call.Error == nil {
+		// The response made it before the connection was closed.
+		return nil
+	}
+	return ctx.Err()
+}
+
+// NewClientCodec returns a new rpc.ClientCodec using Thrift RPC on conn using the specified protocol.
+func NewClientCodec(conn Transport, supportOnewayRequests bool) rpc.ClientCodec {
+	c := &clientCodec{
+		conn: conn,
+	}
+	if supportOnewayRequests {
+		c.enableOneway = true
+		c.onewayRequests = make(chan pendingRequest, maxPendingRequests)
+		c.twowayRequests = make(chan pendingRequest, maxPendingRequests)
+	}
+	return c
+}
+
+func (c *clientCodec) WriteRequest(request *rpc.Request, thriftStruct interface{}) error {
+	ow := false
+	if o, ok := thriftStruct.(oneway); ok {
+		ow = o.Oneway()
+	}
+	if ow && !c.enableOneway {
+		return ErrOnewayNotEnabled
+	}
+	mtype := byte(MessageTypeCall)
+	if ow {
+		mtype = MessageTypeOneway
+	}
+	if err := c.conn.WriteMessageBegin(request.ServiceMethod, mtype, int32(request.Seq)); err != nil {
+		return err
+	}
+	if err := EncodeStruct(c.conn, thriftStruct); err != nil {
+		return err
+	}
+	if err := c.conn.WriteMessageEnd(); err != nil {
+		return err
+	}
+	if err := c.conn.Flush(); err != nil {
+		return err
+	}
+	if c.enableOneway {
+		var err error
+		if ow {
+			select {
+			case c.onewayRequests <- pendingRequest{request.ServiceMethod, request.Seq}:
+			default:
+				err = ErrTooManyPendingRequests
+			}
+		} else {
+			select {
+			case c.twowayRequests <- pendingRequest{request.ServiceMethod, request.Seq}:
+			default:
+				err = ErrTooManyPendingRequests
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *clientCodec) ReadResponseHeader(response *rpc.Response) error {
+	if c.enableOneway {
+		select {
+		case ow := <-c.onewayRequests:
+			response.ServiceMethod = ow.method
+			response.Seq = ow.seq
+			return nil
+		case _ = <-c.twowayRequests:
+		}
+	}
+
+	name, messageType, seq, err := c.conn.ReadMessageBegin()
+	if err != nil {
+		return err
+	}
+	response.ServiceMethod = name
+	response.Seq = uint64(seq)
+	if messageType == MessageTypeException {
+		exception := &ApplicationException{}
+		if err := DecodeStruct(c.conn, exception); err != nil {
+			return err
+		}
+		response.Error = exception.String()
+		return c.conn.ReadMessageEnd()
+	}
+	return nil
+}
+
+func (c *clientCodec) ReadResponseBody(thriftStruct interface{}) error {
+	if thriftStruct == nil {
+		// Should only get called if ReadResponseHeader set the Error value in
+		// which case we've already read the body (ApplicationException)
+		return nil
+	}
+
+	if err := DecodeStruct(c.conn, thriftStruct); err != nil {
+		return err
+	}
+
+	return c.conn.ReadMessageEnd()
+}
+
+func (c *clientCodec) Close() error {
+	if cl, ok := c.conn.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
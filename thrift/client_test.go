@@ -5,14 +5,17 @@
 package thrift
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/rpc"
 	"runtime"
 	"sync"
 	"testing"
+	"time"
 )
 
 var (
@@ -224,6 +227,218 @@ func TestRPCClientFail(t *testing.T) {
 	}
 }
 
+func TestClientCallContext(t *testing.T) {
+	once.Do(startServer)
+
+	c, err := DialClientContext(context.Background(), "tcp", serverAddr, true, BinaryProtocol, false)
+	if err != nil {
+		t.Fatalf("DialClientContext returned error: %+v", err)
+	}
+	defer c.Close()
+	req := &TestRequest{123}
+	res := &TestResponse{789}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.CallContext(ctx, "Success", req, res); err != nil {
+		t.Fatalf("Client.CallContext returned error: %+v", err)
+	}
+	if res.Value != req.Value {
+		t.Fatalf("Response value wrong: %d != %d", res.Value, req.Value)
+	}
+}
+
+type blockingTestService struct {
+	release chan struct{}
+}
+
+func (s *blockingTestService) Block(req *TestRequest, res *TestResponse) error {
+	<-s.release
+	res.Value = req.Value
+	return nil
+}
+
+func startBlockingTestServer(t *testing.T) (*blockingTestService, net.Conn) {
+	svc := &blockingTestService{release: make(chan struct{})}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Thrift", svc); err != nil {
+		t.Fatal(err)
+	}
+	cli, conn := net.Pipe()
+	go srv.ServeCodec(NewServerCodec(NewTransport(conn, BinaryProtocol)))
+	return svc, cli
+}
+
+func TestContextClientDeadline(t *testing.T) {
+	svc, cli := startBlockingTestServer(t)
+	defer close(svc.release)
+
+	c := NewContextClient(NewTransport(cli, BinaryProtocol), false)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	res := &TestResponse{}
+	if err := c.CallContext(ctx, "block", &TestRequest{123}, res); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %+v", err)
+	}
+	if res.Value != 0 {
+		t.Fatalf("Response of failed call was modified: %+v", res)
+	}
+	if err := c.CallContext(context.Background(), "block", &TestRequest{123}, res); err != rpc.ErrShutdown {
+		t.Fatalf("Expected rpc.ErrShutdown after a cancelled call, got %+v", err)
+	}
+}
+
+// An abandoned call must not break the connection: its response is discarded
+// and later calls get their own.
+func TestClientAbandonedCall(t *testing.T) {
+	svc, cli := startBlockingTestServer(t)
+	c := NewNativeClient(NewTransport(cli, BinaryProtocol), false)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	res := &TestResponse{}
+	if err := c.CallContext(ctx, "block", &TestRequest{123}, res); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %+v", err)
+	}
+	close(svc.release)
+
+	res2 := &TestResponse{}
+	if err := c.Call("block", &TestRequest{456}, res2); err != nil {
+		t.Fatalf("Client.Call returned error: %+v", err)
+	}
+	if res.Value != 0 {
+		t.Fatalf("Response of abandoned call was modified: %+v", res)
+	}
+	if res2.Value != 456 {
+		t.Fatalf("Response value wrong: %d != 456", res2.Value)
+	}
+}
+
+// A malformed response closes the connection and fails the pending call.
+func TestClientBadResponse(t *testing.T) {
+	cli, srv := net.Pipe()
+	c := NewNativeClient(NewTransport(cli, BinaryProtocol), false)
+	defer c.Close()
+
+	called := make(chan error, 1)
+	go func() {
+		called <- c.Call("echo", &TestRequest{123}, &TestResponse{})
+	}()
+	st := NewTransport(srv, BinaryProtocol)
+	if _, _, _, err := st.ReadMessageBegin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SkipValue(st, TypeStruct); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.ReadMessageEnd(); err != nil {
+		t.Fatal(err)
+	}
+	// A message header with a bad version.
+	if _, err := srv.Write([]byte{0xff, 0xff, 0xff, 0xff}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := (<-called).(ProtocolError); !ok {
+		t.Fatal("Expected the protocol error of the response")
+	}
+	if _, err := srv.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Expected the client to close the connection, got %+v", err)
+	}
+}
+
+// A truncated exception fails the call with the error reading it rather
+// than the part of the exception that was read.
+func TestClientTruncatedException(t *testing.T) {
+	cli, srv := net.Pipe()
+	c := NewNativeClient(NewTransport(cli, BinaryProtocol), false)
+	defer c.Close()
+
+	called := make(chan error, 1)
+	go func() {
+		called <- c.Call("echo", &TestRequest{123}, &TestResponse{})
+	}()
+	st := NewTransport(srv, BinaryProtocol)
+	_, _, seq, err := st.ReadMessageBegin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SkipValue(st, TypeStruct); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.ReadMessageEnd(); err != nil {
+		t.Fatal(err)
+	}
+	// The exception message is cut short by the end of the stream.
+	if err := st.WriteMessageBegin("echo", MessageTypeException, seq); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.WriteFieldBegin("message", TypeString, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.WriteI32(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	err = <-called
+	if err == nil {
+		t.Fatal("Expected the call to fail")
+	}
+	if _, ok := err.(*ApplicationException); ok {
+		t.Fatalf("Expected the error reading the exception, got %+v", err)
+	}
+}
+
+func TestClientConcurrentCalls(t *testing.T) {
+	once.Do(startServer)
+
+	c, err := DialClient("tcp", serverAddr, true, BinaryProtocol, false)
+	if err != nil {
+		t.Fatalf("DialClient returned error: %+v", err)
+	}
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int32) {
+			defer wg.Done()
+			for j := int32(0); j < 10; j++ {
+				v := i*100 + j
+				res := &TestResponse{}
+				if err := c.Call("Success", &TestRequest{v}, res); err != nil {
+					t.Errorf("Client.Call returned error: %+v", err)
+					return
+				}
+				if res.Value != v {
+					t.Errorf("Response value wrong: %d != %d", res.Value, v)
+				}
+			}
+		}(int32(i))
+	}
+	wg.Wait()
+}
+
+func TestClientClose(t *testing.T) {
+	once.Do(startServer)
+
+	c, err := DialClient("tcp", serverAddr, true, BinaryProtocol, false)
+	if err != nil {
+		t.Fatalf("DialClient returned error: %+v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close returned error: %+v", err)
+	}
+	if err := c.Call("Success", &TestRequest{123}, &TestResponse{}); err != ErrShutdown {
+		t.Fatalf("Expected ErrShutdown after Close, got %+v", err)
+	}
+	if err := c.Close(); err != ErrShutdown {
+		t.Fatalf("Expected ErrShutdown from second Close, got %+v", err)
+	}
+}
+
 func TestRPCMallocCount(t *testing.T) {
 	once.Do(startServer)
 
@@ -14,6 +14,13 @@ type Decoder interface {
 	DecodeThrift(ProtocolReader) error
 }
 
+// Defaulter is implemented by structs with default field values. The
+// reflection based decoder calls SetDefaults before decoding a struct, so
+// that fields missing from the stream keep their default.
+type Defaulter interface {
+	SetDefaults()
+}
+
 type decoder struct {
 	r ProtocolReader
 }
@@ -141,8 +148,15 @@ func (d *decoder) readValue(thriftType byte, rf reflect.Value) {
 			d.error(err)
 		}
 
+		if v.CanAddr() {
+			if de, ok := v.Addr().Interface().(Defaulter); ok {
+				de.SetDefaults()
+			}
+		}
+
 		meta := encodeFields(v.Type())
 		req := meta.required.Clone()
+		set := 0
 		for {
 			ftype, id, err := d.r.ReadFieldBegin()
 			if err != nil {
@@ -157,6 +171,7 @@ func (d *decoder) readValue(thriftType byte, rf reflect.Value) {
 				SkipValue(d.r, ftype)
 			} else {
 				req.Clear(int(id))
+				set++
 				fieldValue := v.Field(ef.i)
 				if ftype != ef.fieldType {
 					d.error(&UnsupportedValueError{Value: fieldValue, Str: "type mismatch"})
@@ -173,6 +188,10 @@ func (d *decoder) readValue(thriftType byte, rf reflect.Value) {
 			d.error(err)
 		}
 
+		if meta.union && set != 1 {
+			d.error(&InvalidUnionError{v.Type().Name(), set})
+		}
+
 		if !req.Empty() {
 			for _, i := range req.Bits() {
 				d.error(&MissingRequiredField{
@@ -205,6 +224,7 @@ func (d *decoder) readValue(thriftType byte, rf reflect.Value) {
 		if err != nil {
 			d.error(err)
 		}
+		v.Set(reflect.Zero(v.Type()))
 		for i := 0; i < n; i++ {
 			val := reflect.New(elemType)
 			d.readValue(et, val.Elem())
@@ -220,6 +240,7 @@ func (d *decoder) readValue(thriftType byte, rf reflect.Value) {
 			if err != nil {
 				d.error(err)
 			}
+			v.Set(reflect.Zero(v.Type()))
 			for i := 0; i < n; i++ {
 				val := reflect.New(elemType)
 				d.readValue(et, val.Elem())
@@ -52,11 +52,23 @@ func (e *encoder) writeStruct(v reflect.Value) {
 		}
 		e.error(&UnsupportedValueError{Value: v, Str: "expected a struct"})
 	}
+	mf := encodeFields(v.Type())
+	if mf.union {
+		set := 0
+		for _, ef := range mf.fields {
+			if !isEmptyValue(v.Field(ef.i)) {
+				set++
+			}
+		}
+		if set != 1 {
+			e.error(&InvalidUnionError{v.Type().Name(), set})
+		}
+	}
+
 	if err := e.w.WriteStructBegin(v.Type().Name()); err != nil {
 		e.error(err)
 	}
 
-	mf := encodeFields(v.Type())
 	for _, fid := range mf.orderedIds {
 		ef := mf.fields[fid]
 		structField := v.Type().Field(ef.i)
@@ -82,6 +82,31 @@ type testCustomStruct struct {
 	Custom *IntSet `thrift:"1"`
 }
 
+type testUnion struct {
+	Int *int32            `thrift:"1,union"`
+	Str *string           `thrift:"2,union"`
+	Map map[string]string `thrift:"3,union"`
+}
+
+type testDefaultsStruct struct {
+	Int    *int32              `thrift:"1"`
+	List   []string            `thrift:"2"`
+	Nested *testDefaultsNested `thrift:"3"`
+}
+
+func (s *testDefaultsStruct) SetDefaults() {
+	s.Int = Int32(10)
+	s.List = []string{"a", "b"}
+}
+
+type testDefaultsNested struct {
+	Str string `thrift:"1"`
+}
+
+func (s *testDefaultsNested) SetDefaults() {
+	s.Str = "default"
+}
+
 func TestKeepEmpty(t *testing.T) {
 	buf := &bytes.Buffer{}
 
@@ -266,6 +291,56 @@ func TestDecodeCustom(t *testing.T) {
 	}
 }
 
+func TestUnion(t *testing.T) {
+	for _, u := range []*testUnion{{}, {Int: Int32(1), Str: String("a")}} {
+		err := EncodeStruct(NewBinaryProtocolWriter(&bytes.Buffer{}, true), u)
+		if _, ok := err.(*InvalidUnionError); !ok {
+			t.Fatalf("Expected InvalidUnionError for %+v instead %+v", u, err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := EncodeStruct(NewBinaryProtocolWriter(buf, true), &testUnion{Map: map[string]string{}}); err != nil {
+		t.Fatal(err)
+	}
+	u := &testUnion{}
+	if err := DecodeStruct(NewBinaryProtocolReader(buf, false), u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Map == nil || u.Int != nil || u.Str != nil {
+		t.Fatalf("Expected only Map to be set instead %+v", u)
+	}
+
+	buf.Reset()
+	if err := EncodeStruct(NewBinaryProtocolWriter(buf, true), &TestEmptyStruct{}); err != nil {
+		t.Fatal(err)
+	}
+	err := DecodeStruct(NewBinaryProtocolReader(buf, false), &testUnion{})
+	if e, ok := err.(*InvalidUnionError); !ok || e.StructName != "testUnion" || e.Fields != 0 {
+		t.Fatalf("Expected InvalidUnionError{testUnion, 0} instead %+v", err)
+	}
+}
+
+func TestDecodeDefaults(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := EncodeStruct(NewBinaryProtocolWriter(buf, true), &struct {
+		List   []string         `thrift:"2"`
+		Nested *TestEmptyStruct `thrift:"3"`
+	}{List: []string{"c"}, Nested: &TestEmptyStruct{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := &testDefaultsStruct{}
+	if err := DecodeStruct(NewBinaryProtocolReader(buf, false), st); err != nil {
+		t.Fatal(err)
+	}
+	expected := &testDefaultsStruct{Int32(10), []string{"c"}, &testDefaultsNested{"default"}}
+	if !reflect.DeepEqual(expected, st) {
+		t.Fatalf("Expected %+v instead %+v", expected, st)
+	}
+}
+
 // Benchmarks
 
 func BenchmarkEncodeEmptyStruct(b *testing.B) {
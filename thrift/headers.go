@@ -0,0 +1,99 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"context"
+	"sync"
+)
+
+// Headers are sent with messages by transports that support them, such as
+// HeaderTransport, and ignored by the others.
+
+type requestHeadersKey struct{}
+
+type responseHeadersKey struct{}
+
+type serverHeadersKey struct{}
+
+// serverHeaders holds the headers of a request being handled by a Server
+// and of its response.
+type serverHeaders struct {
+	request map[string]string
+
+	mu       sync.Mutex // protects following
+	response map[string]string
+}
+
+// WithRequestHeaders returns a copy of ctx with which the calls made through
+// Client send headers along with the request.
+func WithRequestHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, requestHeadersKey{}, headers)
+}
+
+// WithResponseHeaders returns a copy of ctx with which the calls made
+// through Client add the headers received with their response to headers,
+// once the call returns.
+//
+// The map must not be shared between concurrent calls, as their headers
+// would be mixed up in it. When it is anyway, as with a context fanned out to
+// several calls, they don't write it at the same time, but it must only be
+// read once all of them have returned.
+func WithResponseHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, responseHeadersKey{}, headers)
+}
+
+// RequestHeaders returns the headers received with the request handled by a
+// Server with ctx, the context given to Server.Middleware and
+// ProcessorMethod.CallContext.
+func RequestHeaders(ctx context.Context) map[string]string {
+	if h, ok := ctx.Value(serverHeadersKey{}).(*serverHeaders); ok {
+		return h.request
+	}
+	return nil
+}
+
+// SetResponseHeader sets a header sent with the response to the request
+// handled by a Server with ctx. It has no effect once the handler has
+// returned.
+func SetResponseHeader(ctx context.Context, key, value string) {
+	h, ok := ctx.Value(serverHeadersKey{}).(*serverHeaders)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	if h.response == nil {
+		h.response = make(map[string]string)
+	}
+	h.response[key] = value
+	h.mu.Unlock()
+}
+
+// responseHeaders returns the headers set with SetResponseHeader.
+func (h *serverHeaders) responseHeaders() map[string]string {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.response
+}
+
+// readMessage returns the format and headers of the message last read from
+// conn, or nil if its messages don't have any.
+func readMessage(conn Transport) *headerMessage {
+	if h, ok := conn.(messageHeaders); ok {
+		return h.readMessage()
+	}
+	return nil
+}
+
+// writeNext sets up the next message written to conn, if its messages have
+// headers. See messageHeaders.
+func writeNext(conn Transport, reply *headerMessage, headers map[string]string) {
+	if h, ok := conn.(messageHeaders); ok {
+		h.writeNext(reply, headers)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import "context"
+
+// Handler handles a call of the named Thrift method. request and response
+// are the request and response structs of the method, response being nil
+// for one-way methods.
+type Handler func(ctx context.Context, method string, request, response interface{}) error
+
+// Middleware runs around the handling of calls, on clients with
+// MiddlewareClient and on servers with Server.Middleware. It's given the
+// call and next, the rest of the chain, which it may call, possibly with
+// another context, or not to fail the call itself. Errors returned by a
+// server middleware are sent to the client as for the handler, i.e. as an
+// ApplicationException. On servers the context is cancelled when the
+// connection is closed, and reaches the handler only through
+// ProcessorMethod.CallContext, which code generated with -go.context uses.
+type Middleware func(ctx context.Context, method string, request, response interface{}, next Handler) error
+
+// Chain returns a Middleware running mws in order, the first one being the
+// outermost.
+func Chain(mws ...Middleware) Middleware {
+	return func(ctx context.Context, method string, request, response interface{}, next Handler) error {
+		return withMiddleware(mws, next)(ctx, method, request, response)
+	}
+}
+
+// withMiddleware returns a Handler running mws in order before h.
+func withMiddleware(mws []Middleware, h Handler) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		mw, next := mws[i], h
+		h = func(ctx context.Context, method string, request, response interface{}) error {
+			return mw(ctx, method, request, response, next)
+		}
+	}
+	return h
+}
+
+// MiddlewareClient is an RPC client that makes calls through Client after
+// running them through Middleware, in order. It implements the RPCClient
+// and ContextRPCClient interfaces of generated code.
+type MiddlewareClient struct {
+	Client     Caller
+	Middleware []Middleware
+}
+
+// Call invokes the named function and returns its error status, as
+// Client.Call does.
+func (c *MiddlewareClient) Call(method string, request interface{}, response interface{}) error {
+	return c.CallContext(context.Background(), method, request, response)
+}
+
+// CallContext is like Call but passes ctx to the middleware and Client.
+func (c *MiddlewareClient) CallContext(ctx context.Context, method string, request interface{}, response interface{}) error {
+	return withMiddleware(c.Middleware, c.Client.CallContext)(ctx, method, request, response)
+}
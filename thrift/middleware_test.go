@@ -0,0 +1,128 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recorder returns a middleware appending what it sees to calls.
+func recorder(name string, calls *[]string) Middleware {
+	return func(ctx context.Context, method string, req, res interface{}, next Handler) error {
+		*calls = append(*calls, fmt.Sprintf("%s %s %T %T", name, method, req, res))
+		return next(ctx, method, req, res)
+	}
+}
+
+type ctxKey struct{}
+
+type callerFunc func(ctx context.Context, method string, request interface{}, response interface{}) error
+
+func (f callerFunc) CallContext(ctx context.Context, method string, request interface{}, response interface{}) error {
+	return f(ctx, method, request, response)
+}
+
+func TestMiddlewareClient(t *testing.T) {
+	var calls []string
+	c := &MiddlewareClient{
+		Client: callerFunc(func(ctx context.Context, method string, req, res interface{}) error {
+			calls = append(calls, fmt.Sprintf("client %s %v", method, ctx.Value(ctxKey{})))
+			res.(*TestResponse).Value = req.(*TestRequest).Value
+			return nil
+		}),
+		Middleware: []Middleware{
+			recorder("first", &calls),
+			func(ctx context.Context, method string, req, res interface{}, next Handler) error {
+				err := next(context.WithValue(ctx, ctxKey{}, "value"), method, req, res)
+				res.(*TestResponse).Value++
+				return err
+			},
+			recorder("last", &calls),
+		},
+	}
+	res := &TestResponse{}
+	if err := c.Call("echo", &TestRequest{41}, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != 42 {
+		t.Fatalf("Expected 42, got %d", res.Value)
+	}
+	expected := []string{
+		"first echo *thrift.TestRequest *thrift.TestResponse",
+		"last echo *thrift.TestRequest *thrift.TestResponse",
+		"client echo value",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("Expected calls\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(calls, "\n"))
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	mw := Chain(recorder("a", &calls), recorder("b", &calls))
+	c := &MiddlewareClient{
+		Client: callerFunc(func(ctx context.Context, method string, req, res interface{}) error {
+			calls = append(calls, "client")
+			return nil
+		}),
+		Middleware: []Middleware{mw, recorder("c", &calls)},
+	}
+	if err := c.Call("notify", &TestOneWayRequest{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"a notify *thrift.TestOneWayRequest <nil>",
+		"b notify *thrift.TestOneWayRequest <nil>",
+		"c notify *thrift.TestOneWayRequest <nil>",
+		"client",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("Expected calls\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(calls, "\n"))
+	}
+}
+
+func TestServerMiddleware(t *testing.T) {
+	var calls []string
+	srv := &Server{
+		Processor: &testProcessor{calls: make(chan int32, 1)},
+		Middleware: []Middleware{
+			recorder("log", &calls),
+			func(ctx context.Context, method string, req, res interface{}, next Handler) error {
+				if req.(*TestRequest).Value < 0 {
+					return &ApplicationException{"denied", ExceptionUnknown}
+				}
+				return next(ctx, method, req, res)
+			},
+		},
+	}
+	cli, conn := net.Pipe()
+	go srv.ServeTransport(NewTransport(conn, BinaryProtocol))
+	c := NewNativeClient(NewTransport(cli, BinaryProtocol), false)
+	defer c.Close()
+
+	res := &TestResponse{}
+	if err := c.Call("echo", &TestRequest{123}, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != 123 {
+		t.Fatalf("Expected 123, got %d", res.Value)
+	}
+	err := c.Call("echo", &TestRequest{-1}, res)
+	if exc, ok := err.(*ApplicationException); !ok || exc.Type != ExceptionUnknown || exc.Message != "denied" {
+		t.Fatalf("Expected the exception of the middleware, got %+v", err)
+	}
+	expected := []string{
+		"log echo *thrift.TestRequest *thrift.TestResponse",
+		"log echo *thrift.TestRequest *thrift.TestResponse",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("Expected calls\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(calls, "\n"))
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrProcessorStarted is returned when registering a processor with a
+// MultiplexedProcessor that is already being served.
+var ErrProcessorStarted = errors.New("thrift: MultiplexedProcessor registration after ProcessorMethods")
+
+// MultiplexedSeparator separates the service name from the method name in
+// the message names of the multiplexed protocol, e.g. "Calculator:add".
+const MultiplexedSeparator = ":"
+
+type multiplexedProtocolWriter struct {
+	ProtocolWriter
+	prefix string
+}
+
+type multiplexedProtocolReader struct {
+	ProtocolReader
+	prefix string
+}
+
+// MultiplexedProtocol returns a ProtocolBuilder for talking to the named
+// service on a server that multiplexes several services over one connection,
+// as TMultiplexedProtocol does in the other Thrift libraries. Messages are
+// otherwise encoded by the given protocol.
+func MultiplexedProtocol(protocol ProtocolBuilder, service string) ProtocolBuilder {
+	return NewProtocolBuilder(
+		func(r io.Reader) ProtocolReader {
+			return NewMultiplexedProtocolReader(protocol.NewProtocolReader(r), service)
+		},
+		func(w io.Writer) ProtocolWriter {
+			return NewMultiplexedProtocolWriter(protocol.NewProtocolWriter(w), service)
+		},
+	)
+}
+
+// NewMultiplexedProtocolWriter returns a ProtocolWriter that prefixes the names
+// of the Call and Oneway messages it writes with the service name.
+func NewMultiplexedProtocolWriter(w ProtocolWriter, service string) ProtocolWriter {
+	return &multiplexedProtocolWriter{
+		ProtocolWriter: w,
+		prefix:         service + MultiplexedSeparator,
+	}
+}
+
+func (p *multiplexedProtocolWriter) WriteMessageBegin(name string, messageType byte, seqid int32) error {
+	if messageType == MessageTypeCall || messageType == MessageTypeOneway {
+		name = p.prefix + name
+	}
+	return p.ProtocolWriter.WriteMessageBegin(name, messageType, seqid)
+}
+
+// NewMultiplexedProtocolReader returns a ProtocolReader that removes the
+// service name prefix from the names of the messages it reads, for servers
+// that reply with the name of the request.
+func NewMultiplexedProtocolReader(r ProtocolReader, service string) ProtocolReader {
+	return &multiplexedProtocolReader{
+		ProtocolReader: r,
+		prefix:         service + MultiplexedSeparator,
+	}
+}
+
+func (p *multiplexedProtocolReader) ReadMessageBegin() (name string, messageType byte, seqid int32, err error) {
+	name, messageType, seqid, err = p.ProtocolReader.ReadMessageBegin()
+	name = strings.TrimPrefix(name, p.prefix)
+	return
+}
+
+// MultiplexedProcessor is a Processor that routes requests to the Processor
+// registered for the service named by their "Service:method" message name.
+// Requests without a service name go to the default Processor, if any, so
+// that clients that don't use the multiplexed protocol can still be served.
+//
+// Processors must be registered before serving: a Server takes the methods
+// of its Processor once when it starts, so registering a processor after
+// ProcessorMethods has been called fails with ErrProcessorStarted.
+type MultiplexedProcessor struct {
+	mu               sync.Mutex // protects following
+	processors       map[string]Processor
+	defaultProcessor Processor
+	started          bool // ProcessorMethods has been called
+}
+
+// NewMultiplexedProcessor returns an empty MultiplexedProcessor.
+func NewMultiplexedProcessor() *MultiplexedProcessor {
+	return &MultiplexedProcessor{
+		processors: make(map[string]Processor),
+	}
+}
+
+// Register routes the requests for the named service to the processor.
+func (m *MultiplexedProcessor) Register(service string, processor Processor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started {
+		return ErrProcessorStarted
+	}
+	m.processors[service] = processor
+	return nil
+}
+
+// RegisterDefault routes the requests without a service name to the processor.
+func (m *MultiplexedProcessor) RegisterDefault(processor Processor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started {
+		return ErrProcessorStarted
+	}
+	m.defaultProcessor = processor
+	return nil
+}
+
+func (m *MultiplexedProcessor) ProcessorMethods() map[string]ProcessorMethod {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.started = true
+	methods := make(map[string]ProcessorMethod)
+	if m.defaultProcessor != nil {
+		for name, method := range m.defaultProcessor.ProcessorMethods() {
+			methods[name] = method
+		}
+	}
+	for service, processor := range m.processors {
+		for name, method := range processor.ProcessorMethods() {
+			methods[service+MultiplexedSeparator+name] = method
+		}
+	}
+	return methods
+}
+
+// splitMultiplexedName splits a message name into the service and method
+// names. The service is empty if the name doesn't have one.
+func splitMultiplexedName(name string) (service, method string) {
+	if i := strings.Index(name, MultiplexedSeparator); i >= 0 {
+		return name[:i], name[i+len(MultiplexedSeparator):]
+	}
+	return "", name
+}
@@ -0,0 +1,145 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"bytes"
+	"net"
+	"net/rpc"
+	"testing"
+)
+
+func TestMultiplexedProtocolNames(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewMultiplexedProtocolWriter(NewBinaryProtocolWriter(buf, true), "Calculator")
+	r := NewBinaryProtocolReader(buf, true)
+
+	if err := w.WriteMessageBegin("add", MessageTypeCall, 1); err != nil {
+		t.Fatal(err)
+	}
+	if name, _, _, err := r.ReadMessageBegin(); err != nil {
+		t.Fatal(err)
+	} else if name != "Calculator:add" {
+		t.Fatalf("Expected name Calculator:add for call, got %s", name)
+	}
+
+	if err := w.WriteMessageBegin("add", MessageTypeReply, 1); err != nil {
+		t.Fatal(err)
+	}
+	if name, _, _, err := r.ReadMessageBegin(); err != nil {
+		t.Fatal(err)
+	} else if name != "add" {
+		t.Fatalf("Expected name add for reply, got %s", name)
+	}
+
+	mr := NewMultiplexedProtocolReader(r, "Calculator")
+	if err := w.WriteMessageBegin("add", MessageTypeOneway, 1); err != nil {
+		t.Fatal(err)
+	}
+	if name, _, _, err := mr.ReadMessageBegin(); err != nil {
+		t.Fatal(err)
+	} else if name != "add" {
+		t.Fatalf("Expected prefix to be removed, got %s", name)
+	}
+}
+
+type doubleProcessor struct{}
+
+func (p doubleProcessor) ProcessorMethods() map[string]ProcessorMethod {
+	return map[string]ProcessorMethod{
+		"echo": {
+			NewRequest:  func() interface{} { return &TestRequest{} },
+			NewResponse: func() interface{} { return &TestResponse{} },
+			Call: func(req, res interface{}) error {
+				res.(*TestResponse).Value = 2 * req.(*TestRequest).Value
+				return nil
+			},
+		},
+	}
+}
+
+func dialMultiplexed(t *testing.T, addr string, protocol ProtocolBuilder) *Client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewNativeClient(NewTransport(NewFramedReadWriteCloser(conn, DefaultMaxFrameSize), protocol), false)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func expectEcho(t *testing.T, c *Client, value, expected int32) {
+	res := &TestResponse{}
+	if err := c.Call("echo", &TestRequest{value}, res); err != nil {
+		t.Fatalf("Client.Call returned error: %+v", err)
+	}
+	if res.Value != expected {
+		t.Fatalf("Response value wrong: %d != %d", res.Value, expected)
+	}
+}
+
+func TestMultiplexedProcessor(t *testing.T) {
+	mp := NewMultiplexedProcessor()
+	mp.Register("Identity", &testProcessor{})
+	mp.Register("Double", doubleProcessor{})
+	mp.RegisterDefault(doubleProcessor{})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go (&Server{Processor: mp}).Serve(ln)
+	addr := ln.Addr().String()
+
+	expectEcho(t, dialMultiplexed(t, addr, MultiplexedProtocol(BinaryProtocol, "Identity")), 21, 21)
+	expectEcho(t, dialMultiplexed(t, addr, MultiplexedProtocol(BinaryProtocol, "Double")), 21, 42)
+	expectEcho(t, dialMultiplexed(t, addr, BinaryProtocol), 4, 8)
+
+	c := dialMultiplexed(t, addr, MultiplexedProtocol(BinaryProtocol, "Missing"))
+	err = c.Call("echo", &TestRequest{1}, &TestResponse{})
+	if exc, ok := err.(*ApplicationException); !ok || exc.Type != ExceptionUnknownMethod {
+		t.Fatalf("Expected an unknown method exception, got %+v", err)
+	}
+}
+
+func TestMultiplexedProcessorLateRegister(t *testing.T) {
+	mp := NewMultiplexedProcessor()
+	if err := mp.Register("Identity", &testProcessor{}); err != nil {
+		t.Fatal(err)
+	}
+	mp.ProcessorMethods()
+	if err := mp.Register("Double", doubleProcessor{}); err != ErrProcessorStarted {
+		t.Errorf("Expected Register after ProcessorMethods to fail, got %+v", err)
+	}
+	if err := mp.RegisterDefault(doubleProcessor{}); err != ErrProcessorStarted {
+		t.Errorf("Expected RegisterDefault after ProcessorMethods to fail, got %+v", err)
+	}
+	if _, ok := mp.ProcessorMethods()["Double:echo"]; ok {
+		t.Error("Expected the late registration to be ignored")
+	}
+}
+
+type multiplexedTestService struct{}
+
+func (s *multiplexedTestService) Echo(req *TestRequest, res *TestResponse) error {
+	res.Value = req.Value
+	return nil
+}
+
+// The server codec routes multiplexed requests to the net/rpc service
+// registered under the name of the Thrift service.
+func TestServerCodecMultiplexed(t *testing.T) {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Store", &multiplexedTestService{}); err != nil {
+		t.Fatal(err)
+	}
+	cli, conn := net.Pipe()
+	go srv.ServeCodec(NewServerCodec(NewTransport(conn, BinaryProtocol)))
+
+	c := NewNativeClient(NewTransport(cli, MultiplexedProtocol(BinaryProtocol, "Store")), false)
+	defer c.Close()
+	expectEcho(t, c, 123, 123)
+}
@@ -0,0 +1,279 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrNoConnection is the error returned by calls on a Pool none of whose
+// connections is up.
+var ErrNoConnection = errors.New("thrift.pool: no connection available")
+
+// Balancer is the way a Pool chooses the connection of a call.
+type Balancer int
+
+const (
+	// RoundRobin uses the connections in turn, alternating endpoints.
+	RoundRobin Balancer = iota
+	// LeastPending uses the connection with the fewest calls in progress.
+	LeastPending
+)
+
+// PoolOptions configures a Pool. The zero value is usable.
+type PoolOptions struct {
+	// Dial connects to an endpoint. When nil framed binary protocol over
+	// TCP is used.
+	Dial func(ctx context.Context, endpoint string) (*Client, error)
+	// ConnsPerEndpoint is the number of connections kept to every
+	// endpoint, 1 when not positive.
+	ConnsPerEndpoint int
+	Balancer         Balancer
+	// MinBackoff and MaxBackoff bound the time to wait before dialing an
+	// endpoint again after a failure, which doubles with every failure in
+	// a row. They default to 10ms and 10s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Pool is an RPC client keeping connections to a set of endpoints, which
+// implements the RPCClient and ContextRPCClient interfaces of generated code
+// by spreading calls over them. Connections are dialed in the background,
+// broken ones are dropped and dialed again, with a backoff when dialing
+// fails. A Pool may be used by multiple goroutines simultaneously.
+type Pool struct {
+	dial       func(ctx context.Context, endpoint string) (*Client, error)
+	balancer   Balancer
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	ctx    context.Context // canceled by Close
+	cancel context.CancelFunc
+	wg     sync.WaitGroup // tracks the goroutines maintaining conns
+
+	mu      sync.Mutex // protects following
+	conns   []*poolConn
+	next    int           // index of the conn to consider first
+	dialing int           // number of conns being dialed
+	changed chan struct{} // closed and replaced when a conn comes up or a dial fails
+	closed  bool
+}
+
+type poolConn struct {
+	endpoint string
+	client   *Client // nil when not connected
+	pending  int     // number of calls in progress on client
+}
+
+// NewPool returns a Pool connecting to endpoints, network addresses unless
+// opts.Dial says otherwise. opts may be nil.
+func NewPool(endpoints []string, opts *PoolOptions) *Pool {
+	if opts == nil {
+		opts = &PoolOptions{}
+	}
+	p := &Pool{
+		dial:       opts.Dial,
+		balancer:   opts.Balancer,
+		minBackoff: opts.MinBackoff,
+		maxBackoff: opts.MaxBackoff,
+		changed:    make(chan struct{}),
+	}
+	if p.dial == nil {
+		p.dial = func(ctx context.Context, endpoint string) (*Client, error) {
+			return DialClientContext(ctx, "tcp", endpoint, true, BinaryProtocol, false)
+		}
+	}
+	if p.minBackoff <= 0 {
+		p.minBackoff = 10 * time.Millisecond
+	}
+	if p.maxBackoff <= 0 {
+		p.maxBackoff = 10 * time.Second
+	}
+	if p.maxBackoff < p.minBackoff {
+		p.maxBackoff = p.minBackoff
+	}
+	n := opts.ConnsPerEndpoint
+	if n <= 0 {
+		n = 1
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	// Consecutive conns are to different endpoints, so that going through
+	// them in turn spreads calls evenly.
+	for i := 0; i < n; i++ {
+		for _, ep := range endpoints {
+			p.conns = append(p.conns, &poolConn{endpoint: ep})
+		}
+	}
+	p.dialing = len(p.conns)
+	p.wg.Add(len(p.conns))
+	for _, pc := range p.conns {
+		go p.maintain(pc)
+	}
+	return p
+}
+
+// Call invokes the named function on one of the connections, waits for it
+// to complete, and returns its error status, as Client.Call does.
+func (p *Pool) Call(method string, request interface{}, response interface{}) error {
+	return p.CallContext(context.Background(), method, request, response)
+}
+
+// CallContext is like Call but gives up when ctx is done, as
+// Client.CallContext does. When no connection is up it waits for those
+// being dialed, and fails with ErrNoConnection if there are none.
+func (p *Pool) CallContext(ctx context.Context, method string, request interface{}, response interface{}) error {
+	pc, c, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.CallContext(ctx, method, request, response)
+	p.mu.Lock()
+	pc.pending--
+	p.mu.Unlock()
+	return err
+}
+
+// get picks the conn of a call and counts the call as pending on it.
+func (p *Pool) get(ctx context.Context) (*poolConn, *Client, error) {
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, nil, ErrShutdown
+		}
+		if pc := p.pick(); pc != nil {
+			pc.pending++
+			c := pc.client
+			p.mu.Unlock()
+			return pc, c, nil
+		}
+		if p.dialing == 0 {
+			p.mu.Unlock()
+			return nil, nil, ErrNoConnection
+		}
+		changed := p.changed
+		p.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		p.mu.Lock()
+	}
+}
+
+// pick returns the connected conn to use according to the balancer, or nil
+// if there's none. p.mu must be held.
+func (p *Pool) pick() *poolConn {
+	n := len(p.conns)
+	var best *poolConn
+	bestIdx := 0
+	for i := 0; i < n; i++ {
+		idx := (p.next + i) % n
+		pc := p.conns[idx]
+		if pc.client == nil {
+			continue
+		}
+		if best == nil || pc.pending < best.pending {
+			best, bestIdx = pc, idx
+		}
+		if p.balancer == RoundRobin {
+			break
+		}
+	}
+	if best != nil {
+		p.next = (bestIdx + 1) % n
+	}
+	return best
+}
+
+// broadcast wakes up the calls waiting for a conn. p.mu must be held.
+func (p *Pool) broadcast() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// maintain dials pc until the pool is closed, again as soon as its
+// connection is gone or after a backoff when dialing fails.
+func (p *Pool) maintain(pc *poolConn) {
+	defer p.wg.Done()
+	var backoff time.Duration
+	for {
+		c, err := p.dial(p.ctx, pc.endpoint)
+		p.mu.Lock()
+		p.dialing--
+		closed := p.closed
+		if err == nil && !closed {
+			pc.client = c
+		}
+		p.broadcast()
+		p.mu.Unlock()
+		if closed {
+			if err == nil {
+				c.Close()
+			}
+			return
+		}
+
+		if err != nil {
+			if backoff == 0 {
+				backoff = p.minBackoff
+			} else if backoff *= 2; backoff > p.maxBackoff {
+				backoff = p.maxBackoff
+			}
+			t := time.NewTimer(jitter(backoff))
+			select {
+			case <-t.C:
+			case <-p.ctx.Done():
+				t.Stop()
+				return
+			}
+		} else {
+			backoff = 0
+			select {
+			case <-c.done:
+			case <-p.ctx.Done():
+				c.Close()
+				return
+			}
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return
+		}
+		pc.client = nil
+		p.dialing++
+		p.mu.Unlock()
+	}
+}
+
+// jitter returns a random duration between half of d and d, so that the
+// clients that failed at the same time, such as the conns to an endpoint that
+// went down, don't all try again at the same time.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Close closes the connections and stops dialing. Pending calls fail with
+// ErrShutdown.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrShutdown
+	}
+	p.closed = true
+	p.broadcast()
+	p.mu.Unlock()
+	p.cancel()
+	p.wg.Wait()
+	return nil
+}
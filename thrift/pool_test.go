@@ -0,0 +1,289 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// endpointProcessor answers calls with the ID of its endpoint.
+type endpointProcessor struct {
+	id      int32
+	started chan struct{} // receives when a "block" call starts
+	release chan struct{} // closed to let "block" calls return
+}
+
+func (p *endpointProcessor) ProcessorMethods() map[string]ProcessorMethod {
+	return map[string]ProcessorMethod{
+		"whoami": {
+			NewRequest:  func() interface{} { return &TestRequest{} },
+			NewResponse: func() interface{} { return &TestResponse{} },
+			Call: func(req, res interface{}) error {
+				res.(*TestResponse).Value = p.id
+				return nil
+			},
+		},
+		"block": {
+			NewRequest:  func() interface{} { return &TestRequest{} },
+			NewResponse: func() interface{} { return &TestResponse{} },
+			Call: func(req, res interface{}) error {
+				p.started <- struct{}{}
+				<-p.release
+				res.(*TestResponse).Value = p.id
+				return nil
+			},
+		},
+	}
+}
+
+// pipeEndpoints serves endpoints in-process over net.Pipe.
+type pipeEndpoints struct {
+	mu      sync.Mutex
+	servers map[string]*Server
+	down    map[string]bool       // dialing these fails
+	conns   map[string][]net.Conn // server side of the connections
+	dials   chan string           // receives the endpoint of every dial
+}
+
+func newPipeEndpoints(procs map[string]Processor) *pipeEndpoints {
+	e := &pipeEndpoints{
+		servers: make(map[string]*Server),
+		down:    make(map[string]bool),
+		conns:   make(map[string][]net.Conn),
+		dials:   make(chan string, 100),
+	}
+	for ep, proc := range procs {
+		e.servers[ep] = &Server{Processor: proc}
+	}
+	return e
+}
+
+func (e *pipeEndpoints) dial(ctx context.Context, endpoint string) (*Client, error) {
+	select {
+	case e.dials <- endpoint:
+	default:
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	srv := e.servers[endpoint]
+	if srv == nil || e.down[endpoint] {
+		return nil, errors.New("connection refused")
+	}
+	cli, conn := net.Pipe()
+	e.conns[endpoint] = append(e.conns[endpoint], conn)
+	go srv.ServeTransport(NewTransport(conn, BinaryProtocol))
+	return NewNativeClient(NewTransport(cli, BinaryProtocol), false), nil
+}
+
+func (e *pipeEndpoints) setDown(endpoint string, down bool) {
+	e.mu.Lock()
+	e.down[endpoint] = down
+	e.mu.Unlock()
+}
+
+// hangUp closes the server side of the connections to endpoint.
+func (e *pipeEndpoints) hangUp(endpoint string) {
+	e.mu.Lock()
+	for _, conn := range e.conns[endpoint] {
+		conn.Close()
+	}
+	e.conns[endpoint] = nil
+	e.mu.Unlock()
+}
+
+func whoami(t *testing.T, p *Pool) int32 {
+	t.Helper()
+	res := &TestResponse{}
+	if err := p.Call("whoami", &TestRequest{}, res); err != nil {
+		t.Fatalf("Pool.Call returned error: %+v", err)
+	}
+	return res.Value
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	e := newPipeEndpoints(map[string]Processor{
+		"a": &endpointProcessor{id: 1},
+		"b": &endpointProcessor{id: 2},
+	})
+	p := NewPool([]string{"a", "b"}, &PoolOptions{Dial: e.dial, ConnsPerEndpoint: 2})
+	defer p.Close()
+
+	// Wait for all the connections so that none is skipped.
+	for i := 0; i < 4; i++ {
+		<-e.dials
+	}
+	waitReady(t, p, 4)
+	var got []int32
+	for i := 0; i < 8; i++ {
+		got = append(got, whoami(t, p))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] == got[i-1] {
+			t.Fatalf("Expected calls to alternate endpoints, got %v", got)
+		}
+	}
+}
+
+// waitReady waits until n conns of p are connected.
+func waitReady(t *testing.T, p *Pool, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p.mu.Lock()
+		ready := 0
+		for _, pc := range p.conns {
+			if pc.client != nil {
+				ready++
+			}
+		}
+		p.mu.Unlock()
+		if ready == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d connections, got %d", n, ready)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolLeastPending(t *testing.T) {
+	procs := map[string]*endpointProcessor{
+		"a": {id: 1, started: make(chan struct{}, 1), release: make(chan struct{})},
+		"b": {id: 2, started: make(chan struct{}, 1), release: make(chan struct{})},
+	}
+	e := newPipeEndpoints(map[string]Processor{"a": procs["a"], "b": procs["b"]})
+	p := NewPool([]string{"a", "b"}, &PoolOptions{Dial: e.dial, Balancer: LeastPending})
+	defer p.Close()
+	waitReady(t, p, 2)
+
+	blocked := make(chan int32, 1)
+	go func() {
+		res := &TestResponse{}
+		p.Call("block", &TestRequest{}, res)
+		blocked <- res.Value
+	}()
+	var busy int32
+	select {
+	case <-procs["a"].started:
+		busy = 1
+	case <-procs["b"].started:
+		busy = 2
+	}
+	for i := 0; i < 4; i++ {
+		if id := whoami(t, p); id == busy {
+			t.Fatalf("Expected calls to avoid busy endpoint %d", busy)
+		}
+	}
+	close(procs["a"].release)
+	close(procs["b"].release)
+	if id := <-blocked; id != busy {
+		t.Fatalf("Expected blocked call to be answered by %d, got %d", busy, id)
+	}
+}
+
+func TestPoolReconnect(t *testing.T) {
+	e := newPipeEndpoints(map[string]Processor{"a": &endpointProcessor{id: 1}})
+	p := NewPool([]string{"a"}, &PoolOptions{Dial: e.dial})
+	defer p.Close()
+
+	if id := whoami(t, p); id != 1 {
+		t.Fatalf("Expected 1, got %d", id)
+	}
+	<-e.dials
+	e.hangUp("a")
+	// The broken connection is evicted and dialed again right away, calls
+	// wait for it.
+	<-e.dials
+	if id := whoami(t, p); id != 1 {
+		t.Fatalf("Expected 1, got %d", id)
+	}
+}
+
+func TestPoolBackoff(t *testing.T) {
+	e := newPipeEndpoints(map[string]Processor{"a": &endpointProcessor{id: 1}})
+	e.setDown("a", true)
+	p := NewPool([]string{"a"}, &PoolOptions{
+		Dial:       e.dial,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+	})
+	defer p.Close()
+
+	if err := p.Call("whoami", &TestRequest{}, &TestResponse{}); err != ErrNoConnection {
+		t.Fatalf("Expected ErrNoConnection, got %+v", err)
+	}
+	<-e.dials
+	<-e.dials
+	e.setDown("a", false)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := p.Call("whoami", &TestRequest{}, &TestResponse{})
+		if err == nil {
+			break
+		}
+		if err != ErrNoConnection {
+			t.Fatalf("Expected ErrNoConnection, got %+v", err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Pool didn't reconnect")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolCallContext(t *testing.T) {
+	block := make(chan struct{})
+	p := NewPool([]string{"a"}, &PoolOptions{
+		Dial: func(ctx context.Context, endpoint string) (*Client, error) {
+			<-block
+			return nil, errors.New("connection refused")
+		},
+	})
+	defer p.Close()
+	defer close(block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.CallContext(ctx, "whoami", &TestRequest{}, &TestResponse{}); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded while dialing, got %+v", err)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	e := newPipeEndpoints(map[string]Processor{"a": &endpointProcessor{id: 1}})
+	p := NewPool([]string{"a"}, &PoolOptions{Dial: e.dial})
+	whoami(t, p)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Call("whoami", &TestRequest{}, &TestResponse{}); err != ErrShutdown {
+		t.Fatalf("Expected ErrShutdown after Close, got %+v", err)
+	}
+	if err := p.Close(); err != ErrShutdown {
+		t.Fatalf("Expected ErrShutdown closing twice, got %+v", err)
+	}
+}
+
+func TestPoolTCP(t *testing.T) {
+	srv := &Server{Processor: &endpointProcessor{id: 7}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go srv.Serve(ln)
+
+	p := NewPool([]string{ln.Addr().String()}, nil)
+	defer p.Close()
+	if id := whoami(t, p); id != 7 {
+		t.Fatalf("Expected 7, got %d", id)
+	}
+}
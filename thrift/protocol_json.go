@@ -0,0 +1,806 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The JSON protocol is the one of Apache Thrift's TJSONProtocol. Messages are
+// encoded as [version,"name",type,seqid,{struct}], structs as objects keyed
+// by field ID whose values are {"type":value} objects, lists and sets as
+// ["type",size,elements...] and maps as ["ktype","vtype",size,{k:v,...}].
+// Map keys, and so numbers in key position, are always strings.
+
+const jsonProtocolVersion = 1
+
+var jsonTypeNames = map[byte]string{
+	TypeBool:   "tf",
+	TypeByte:   "i8",
+	TypeI16:    "i16",
+	TypeI32:    "i32",
+	TypeI64:    "i64",
+	TypeDouble: "dbl",
+	TypeString: "str",
+	TypeStruct: "rec",
+	TypeMap:    "map",
+	TypeSet:    "set",
+	TypeList:   "lst",
+}
+
+var jsonTypeIDs = map[string]byte{
+	"tf":  TypeBool,
+	"i8":  TypeByte,
+	"i16": TypeI16,
+	"i32": TypeI32,
+	"i64": TypeI64,
+	"dbl": TypeDouble,
+	"str": TypeString,
+	"rec": TypeStruct,
+	"map": TypeMap,
+	"set": TypeSet,
+	"lst": TypeList,
+}
+
+// jsonContext tracks the separators needed between the values of a JSON
+// array or object. In an object values alternate between keys and values.
+type jsonContext struct {
+	object bool
+	first  bool
+	colon  bool // next separator is a colon, i.e. the next value is a key
+}
+
+func (c *jsonContext) separator() byte {
+	if c.first {
+		c.first = false
+		c.colon = true
+		return 0
+	}
+	if !c.object {
+		return ','
+	}
+	sep := byte(',')
+	if c.colon {
+		sep = ':'
+	}
+	c.colon = !c.colon
+	return sep
+}
+
+type jsonProtocolWriter struct {
+	w       io.Writer
+	context []jsonContext
+	buf     []byte
+}
+
+type jsonProtocolReader struct {
+	r       io.ByteScanner
+	context []jsonContext
+	buf     []byte
+}
+
+var JSONProtocol = NewProtocolBuilder(NewJSONProtocolReader, NewJSONProtocolWriter)
+
+func NewJSONProtocolWriter(w io.Writer) ProtocolWriter {
+	return &jsonProtocolWriter{
+		w:       w,
+		context: make([]jsonContext, 0, 8),
+		buf:     make([]byte, 0, 64),
+	}
+}
+
+func NewJSONProtocolReader(r io.Reader) ProtocolReader {
+	br, ok := r.(io.ByteScanner)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &jsonProtocolReader{
+		r:       br,
+		context: make([]jsonContext, 0, 8),
+		buf:     make([]byte, 0, 64),
+	}
+}
+
+// begin starts a new value in buf, preceded by the separator required by
+// the current context.
+func (p *jsonProtocolWriter) begin() {
+	p.buf = p.buf[:0]
+	if n := len(p.context); n > 0 {
+		if sep := p.context[n-1].separator(); sep != 0 {
+			p.buf = append(p.buf, sep)
+		}
+	}
+}
+
+// escapeNum reports whether a number must be quoted, which is the case for
+// the keys of objects.
+func (p *jsonProtocolWriter) escapeNum() bool {
+	n := len(p.context)
+	return n > 0 && p.context[n-1].object && p.context[n-1].colon
+}
+
+func (p *jsonProtocolWriter) flush() error {
+	_, err := p.w.Write(p.buf)
+	return err
+}
+
+func (p *jsonProtocolWriter) writeStart(object bool) error {
+	p.begin()
+	if object {
+		p.buf = append(p.buf, '{')
+	} else {
+		p.buf = append(p.buf, '[')
+	}
+	p.context = append(p.context, jsonContext{object: object, first: true})
+	return p.flush()
+}
+
+func (p *jsonProtocolWriter) writeEnd(object bool) error {
+	n := len(p.context)
+	if n == 0 || p.context[n-1].object != object {
+		return ProtocolError{"JSONProtocol", "unbalanced end of object or array"}
+	}
+	p.context = p.context[:n-1]
+	p.buf = p.buf[:0]
+	if object {
+		p.buf = append(p.buf, '}')
+	} else {
+		p.buf = append(p.buf, ']')
+	}
+	return p.flush()
+}
+
+func (p *jsonProtocolWriter) writeInteger(value int64) error {
+	p.begin()
+	quote := p.escapeNum()
+	if quote {
+		p.buf = append(p.buf, '"')
+	}
+	p.buf = strconv.AppendInt(p.buf, value, 10)
+	if quote {
+		p.buf = append(p.buf, '"')
+	}
+	return p.flush()
+}
+
+func (p *jsonProtocolWriter) writeTypeName(t byte) error {
+	name, ok := jsonTypeNames[t]
+	if !ok {
+		return ProtocolError{"JSONProtocol", "unknown type " + strconv.Itoa(int(t))}
+	}
+	return p.WriteString(name)
+}
+
+func (p *jsonProtocolWriter) WriteMessageBegin(name string, messageType byte, seqid int32) error {
+	if err := p.writeStart(false); err != nil {
+		return err
+	}
+	if err := p.writeInteger(jsonProtocolVersion); err != nil {
+		return err
+	}
+	if err := p.WriteString(name); err != nil {
+		return err
+	}
+	if err := p.writeInteger(int64(messageType)); err != nil {
+		return err
+	}
+	return p.writeInteger(int64(seqid))
+}
+
+func (p *jsonProtocolWriter) WriteMessageEnd() error {
+	return p.writeEnd(false)
+}
+
+func (p *jsonProtocolWriter) WriteStructBegin(name string) error {
+	return p.writeStart(true)
+}
+
+func (p *jsonProtocolWriter) WriteStructEnd() error {
+	return p.writeEnd(true)
+}
+
+func (p *jsonProtocolWriter) WriteFieldBegin(name string, fieldType byte, id int16) error {
+	if err := p.writeInteger(int64(id)); err != nil {
+		return err
+	}
+	if err := p.writeStart(true); err != nil {
+		return err
+	}
+	return p.writeTypeName(fieldType)
+}
+
+func (p *jsonProtocolWriter) WriteFieldEnd() error {
+	return p.writeEnd(true)
+}
+
+func (p *jsonProtocolWriter) WriteFieldStop() error {
+	return nil
+}
+
+func (p *jsonProtocolWriter) WriteMapBegin(keyType byte, valueType byte, size int) error {
+	if err := p.writeStart(false); err != nil {
+		return err
+	}
+	if err := p.writeTypeName(keyType); err != nil {
+		return err
+	}
+	if err := p.writeTypeName(valueType); err != nil {
+		return err
+	}
+	if err := p.writeInteger(int64(size)); err != nil {
+		return err
+	}
+	return p.writeStart(true)
+}
+
+func (p *jsonProtocolWriter) WriteMapEnd() error {
+	if err := p.writeEnd(true); err != nil {
+		return err
+	}
+	return p.writeEnd(false)
+}
+
+func (p *jsonProtocolWriter) WriteListBegin(elementType byte, size int) error {
+	if err := p.writeStart(false); err != nil {
+		return err
+	}
+	if err := p.writeTypeName(elementType); err != nil {
+		return err
+	}
+	return p.writeInteger(int64(size))
+}
+
+func (p *jsonProtocolWriter) WriteListEnd() error {
+	return p.writeEnd(false)
+}
+
+func (p *jsonProtocolWriter) WriteSetBegin(elementType byte, size int) error {
+	return p.WriteListBegin(elementType, size)
+}
+
+func (p *jsonProtocolWriter) WriteSetEnd() error {
+	return p.writeEnd(false)
+}
+
+func (p *jsonProtocolWriter) WriteBool(value bool) error {
+	if value {
+		return p.writeInteger(1)
+	}
+	return p.writeInteger(0)
+}
+
+func (p *jsonProtocolWriter) WriteByte(value byte) error {
+	return p.writeInteger(int64(int8(value)))
+}
+
+func (p *jsonProtocolWriter) WriteI16(value int16) error {
+	return p.writeInteger(int64(value))
+}
+
+func (p *jsonProtocolWriter) WriteI32(value int32) error {
+	return p.writeInteger(int64(value))
+}
+
+func (p *jsonProtocolWriter) WriteI64(value int64) error {
+	return p.writeInteger(value)
+}
+
+func (p *jsonProtocolWriter) WriteDouble(value float64) error {
+	p.begin()
+	switch {
+	case math.IsNaN(value):
+		p.buf = append(p.buf, `"NaN"`...)
+	case math.IsInf(value, 1):
+		p.buf = append(p.buf, `"Infinity"`...)
+	case math.IsInf(value, -1):
+		p.buf = append(p.buf, `"-Infinity"`...)
+	default:
+		quote := p.escapeNum()
+		if quote {
+			p.buf = append(p.buf, '"')
+		}
+		p.buf = strconv.AppendFloat(p.buf, value, 'g', -1, 64)
+		if quote {
+			p.buf = append(p.buf, '"')
+		}
+	}
+	return p.flush()
+}
+
+func (p *jsonProtocolWriter) WriteString(value string) error {
+	p.begin()
+	p.buf = appendJSONString(p.buf, value)
+	return p.flush()
+}
+
+// appendJSONString appends the value as a quoted JSON string. Bytes outside
+// of ASCII are copied as is.
+func appendJSONString(buf []byte, value string) []byte {
+	buf = append(buf, '"')
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c >= 0x20:
+			buf = append(buf, c)
+		case c == '\b':
+			buf = append(buf, '\\', 'b')
+		case c == '\f':
+			buf = append(buf, '\\', 'f')
+		case c == '\n':
+			buf = append(buf, '\\', 'n')
+		case c == '\r':
+			buf = append(buf, '\\', 'r')
+		case c == '\t':
+			buf = append(buf, '\\', 't')
+		default:
+			const hex = "0123456789abcdef"
+			buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		}
+	}
+	return append(buf, '"')
+}
+
+// WriteBytes writes the value as a base64 string without padding, as the
+// reference implementation does.
+func (p *jsonProtocolWriter) WriteBytes(value []byte) error {
+	p.begin()
+	n := base64.RawStdEncoding.EncodedLen(len(value))
+	p.buf = append(p.buf, '"')
+	start := len(p.buf)
+	for i := 0; i < n; i++ {
+		p.buf = append(p.buf, 0)
+	}
+	base64.RawStdEncoding.Encode(p.buf[start:], value)
+	p.buf = append(p.buf, '"')
+	return p.flush()
+}
+
+func (p *jsonProtocolReader) readByte() (byte, error) {
+	c, err := p.r.ReadByte()
+	if err == io.EOF && len(p.context) > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return c, err
+}
+
+func (p *jsonProtocolReader) peek() (byte, error) {
+	c, err := p.readByte()
+	if err != nil {
+		return 0, err
+	}
+	return c, p.r.UnreadByte()
+}
+
+func (p *jsonProtocolReader) expect(expected byte) error {
+	c, err := p.readByte()
+	if err != nil {
+		return err
+	}
+	if c != expected {
+		return ProtocolError{"JSONProtocol", "expected '" + string(expected) + "' but found '" + string(c) + "'"}
+	}
+	return nil
+}
+
+// begin consumes the separator that the current context expects before the
+// next value.
+func (p *jsonProtocolReader) begin() error {
+	if n := len(p.context); n > 0 {
+		if sep := p.context[n-1].separator(); sep != 0 {
+			return p.expect(sep)
+		}
+	}
+	return nil
+}
+
+func (p *jsonProtocolReader) escapeNum() bool {
+	n := len(p.context)
+	return n > 0 && p.context[n-1].object && p.context[n-1].colon
+}
+
+func (p *jsonProtocolReader) readStart(object bool) error {
+	if err := p.begin(); err != nil {
+		return err
+	}
+	c := byte('[')
+	if object {
+		c = '{'
+	}
+	if err := p.expect(c); err != nil {
+		return err
+	}
+	p.context = append(p.context, jsonContext{object: object, first: true})
+	return nil
+}
+
+func (p *jsonProtocolReader) readEnd(object bool) error {
+	n := len(p.context)
+	if n == 0 || p.context[n-1].object != object {
+		return ProtocolError{"JSONProtocol", "unbalanced end of object or array"}
+	}
+	c := byte(']')
+	if object {
+		c = '}'
+	}
+	if err := p.expect(c); err != nil {
+		return err
+	}
+	p.context = p.context[:n-1]
+	return nil
+}
+
+// readNumeric reads the characters that can make up a JSON number.
+func (p *jsonProtocolReader) readNumeric() (string, error) {
+	p.buf = p.buf[:0]
+	for {
+		c, err := p.r.ReadByte()
+		if err == io.EOF && len(p.buf) > 0 {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		switch c {
+		case '+', '-', '.', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 'E', 'e':
+			p.buf = append(p.buf, c)
+			continue
+		}
+		if err := p.r.UnreadByte(); err != nil {
+			return "", err
+		}
+		break
+	}
+	if len(p.buf) == 0 {
+		return "", ProtocolError{"JSONProtocol", "expected a number"}
+	}
+	return string(p.buf), nil
+}
+
+func (p *jsonProtocolReader) readInteger(bitSize int) (int64, error) {
+	if err := p.begin(); err != nil {
+		return 0, err
+	}
+	quoted := p.escapeNum()
+	if quoted {
+		if err := p.expect('"'); err != nil {
+			return 0, err
+		}
+	}
+	s, err := p.readNumeric()
+	if err != nil {
+		return 0, err
+	}
+	if quoted {
+		if err := p.expect('"'); err != nil {
+			return 0, err
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, bitSize)
+	if err != nil {
+		return 0, ProtocolError{"JSONProtocol", "invalid integer " + s}
+	}
+	return v, nil
+}
+
+// readJSONString reads a JSON string. It doesn't consume a separator.
+func (p *jsonProtocolReader) readJSONString() ([]byte, error) {
+	if err := p.expect('"'); err != nil {
+		return nil, err
+	}
+	p.buf = p.buf[:0]
+	for {
+		c, err := p.readByte()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c == '"' {
+			return p.buf, nil
+		}
+		if c != '\\' {
+			p.buf = append(p.buf, c)
+			continue
+		}
+		if c, err = p.readByte(); err != nil {
+			return nil, err
+		}
+		switch c {
+		case '"', '\\', '/':
+			p.buf = append(p.buf, c)
+		case 'b':
+			p.buf = append(p.buf, '\b')
+		case 'f':
+			p.buf = append(p.buf, '\f')
+		case 'n':
+			p.buf = append(p.buf, '\n')
+		case 'r':
+			p.buf = append(p.buf, '\r')
+		case 't':
+			p.buf = append(p.buf, '\t')
+		case 'u':
+			r, err := p.readUnicodeEscape()
+			if err != nil {
+				return nil, err
+			}
+			p.buf = append(p.buf, make([]byte, utf8.UTFMax)...)
+			n := utf8.EncodeRune(p.buf[len(p.buf)-utf8.UTFMax:], r)
+			p.buf = p.buf[:len(p.buf)-utf8.UTFMax+n]
+		default:
+			return nil, ProtocolError{"JSONProtocol", "invalid escape character '" + string(c) + "'"}
+		}
+	}
+}
+
+// readUnicodeEscape reads the digits of a \u escape, and of the low
+// surrogate that follows a high surrogate.
+func (p *jsonProtocolReader) readUnicodeEscape() (rune, error) {
+	r, err := p.readHex4()
+	if err != nil || !utf16.IsSurrogate(r) {
+		return r, err
+	}
+	if err := p.expect('\\'); err != nil {
+		return 0, err
+	}
+	if err := p.expect('u'); err != nil {
+		return 0, err
+	}
+	r2, err := p.readHex4()
+	if err != nil {
+		return 0, err
+	}
+	if r = utf16.DecodeRune(r, r2); r == utf8.RuneError {
+		return 0, ProtocolError{"JSONProtocol", "invalid surrogate pair"}
+	}
+	return r, nil
+}
+
+func (p *jsonProtocolReader) readHex4() (rune, error) {
+	var r rune
+	for i := 0; i < 4; i++ {
+		c, err := p.readByte()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c -= 'a' - 10
+		case c >= 'A' && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, ProtocolError{"JSONProtocol", "invalid unicode escape"}
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, nil
+}
+
+func (p *jsonProtocolReader) readTypeName() (byte, error) {
+	name, err := p.ReadString()
+	if err != nil {
+		return 0, err
+	}
+	t, ok := jsonTypeIDs[name]
+	if !ok {
+		return 0, ProtocolError{"JSONProtocol", "unknown type " + name}
+	}
+	return t, nil
+}
+
+func (p *jsonProtocolReader) readSize() (int, error) {
+	size, err := p.readInteger(32)
+	if err == nil && size < 0 {
+		err = ProtocolError{"JSONProtocol", "negative size"}
+	}
+	return int(size), err
+}
+
+func (p *jsonProtocolReader) ReadMessageBegin() (name string, messageType byte, seqid int32, err error) {
+	if err = p.readStart(false); err != nil {
+		return
+	}
+	var v int64
+	if v, err = p.readInteger(64); err != nil {
+		return
+	}
+	if v != jsonProtocolVersion {
+		err = ProtocolError{"JSONProtocol", "bad version in ReadMessageBegin"}
+		return
+	}
+	if name, err = p.ReadString(); err != nil {
+		return
+	}
+	if v, err = p.readInteger(8); err != nil {
+		return
+	}
+	messageType = byte(v)
+	if v, err = p.readInteger(32); err != nil {
+		return
+	}
+	seqid = int32(v)
+	return
+}
+
+func (p *jsonProtocolReader) ReadMessageEnd() error {
+	return p.readEnd(false)
+}
+
+func (p *jsonProtocolReader) ReadStructBegin() error {
+	return p.readStart(true)
+}
+
+func (p *jsonProtocolReader) ReadStructEnd() error {
+	return p.readEnd(true)
+}
+
+func (p *jsonProtocolReader) ReadFieldBegin() (fieldType byte, id int16, err error) {
+	var c byte
+	if c, err = p.peek(); err != nil {
+		return
+	}
+	if c == '}' {
+		fieldType = TypeStop
+		return
+	}
+	var v int64
+	if v, err = p.readInteger(16); err != nil {
+		return
+	}
+	id = int16(v)
+	if err = p.readStart(true); err != nil {
+		return
+	}
+	fieldType, err = p.readTypeName()
+	return
+}
+
+func (p *jsonProtocolReader) ReadFieldEnd() error {
+	return p.readEnd(true)
+}
+
+func (p *jsonProtocolReader) ReadMapBegin() (keyType byte, valueType byte, size int, err error) {
+	if err = p.readStart(false); err != nil {
+		return
+	}
+	if keyType, err = p.readTypeName(); err != nil {
+		return
+	}
+	if valueType, err = p.readTypeName(); err != nil {
+		return
+	}
+	if size, err = p.readSize(); err != nil {
+		return
+	}
+	err = p.readStart(true)
+	return
+}
+
+func (p *jsonProtocolReader) ReadMapEnd() error {
+	if err := p.readEnd(true); err != nil {
+		return err
+	}
+	return p.readEnd(false)
+}
+
+func (p *jsonProtocolReader) ReadListBegin() (elementType byte, size int, err error) {
+	if err = p.readStart(false); err != nil {
+		return
+	}
+	if elementType, err = p.readTypeName(); err != nil {
+		return
+	}
+	size, err = p.readSize()
+	return
+}
+
+func (p *jsonProtocolReader) ReadListEnd() error {
+	return p.readEnd(false)
+}
+
+func (p *jsonProtocolReader) ReadSetBegin() (elementType byte, size int, err error) {
+	return p.ReadListBegin()
+}
+
+func (p *jsonProtocolReader) ReadSetEnd() error {
+	return p.readEnd(false)
+}
+
+func (p *jsonProtocolReader) ReadBool() (bool, error) {
+	v, err := p.readInteger(64)
+	return v != 0, err
+}
+
+func (p *jsonProtocolReader) ReadByte() (byte, error) {
+	v, err := p.readInteger(8)
+	return byte(v), err
+}
+
+func (p *jsonProtocolReader) ReadI16() (int16, error) {
+	v, err := p.readInteger(16)
+	return int16(v), err
+}
+
+func (p *jsonProtocolReader) ReadI32() (int32, error) {
+	v, err := p.readInteger(32)
+	return int32(v), err
+}
+
+func (p *jsonProtocolReader) ReadI64() (int64, error) {
+	return p.readInteger(64)
+}
+
+func (p *jsonProtocolReader) ReadDouble() (float64, error) {
+	if err := p.begin(); err != nil {
+		return 0, err
+	}
+	c, err := p.peek()
+	if err != nil {
+		return 0, err
+	}
+	var s string
+	if c == '"' {
+		b, err := p.readJSONString()
+		if err != nil {
+			return 0, err
+		}
+		s = string(b)
+		switch s {
+		case "NaN":
+			return math.NaN(), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+		if !p.escapeNum() {
+			return 0, ProtocolError{"JSONProtocol", "invalid double " + s}
+		}
+	} else if s, err = p.readNumeric(); err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, ProtocolError{"JSONProtocol", "invalid double " + s}
+	}
+	return v, nil
+}
+
+func (p *jsonProtocolReader) ReadString() (string, error) {
+	if err := p.begin(); err != nil {
+		return "", err
+	}
+	b, err := p.readJSONString()
+	return string(b), err
+}
+
+// ReadBytes reads a base64 string, with or without padding.
+func (p *jsonProtocolReader) ReadBytes() ([]byte, error) {
+	if err := p.begin(); err != nil {
+		return nil, err
+	}
+	b, err := p.readJSONString()
+	if err != nil {
+		return nil, err
+	}
+	for len(b) > 0 && b[len(b)-1] == '=' {
+		b = b[:len(b)-1]
+	}
+	out := make([]byte, base64.RawStdEncoding.DecodedLen(len(b)))
+	n, err := base64.RawStdEncoding.Decode(out, b)
+	if err != nil {
+		return nil, ProtocolError{"JSONProtocol", "invalid base64 data"}
+	}
+	return out[:n], nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"bytes"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestJSONProtocol(t *testing.T) {
+	b := &bytes.Buffer{}
+	testProtocol(t, NewJSONProtocolReader(b), NewJSONProtocolWriter(b))
+}
+
+type jsonTestSub struct {
+	Value int32 `thrift:"1,required"`
+}
+
+type jsonTestStruct struct {
+	Bool     bool               `thrift:"1,required"`
+	Byte     byte               `thrift:"2,required"`
+	I16      int16              `thrift:"3,required"`
+	I32      int32              `thrift:"4,required"`
+	I64      int64              `thrift:"5,required"`
+	Double   float64            `thrift:"6,required"`
+	String   string             `thrift:"7,required"`
+	Binary   []byte             `thrift:"8,required"`
+	List     []string           `thrift:"9,required"`
+	Set      []int32            `thrift:"10,required,set"`
+	Map      map[string]int64   `thrift:"11,required"`
+	IntMap   map[int32]string   `thrift:"12,required"`
+	Struct   *jsonTestSub       `thrift:"13,required"`
+	Specials []float64          `thrift:"14,required"`
+	DblMap   map[float64]bool   `thrift:"15,required"`
+	Nested   map[string][]int16 `thrift:"16,required"`
+}
+
+// Golden encodings as written by Apache Thrift's TJSONProtocol.
+const jsonTestStructGolden = `{"1":{"tf":1},"2":{"i8":-56},"3":{"i16":-300},` +
+	`"4":{"i32":70000},"5":{"i64":-5000000000},"6":{"dbl":1.5},` +
+	`"7":{"str":"a\"b\\c\n\u0001é"},"8":{"str":"AQIDBA"},` +
+	`"9":{"lst":["str",2,"x","y"]},"10":{"set":["i32",2,1,7]},` +
+	`"11":{"map":["str","i64",1,{"k":5}]},"12":{"map":["i32","str",1,{"7":"seven"}]},` +
+	`"13":{"rec":{"1":{"i32":3}}},"14":{"lst":["dbl",3,"NaN","Infinity","-Infinity"]},` +
+	`"15":{"map":["dbl","tf",1,{"0.25":0}]},"16":{"map":["str","lst",1,{"a":["i16",2,1,2]}]}}`
+
+const jsonTestMessageGolden = `[1,"add",1,5,{"1":{"i32":3}}]`
+
+func newJSONTestStruct() *jsonTestStruct {
+	return &jsonTestStruct{
+		Bool:     true,
+		Byte:     200,
+		I16:      -300,
+		I32:      70000,
+		I64:      -5000000000,
+		Double:   1.5,
+		String:   "a\"b\\c\n\x01é",
+		Binary:   []byte{1, 2, 3, 4},
+		List:     []string{"x", "y"},
+		Set:      []int32{1, 7},
+		Map:      map[string]int64{"k": 5},
+		IntMap:   map[int32]string{7: "seven"},
+		Struct:   &jsonTestSub{3},
+		Specials: []float64{math.NaN(), math.Inf(1), math.Inf(-1)},
+		DblMap:   map[float64]bool{0.25: false},
+		Nested:   map[string][]int16{"a": {1, 2}},
+	}
+}
+
+func TestJSONProtocolGolden(t *testing.T) {
+	b := &bytes.Buffer{}
+	if err := EncodeStruct(NewJSONProtocolWriter(b), newJSONTestStruct()); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); s != jsonTestStructGolden {
+		t.Fatalf("Encoded struct does not match golden:\n%s\n%s", s, jsonTestStructGolden)
+	}
+
+	st := &jsonTestStruct{}
+	if err := DecodeStruct(NewJSONProtocolReader(bytes.NewBufferString(jsonTestStructGolden)), st); err != nil {
+		t.Fatal(err)
+	}
+	exp := newJSONTestStruct()
+	for i, v := range st.Specials {
+		if math.IsNaN(v) != math.IsNaN(exp.Specials[i]) || (!math.IsNaN(v) && v != exp.Specials[i]) {
+			t.Fatalf("Decoded special double %d is %f instead of %f", i, v, exp.Specials[i])
+		}
+	}
+	st.Specials, exp.Specials = nil, nil
+	if !reflect.DeepEqual(st, exp) {
+		t.Fatalf("Decoded struct does not match:\n%+v\n%+v", st, exp)
+	}
+}
+
+func TestJSONProtocolMessageGolden(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := NewJSONProtocolWriter(b)
+	if err := w.WriteMessageBegin("add", MessageTypeCall, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeStruct(w, &jsonTestSub{3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteMessageEnd(); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); s != jsonTestMessageGolden {
+		t.Fatalf("Encoded message does not match golden:\n%s\n%s", s, jsonTestMessageGolden)
+	}
+
+	r := NewJSONProtocolReader(b)
+	name, mtype, seq, err := r.ReadMessageBegin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "add" || mtype != MessageTypeCall || seq != 5 {
+		t.Fatalf("Unexpected message header %s %d %d", name, mtype, seq)
+	}
+	st := &jsonTestSub{}
+	if err := DecodeStruct(r, st); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ReadMessageEnd(); err != nil {
+		t.Fatal(err)
+	}
+	if st.Value != 3 {
+		t.Fatalf("Decoded value %d instead of 3", st.Value)
+	}
+}
+
+func TestJSONProtocolReadCompat(t *testing.T) {
+	tests := []struct {
+		in  string
+		str string
+	}{
+		{`"\u00e9\/"`, "é/"},
+		{`"\ud83d\ude00"`, "\U0001F600"},
+		{`"\b\f\r\t"`, "\b\f\r\t"},
+	}
+	for _, test := range tests {
+		s, err := NewJSONProtocolReader(bytes.NewBufferString(test.in)).ReadString()
+		if err != nil {
+			t.Fatalf("ReadString(%s) returned error: %+v", test.in, err)
+		}
+		if s != test.str {
+			t.Fatalf("ReadString(%s) returned %q instead of %q", test.in, s, test.str)
+		}
+	}
+
+	// Some implementations pad base64.
+	for _, in := range []string{`"AQIDBA"`, `"AQIDBA=="`} {
+		b, err := NewJSONProtocolReader(bytes.NewBufferString(in)).ReadBytes()
+		if err != nil {
+			t.Fatalf("ReadBytes(%s) returned error: %+v", in, err)
+		}
+		if !bytes.Equal(b, []byte{1, 2, 3, 4}) {
+			t.Fatalf("ReadBytes(%s) returned %v", in, b)
+		}
+	}
+
+	if _, _, _, err := NewJSONProtocolReader(bytes.NewBufferString(`[2,"add",1,5,{}]`)).ReadMessageBegin(); err == nil {
+		t.Fatal("Expected an error for an unsupported version")
+	}
+}
+
+func TestJSONProtocolRPC(t *testing.T) {
+	srv := &Server{
+		Processor: &testProcessor{},
+	}
+	cli, conn := net.Pipe()
+	go srv.ServeTransport(NewTransport(conn, JSONProtocol))
+
+	c := NewNativeClient(NewTransport(cli, JSONProtocol), false)
+	defer c.Close()
+	expectEcho(t, c, 123, 123)
+}
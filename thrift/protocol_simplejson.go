@@ -0,0 +1,334 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SimpleJSONBinaryEncoding selects how the simple JSON writer encodes binary values.
+type SimpleJSONBinaryEncoding int
+
+const (
+	// SimpleJSONBinaryBase64 encodes binary values as padded standard base64 strings.
+	SimpleJSONBinaryBase64 SimpleJSONBinaryEncoding = iota
+	// SimpleJSONBinaryHex encodes binary values as lowercase hex strings.
+	SimpleJSONBinaryHex
+	// SimpleJSONBinaryString encodes binary values as text, replacing invalid UTF-8.
+	SimpleJSONBinaryString
+)
+
+// SimpleJSONOptions configures the output of a simple JSON writer.
+type SimpleJSONOptions struct {
+	// SortMapKeys writes the entries of maps ordered by key, numerically for
+	// numeric keys, so that the output of equal values is identical.
+	SortMapKeys    bool
+	BinaryEncoding SimpleJSONBinaryEncoding
+}
+
+// The simple JSON writer produces JSON meant to be read by people and
+// generic tools, in the style of TSimpleJSONProtocol: structs are objects
+// keyed by field name, lists and sets are arrays, maps are objects keyed by
+// the string form of their keys and messages are ["name",type,seqid,{struct}].
+// Type information is lost so there is no matching reader.
+type simpleJSONProtocolWriter struct {
+	w       io.Writer
+	opts    SimpleJSONOptions
+	context []jsonContext
+	maps    []*simpleJSONMap // maps being buffered to sort them, innermost last
+	buf     []byte
+}
+
+type simpleJSONMap struct {
+	depth   int // len(context) inside the map
+	keyType byte
+	entries []simpleJSONEntry
+}
+
+type simpleJSONEntry struct {
+	key  string // key as written, quotes included
+	data []byte // key, colon and value
+}
+
+// NewSimpleJSONProtocolWriter returns a ProtocolWriter that writes simple JSON.
+// Any of the ProtocolWriter methods, and so EncodeStruct, may be used.
+func NewSimpleJSONProtocolWriter(w io.Writer, opts SimpleJSONOptions) ProtocolWriter {
+	return &simpleJSONProtocolWriter{
+		w:       w,
+		opts:    opts,
+		context: make([]jsonContext, 0, 8),
+		buf:     make([]byte, 0, 64),
+	}
+}
+
+// sortedMap returns the map being sorted whose entries are written directly
+// in the current context, if any.
+func (p *simpleJSONProtocolWriter) sortedMap() *simpleJSONMap {
+	if n := len(p.maps); n > 0 && p.maps[n-1].depth == len(p.context) {
+		return p.maps[n-1]
+	}
+	return nil
+}
+
+// begin starts a new value in buf, preceded by the separator required by
+// the current context. Entries of sorted maps are separated when the map
+// ends instead.
+func (p *simpleJSONProtocolWriter) begin() {
+	p.buf = p.buf[:0]
+	n := len(p.context)
+	if n == 0 {
+		return
+	}
+	sep := p.context[n-1].separator()
+	if m := p.sortedMap(); m != nil && sep != ':' {
+		m.entries = append(m.entries, simpleJSONEntry{})
+		return
+	}
+	if sep != 0 {
+		p.buf = append(p.buf, sep)
+	}
+}
+
+// inKey reports whether the value being written is the key of an object.
+func (p *simpleJSONProtocolWriter) inKey() bool {
+	n := len(p.context)
+	return n > 0 && p.context[n-1].object && p.context[n-1].colon
+}
+
+// nextIsKey reports whether the next value written is the key of an object.
+func (p *simpleJSONProtocolWriter) nextIsKey() bool {
+	n := len(p.context)
+	return n > 0 && p.context[n-1].object && (p.context[n-1].first || !p.context[n-1].colon)
+}
+
+func (p *simpleJSONProtocolWriter) flush() error {
+	if n := len(p.maps); n > 0 {
+		m := p.maps[n-1]
+		e := &m.entries[len(m.entries)-1]
+		if m.depth == len(p.context) && p.inKey() {
+			e.key = string(p.buf)
+		}
+		e.data = append(e.data, p.buf...)
+		return nil
+	}
+	_, err := p.w.Write(p.buf)
+	return err
+}
+
+// writeScalar writes a value that isn't a string, quoting it when used as
+// a key.
+func (p *simpleJSONProtocolWriter) writeScalar(value []byte) error {
+	p.begin()
+	quote := p.inKey()
+	if quote {
+		p.buf = append(p.buf, '"')
+	}
+	p.buf = append(p.buf, value...)
+	if quote {
+		p.buf = append(p.buf, '"')
+	}
+	return p.flush()
+}
+
+func (p *simpleJSONProtocolWriter) writeStart(object bool) error {
+	if p.nextIsKey() {
+		return ProtocolError{"SimpleJSONProtocol", "map keys must be scalar values"}
+	}
+	p.begin()
+	if object {
+		p.buf = append(p.buf, '{')
+	} else {
+		p.buf = append(p.buf, '[')
+	}
+	p.context = append(p.context, jsonContext{object: object, first: true})
+	return p.flush()
+}
+
+func (p *simpleJSONProtocolWriter) writeEnd(object bool) error {
+	n := len(p.context)
+	if n == 0 || p.context[n-1].object != object {
+		return ProtocolError{"SimpleJSONProtocol", "unbalanced end of object or array"}
+	}
+	p.context = p.context[:n-1]
+	p.buf = p.buf[:0]
+	if object {
+		p.buf = append(p.buf, '}')
+	} else {
+		p.buf = append(p.buf, ']')
+	}
+	return p.flush()
+}
+
+func (p *simpleJSONProtocolWriter) writeString(value string) error {
+	if !utf8.ValidString(value) {
+		value = strings.ToValidUTF8(value, string(utf8.RuneError))
+	}
+	p.begin()
+	p.buf = appendJSONString(p.buf, value)
+	return p.flush()
+}
+
+func (p *simpleJSONProtocolWriter) WriteMessageBegin(name string, messageType byte, seqid int32) error {
+	if err := p.writeStart(false); err != nil {
+		return err
+	}
+	if err := p.writeString(name); err != nil {
+		return err
+	}
+	if err := p.WriteByte(messageType); err != nil {
+		return err
+	}
+	return p.WriteI32(seqid)
+}
+
+func (p *simpleJSONProtocolWriter) WriteMessageEnd() error {
+	return p.writeEnd(false)
+}
+
+func (p *simpleJSONProtocolWriter) WriteStructBegin(name string) error {
+	return p.writeStart(true)
+}
+
+func (p *simpleJSONProtocolWriter) WriteStructEnd() error {
+	return p.writeEnd(true)
+}
+
+// WriteFieldBegin writes the name of the field, or its ID when it has none.
+func (p *simpleJSONProtocolWriter) WriteFieldBegin(name string, fieldType byte, id int16) error {
+	if name == "" {
+		name = strconv.Itoa(int(id))
+	}
+	return p.writeString(name)
+}
+
+func (p *simpleJSONProtocolWriter) WriteFieldEnd() error {
+	return nil
+}
+
+func (p *simpleJSONProtocolWriter) WriteFieldStop() error {
+	return nil
+}
+
+func (p *simpleJSONProtocolWriter) WriteMapBegin(keyType byte, valueType byte, size int) error {
+	if !p.opts.SortMapKeys {
+		return p.writeStart(true)
+	}
+	if p.nextIsKey() {
+		return ProtocolError{"SimpleJSONProtocol", "map keys must be scalar values"}
+	}
+	// Only the separator is written now, the entries once they're sorted.
+	p.begin()
+	if err := p.flush(); err != nil {
+		return err
+	}
+	p.context = append(p.context, jsonContext{object: true, first: true})
+	p.maps = append(p.maps, &simpleJSONMap{depth: len(p.context), keyType: keyType})
+	return nil
+}
+
+func (p *simpleJSONProtocolWriter) WriteMapEnd() error {
+	m := p.sortedMap()
+	if m == nil {
+		return p.writeEnd(true)
+	}
+	p.maps = p.maps[:len(p.maps)-1]
+	p.context = p.context[:len(p.context)-1]
+
+	switch m.keyType {
+	case TypeByte, TypeI16, TypeI32, TypeI64, TypeDouble:
+		sort.SliceStable(m.entries, func(i, j int) bool {
+			a, _ := strconv.ParseFloat(strings.Trim(m.entries[i].key, `"`), 64)
+			b, _ := strconv.ParseFloat(strings.Trim(m.entries[j].key, `"`), 64)
+			return a < b
+		})
+	default:
+		sort.SliceStable(m.entries, func(i, j int) bool {
+			return m.entries[i].key < m.entries[j].key
+		})
+	}
+
+	p.buf = append(p.buf[:0], '{')
+	for i, e := range m.entries {
+		if i > 0 {
+			p.buf = append(p.buf, ',')
+		}
+		p.buf = append(p.buf, e.data...)
+	}
+	p.buf = append(p.buf, '}')
+	return p.flush()
+}
+
+func (p *simpleJSONProtocolWriter) WriteListBegin(elementType byte, size int) error {
+	return p.writeStart(false)
+}
+
+func (p *simpleJSONProtocolWriter) WriteListEnd() error {
+	return p.writeEnd(false)
+}
+
+func (p *simpleJSONProtocolWriter) WriteSetBegin(elementType byte, size int) error {
+	return p.writeStart(false)
+}
+
+func (p *simpleJSONProtocolWriter) WriteSetEnd() error {
+	return p.writeEnd(false)
+}
+
+func (p *simpleJSONProtocolWriter) WriteBool(value bool) error {
+	return p.writeScalar(strconv.AppendBool(nil, value))
+}
+
+func (p *simpleJSONProtocolWriter) WriteByte(value byte) error {
+	return p.WriteI64(int64(int8(value)))
+}
+
+func (p *simpleJSONProtocolWriter) WriteI16(value int16) error {
+	return p.WriteI64(int64(value))
+}
+
+func (p *simpleJSONProtocolWriter) WriteI32(value int32) error {
+	return p.WriteI64(int64(value))
+}
+
+func (p *simpleJSONProtocolWriter) WriteI64(value int64) error {
+	var b [20]byte
+	return p.writeScalar(strconv.AppendInt(b[:0], value, 10))
+}
+
+// WriteDouble writes NaN and infinities, which JSON numbers can't represent,
+// as the strings "NaN", "Infinity" and "-Infinity".
+func (p *simpleJSONProtocolWriter) WriteDouble(value float64) error {
+	switch {
+	case math.IsNaN(value):
+		return p.writeString("NaN")
+	case math.IsInf(value, 1):
+		return p.writeString("Infinity")
+	case math.IsInf(value, -1):
+		return p.writeString("-Infinity")
+	}
+	var b [32]byte
+	return p.writeScalar(strconv.AppendFloat(b[:0], value, 'g', -1, 64))
+}
+
+func (p *simpleJSONProtocolWriter) WriteString(value string) error {
+	return p.writeString(value)
+}
+
+func (p *simpleJSONProtocolWriter) WriteBytes(value []byte) error {
+	switch p.opts.BinaryEncoding {
+	case SimpleJSONBinaryHex:
+		return p.writeString(hex.EncodeToString(value))
+	case SimpleJSONBinaryString:
+		return p.writeString(string(value))
+	}
+	return p.writeString(base64.StdEncoding.EncodeToString(value))
+}
@@ -0,0 +1,112 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+type simpleJSONTestStruct struct {
+	Name    string                      `thrift:"1,required"`
+	Enabled bool                        `thrift:"2,required"`
+	Data    []byte                      `thrift:"3,required"`
+	Tags    []string                    `thrift:"4,required"`
+	Counts  map[int32]string            `thrift:"5,required"`
+	Nested  map[string]map[string]int16 `thrift:"6,required"`
+	Sub     *jsonTestSub                `thrift:"7,required"`
+	Flags   map[bool]float64            `thrift:"8,required"`
+}
+
+func newSimpleJSONTestStruct() *simpleJSONTestStruct {
+	return &simpleJSONTestStruct{
+		Name:    "a\"b\n\xff",
+		Enabled: true,
+		Data:    []byte("hi\x00"),
+		Tags:    []string{"x", "y"},
+		Counts:  map[int32]string{10: "ten", 9: "nine", -1: "minus one"},
+		Nested:  map[string]map[string]int16{"b": {"z": 1, "y": 2}, "a": {}},
+		Sub:     &jsonTestSub{3},
+		Flags:   map[bool]float64{true: 0.5, false: -2},
+	}
+}
+
+func TestSimpleJSONProtocolSorted(t *testing.T) {
+	expected := `{"Name":"a\"b\n�","Enabled":true,"Data":"aGkA","Tags":["x","y"],` +
+		`"Counts":{"-1":"minus one","9":"nine","10":"ten"},` +
+		`"Nested":{"a":{},"b":{"y":2,"z":1}},"Sub":{"Value":3},` +
+		`"Flags":{"false":-2,"true":0.5}}`
+
+	// Map iteration order is random, so encode a few times.
+	for i := 0; i < 10; i++ {
+		b := &bytes.Buffer{}
+		w := NewSimpleJSONProtocolWriter(b, SimpleJSONOptions{SortMapKeys: true})
+		if err := EncodeStruct(w, newSimpleJSONTestStruct()); err != nil {
+			t.Fatal(err)
+		}
+		if s := b.String(); s != expected {
+			t.Fatalf("Simple JSON output does not match:\n%s\n%s", s, expected)
+		}
+	}
+}
+
+func TestSimpleJSONProtocolValid(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := NewSimpleJSONProtocolWriter(b, SimpleJSONOptions{})
+	if err := w.WriteMessageBegin("log", MessageTypeCall, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeStruct(w, newSimpleJSONTestStruct()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteMessageEnd(); err != nil {
+		t.Fatal(err)
+	}
+	var v []interface{}
+	if err := json.Unmarshal(b.Bytes(), &v); err != nil {
+		t.Fatalf("Simple JSON output is not valid JSON: %s\n%s", err, b.String())
+	}
+	if len(v) != 4 || v[0] != "log" || v[1] != float64(MessageTypeCall) || v[2] != float64(7) {
+		t.Fatalf("Unexpected message %+v", v)
+	}
+	st := v[3].(map[string]interface{})
+	if counts := st["Counts"].(map[string]interface{}); counts["10"] != "ten" || len(counts) != 3 {
+		t.Fatalf("Unexpected map %+v", counts)
+	}
+}
+
+func TestSimpleJSONProtocolBinary(t *testing.T) {
+	tests := []struct {
+		encoding SimpleJSONBinaryEncoding
+		out      string
+	}{
+		{SimpleJSONBinaryBase64, `"aGkA/w=="`},
+		{SimpleJSONBinaryHex, `"686900ff"`},
+		{SimpleJSONBinaryString, `"hi\u0000�"`},
+	}
+	for _, test := range tests {
+		b := &bytes.Buffer{}
+		w := NewSimpleJSONProtocolWriter(b, SimpleJSONOptions{BinaryEncoding: test.encoding})
+		if err := w.WriteBytes([]byte("hi\x00\xff")); err != nil {
+			t.Fatal(err)
+		}
+		if s := b.String(); s != test.out {
+			t.Fatalf("Binary encoding %d wrote %s instead of %s", test.encoding, s, test.out)
+		}
+	}
+}
+
+func TestSimpleJSONProtocolStructKeys(t *testing.T) {
+	for _, sorted := range []bool{false, true} {
+		w := NewSimpleJSONProtocolWriter(&bytes.Buffer{}, SimpleJSONOptions{SortMapKeys: sorted})
+		if err := w.WriteMapBegin(TypeStruct, TypeI32, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteStructBegin("key"); err == nil {
+			t.Fatal("Expected an error for a struct map key")
+		}
+	}
+}
@@ -5,22 +5,101 @@
 package thrift
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"strconv"
+	"strings"
 )
 
 var (
 	ErrUnimplemented = errors.New("thrift: unimplemented")
 )
 
+// The text protocol is a human readable format meant for fixtures, test
+// inputs and debugging, in the spirit of the protobuf text format:
+//
+//	message "add" call 1
+//	AddRequest {
+//		1: i32 A = 3
+//		2: list Tags = list<string>[
+//			"x",
+//		]
+//		3: map Counts = map<string,i64>{
+//			"a": 1,
+//		}
+//		4: struct Opts = Options {
+//			1: bool Verbose = true
+//		}
+//	}
+//
+// Fields are "id: type [name] = value" using the names of TypeNames, and
+// container values repeat their element types since those are only known
+// once the value is read. Struct and field names are optional on input.
+// Strings and binary values are Go quoted strings, doubles may be nan, inf
+// or -inf, and # starts a comment. Containers carry no size: the reader
+// counts their elements ahead, and accepts a trailing comma.
+
+var TextProtocol = NewProtocolBuilder(NewTextProtocolReader, NewTextProtocolWriter)
+
+var textMessageTypeNames = map[byte]string{
+	MessageTypeCall:      "call",
+	MessageTypeReply:     "reply",
+	MessageTypeException: "exception",
+	MessageTypeOneway:    "oneway",
+}
+
+func textTypeName(t byte) (string, error) {
+	name, ok := TypeNames[int(t)]
+	if !ok || t == TypeStop || t == TypeVoid {
+		return "", ProtocolError{"TextProtocol", fmt.Sprintf("unknown type %d", t)}
+	}
+	return name, nil
+}
+
+func textTypeID(name string) (byte, bool) {
+	switch name {
+	case "binary":
+		return TypeString, true
+	case "i8":
+		return TypeByte, true
+	}
+	for t, n := range TypeNames {
+		if n == name && t != TypeStop && t != TypeVoid {
+			return byte(t), true
+		}
+	}
+	return 0, false
+}
+
+const (
+	textTop = iota
+	textField
+	textList
+	textMap
+)
+
+// textContext is where a value is being written or read.
+type textContext struct {
+	kind  int
+	empty bool // the container has no elements
+	first bool // no element has been read yet
+	key   bool // the next map value is a key
+}
+
 type textProtocolWriter struct {
 	w           io.Writer
 	indentation string
+	context     []textContext
 }
 
 func NewTextProtocolWriter(w io.Writer) ProtocolWriter {
-	return &textProtocolWriter{w: w}
+	return &textProtocolWriter{
+		w:       w,
+		context: []textContext{{kind: textTop}},
+	}
 }
 
 func (p *textProtocolWriter) indent() {
@@ -31,199 +110,814 @@ func (p *textProtocolWriter) unindent() {
 	p.indentation = p.indentation[:len(p.indentation)-1]
 }
 
-func (p *textProtocolWriter) WriteMessageBegin(name string, messageType byte, seqid int32) error {
-	fmt.Fprintf(p.w, "%sMessageBegin(%s, %d, %.8x)\n", p.indentation, name, messageType, seqid)
-	p.indent()
+func (p *textProtocolWriter) top() *textContext {
+	return &p.context[len(p.context)-1]
+}
+
+func (p *textProtocolWriter) push(c textContext) {
+	p.context = append(p.context, c)
+}
+
+func (p *textProtocolWriter) pop() error {
+	if len(p.context) == 1 {
+		return ProtocolError{"TextProtocol", "unbalanced end of struct or container"}
+	}
+	p.context = p.context[:len(p.context)-1]
 	return nil
 }
 
+// writeValue writes a value with what precedes and follows it in the
+// current context.
+func (p *textProtocolWriter) writeValue(s string) error {
+	if err := p.beginValue(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(p.w, s); err != nil {
+		return err
+	}
+	return p.endValue()
+}
+
+func (p *textProtocolWriter) beginValue() error {
+	c := p.top()
+	var prefix string
+	switch c.kind {
+	case textList:
+		prefix = p.indentation
+	case textMap:
+		if c.key {
+			prefix = p.indentation
+		} else {
+			prefix = ": "
+		}
+	}
+	_, err := io.WriteString(p.w, prefix)
+	return err
+}
+
+func (p *textProtocolWriter) endValue() error {
+	c := p.top()
+	suffix := "\n"
+	switch c.kind {
+	case textList:
+		suffix = ",\n"
+	case textMap:
+		if c.key {
+			suffix = ""
+		} else {
+			suffix = ",\n"
+		}
+		c.key = !c.key
+	case textField:
+		// The field is done, back to the struct.
+		p.context = p.context[:len(p.context)-1]
+	}
+	_, err := io.WriteString(p.w, suffix)
+	return err
+}
+
+func (p *textProtocolWriter) WriteMessageBegin(name string, messageType byte, seqid int32) error {
+	mtype, ok := textMessageTypeNames[messageType]
+	if !ok {
+		mtype = strconv.Itoa(int(messageType))
+	}
+	_, err := fmt.Fprintf(p.w, "%smessage %s %s %d\n", p.indentation, strconv.Quote(name), mtype, seqid)
+	return err
+}
+
 func (p *textProtocolWriter) WriteMessageEnd() error {
-	p.unindent()
-	fmt.Fprintf(p.w, "%sMessageEnd()\n", p.indentation)
 	return nil
 }
 
 func (p *textProtocolWriter) WriteStructBegin(name string) error {
-	fmt.Fprintf(p.w, "%sStructBegin(%s)\n", p.indentation, name)
+	if err := p.beginValue(); err != nil {
+		return err
+	}
+	if name != "" {
+		name += " "
+	}
+	if _, err := io.WriteString(p.w, name+"{\n"); err != nil {
+		return err
+	}
+	p.push(textContext{kind: textTop})
 	p.indent()
 	return nil
 }
 
 func (p *textProtocolWriter) WriteStructEnd() error {
+	if err := p.pop(); err != nil {
+		return err
+	}
 	p.unindent()
-	fmt.Fprintf(p.w, "%sStructEnd()\n", p.indentation)
-	return nil
+	if _, err := io.WriteString(p.w, p.indentation+"}"); err != nil {
+		return err
+	}
+	return p.endValue()
 }
 
 func (p *textProtocolWriter) WriteFieldBegin(name string, fieldType byte, id int16) error {
-	fmt.Fprintf(p.w, "%sFieldBegin(%s, %d, %d)\n", p.indentation, name, fieldType, id)
-	p.indent()
-	return nil
+	typeName, err := textTypeName(fieldType)
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		typeName += " " + name
+	}
+	p.push(textContext{kind: textField})
+	_, err = fmt.Fprintf(p.w, "%s%d: %s = ", p.indentation, id, typeName)
+	return err
 }
 
 func (p *textProtocolWriter) WriteFieldEnd() error {
-	p.unindent()
-	fmt.Fprintf(p.w, "%sFieldEnd()\n", p.indentation)
 	return nil
 }
 
 func (p *textProtocolWriter) WriteFieldStop() error {
-	fmt.Fprintf(p.w, "%sFieldStop()\n", p.indentation)
 	return nil
 }
 
-func (p *textProtocolWriter) WriteMapBegin(keyType byte, valueType byte, size int) error {
-	fmt.Fprintf(p.w, "%sMapBegin(%d, %d, %d)\n", p.indentation, keyType, valueType, size)
+func (p *textProtocolWriter) writeContainerBegin(kind int, header string, size int) error {
+	if err := p.beginValue(); err != nil {
+		return err
+	}
+	open := "["
+	if kind == textMap {
+		open = "{"
+	}
+	if size > 0 {
+		open += "\n"
+	}
+	if _, err := io.WriteString(p.w, header+open); err != nil {
+		return err
+	}
+	p.push(textContext{kind: kind, empty: size == 0, key: true})
 	p.indent()
 	return nil
 }
 
-func (p *textProtocolWriter) WriteMapEnd() error {
+func (p *textProtocolWriter) writeContainerEnd(kind int) error {
+	c := *p.top()
+	if c.kind != kind {
+		return ProtocolError{"TextProtocol", "unbalanced end of container"}
+	}
+	if err := p.pop(); err != nil {
+		return err
+	}
 	p.unindent()
-	fmt.Fprintf(p.w, "%sMapEnd()\n", p.indentation)
-	return nil
+	end := "]"
+	if kind == textMap {
+		end = "}"
+	}
+	if !c.empty {
+		end = p.indentation + end
+	}
+	if _, err := io.WriteString(p.w, end); err != nil {
+		return err
+	}
+	return p.endValue()
+}
+
+func (p *textProtocolWriter) WriteMapBegin(keyType byte, valueType byte, size int) error {
+	kt, err := textTypeName(keyType)
+	if err != nil {
+		return err
+	}
+	vt, err := textTypeName(valueType)
+	if err != nil {
+		return err
+	}
+	return p.writeContainerBegin(textMap, "map<"+kt+","+vt+">", size)
+}
+
+func (p *textProtocolWriter) WriteMapEnd() error {
+	return p.writeContainerEnd(textMap)
 }
 
 func (p *textProtocolWriter) WriteListBegin(elementType byte, size int) error {
-	fmt.Fprintf(p.w, "%sListBegin(%d, %d)\n", p.indentation, elementType, size)
-	p.indent()
-	return nil
+	et, err := textTypeName(elementType)
+	if err != nil {
+		return err
+	}
+	return p.writeContainerBegin(textList, "list<"+et+">", size)
 }
 
 func (p *textProtocolWriter) WriteListEnd() error {
-	p.unindent()
-	fmt.Fprintf(p.w, "%sListEnd()\n", p.indentation)
-	return nil
+	return p.writeContainerEnd(textList)
 }
 
 func (p *textProtocolWriter) WriteSetBegin(elementType byte, size int) error {
-	fmt.Fprintf(p.w, "%sSetBegin(%d, %d)\n", p.indentation, elementType, size)
-	p.indent()
-	return nil
+	et, err := textTypeName(elementType)
+	if err != nil {
+		return err
+	}
+	return p.writeContainerBegin(textList, "set<"+et+">", size)
 }
 
 func (p *textProtocolWriter) WriteSetEnd() error {
-	p.unindent()
-	fmt.Fprintf(p.w, "%sSetEnd()\n", p.indentation)
-	return nil
+	return p.writeContainerEnd(textList)
 }
 
 func (p *textProtocolWriter) WriteBool(value bool) error {
-	fmt.Fprintf(p.w, "%sBool(%+v)\n", p.indentation, value)
-	return nil
+	return p.writeValue(strconv.FormatBool(value))
 }
 
 func (p *textProtocolWriter) WriteByte(value byte) error {
-	fmt.Fprintf(p.w, "%sByte(%d)\n", p.indentation, value)
-	return nil
+	return p.writeValue(strconv.Itoa(int(int8(value))))
 }
 
 func (p *textProtocolWriter) WriteI16(value int16) error {
-	fmt.Fprintf(p.w, "%sI16(%d)\n", p.indentation, value)
-	return nil
+	return p.writeValue(strconv.Itoa(int(value)))
 }
 
 func (p *textProtocolWriter) WriteI32(value int32) error {
-	fmt.Fprintf(p.w, "%sI32(%d)\n", p.indentation, value)
-	return nil
+	return p.writeValue(strconv.Itoa(int(value)))
 }
 
 func (p *textProtocolWriter) WriteI64(value int64) error {
-	fmt.Fprintf(p.w, "%sI64(%d)\n", p.indentation, value)
-	return nil
+	return p.writeValue(strconv.FormatInt(value, 10))
 }
 
 func (p *textProtocolWriter) WriteDouble(value float64) error {
-	fmt.Fprintf(p.w, "%sDouble(%f)\n", p.indentation, value)
-	return nil
+	var s string
+	switch {
+	case math.IsNaN(value):
+		s = "nan"
+	case math.IsInf(value, 1):
+		s = "inf"
+	case math.IsInf(value, -1):
+		s = "-inf"
+	default:
+		s = strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return p.writeValue(s)
 }
 
 func (p *textProtocolWriter) WriteString(value string) error {
-	fmt.Fprintf(p.w, "%sString(%s)\n", p.indentation, value)
-	return nil
+	return p.writeValue(strconv.Quote(value))
 }
 
 func (p *textProtocolWriter) WriteBytes(value []byte) error {
-	fmt.Fprintf(p.w, "%sBytes(%+v)\n", p.indentation, value)
-	return nil
-}
-
-func (p *textProtocolWriter) ReadMessageBegin() (name string, messageType byte, seqid int32, err error) {
-	return "", 0, 0, ErrUnimplemented
+	return p.writeValue(strconv.Quote(string(value)))
 }
 
-func (p *textProtocolWriter) ReadMessageEnd() error {
-	return ErrUnimplemented
-}
+const (
+	textTokenEOF = iota
+	textTokenIdent
+	textTokenNumber
+	textTokenString
+	textTokenPunct
+)
 
-func (p *textProtocolWriter) ReadStructBegin() error {
-	return ErrUnimplemented
+type textToken struct {
+	kind int
+	text string
+	line int
+}
+
+func (t textToken) String() string {
+	if t.kind == textTokenEOF {
+		return "end of input"
+	}
+	return strconv.Quote(t.text)
+}
+
+type textProtocolReader struct {
+	r       io.ByteScanner
+	line    int
+	tokens  []textToken // tokens read ahead
+	context []textContext
+}
+
+func NewTextProtocolReader(r io.Reader) ProtocolReader {
+	br, ok := r.(io.ByteScanner)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &textProtocolReader{
+		r:       br,
+		line:    1,
+		context: []textContext{{kind: textTop}},
+	}
+}
+
+func (p *textProtocolReader) errorf(t textToken, format string, args ...interface{}) error {
+	return ProtocolError{"TextProtocol", fmt.Sprintf("line %d: ", t.line) + fmt.Sprintf(format, args...)}
+}
+
+func isTextIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// scan reads the next token from the input.
+func (p *textProtocolReader) scan() (textToken, error) {
+	var c byte
+	var err error
+	for {
+		if c, err = p.r.ReadByte(); err == io.EOF {
+			return textToken{kind: textTokenEOF, line: p.line}, nil
+		} else if err != nil {
+			return textToken{}, err
+		}
+		if c == '#' {
+			for c != '\n' {
+				if c, err = p.r.ReadByte(); err == io.EOF {
+					return textToken{kind: textTokenEOF, line: p.line}, nil
+				} else if err != nil {
+					return textToken{}, err
+				}
+			}
+		}
+		if c == '\n' {
+			p.line++
+		} else if c != ' ' && c != '\t' && c != '\r' {
+			break
+		}
+	}
+
+	tok := textToken{line: p.line}
+	buf := []byte{c}
+	switch {
+	case c == '"' || c == '`':
+		quote := c
+		for {
+			if c, err = p.r.ReadByte(); err != nil {
+				if err == io.EOF {
+					err = p.errorf(tok, "unterminated string")
+				}
+				return tok, err
+			}
+			buf = append(buf, c)
+			if c == '\n' {
+				p.line++
+			}
+			if c == quote {
+				break
+			}
+			if c == '\\' && quote == '"' {
+				if c, err = p.r.ReadByte(); err != nil {
+					if err == io.EOF {
+						err = p.errorf(tok, "unterminated string")
+					}
+					return tok, err
+				}
+				buf = append(buf, c)
+			}
+		}
+		s, err := strconv.Unquote(string(buf))
+		if err != nil {
+			return tok, p.errorf(tok, "invalid string %s", buf)
+		}
+		tok.kind = textTokenString
+		tok.text = s
+		return tok, nil
+	case c == '-' || c == '+' || c >= '0' && c <= '9':
+		tok.kind = textTokenNumber
+	case isTextIdentChar(c):
+		tok.kind = textTokenIdent
+	default:
+		tok.kind = textTokenPunct
+		tok.text = string(c)
+		return tok, nil
+	}
+	for {
+		if c, err = p.r.ReadByte(); err == io.EOF {
+			break
+		} else if err != nil {
+			return tok, err
+		}
+		if !isTextIdentChar(c) && !(tok.kind == textTokenNumber && (c == '-' || c == '+')) {
+			if err := p.r.UnreadByte(); err != nil {
+				return tok, err
+			}
+			break
+		}
+		buf = append(buf, c)
+	}
+	tok.text = string(buf)
+	return tok, nil
+}
+
+// peek returns the token n positions ahead without consuming it.
+func (p *textProtocolReader) peek(n int) (textToken, error) {
+	for len(p.tokens) <= n {
+		t, err := p.scan()
+		if err != nil {
+			return t, err
+		}
+		p.tokens = append(p.tokens, t)
+		if t.kind == textTokenEOF {
+			// Any further token is the end of input as well.
+			for len(p.tokens) <= n {
+				p.tokens = append(p.tokens, t)
+			}
+		}
+	}
+	return p.tokens[n], nil
+}
+
+func (p *textProtocolReader) next() (textToken, error) {
+	t, err := p.peek(0)
+	if err == nil {
+		p.tokens = p.tokens[1:]
+	}
+	return t, err
+}
+
+func (p *textProtocolReader) isPunct(t textToken, punct string) bool {
+	return t.kind == textTokenPunct && t.text == punct
+}
+
+func (p *textProtocolReader) expect(kind int, text string) (textToken, error) {
+	t, err := p.next()
+	if err != nil {
+		return t, err
+	}
+	if t.kind != kind || (text != "" && t.text != text) {
+		want := text
+		switch {
+		case want != "":
+			want = strconv.Quote(want)
+		case kind == textTokenIdent:
+			want = "a name"
+		case kind == textTokenNumber:
+			want = "a number"
+		case kind == textTokenString:
+			want = "a string"
+		}
+		return t, p.errorf(t, "expected %s but found %s", want, t)
+	}
+	return t, nil
+}
+
+// beginValue consumes the separator that precedes a value in the current
+// context.
+func (p *textProtocolReader) beginValue() error {
+	c := &p.context[len(p.context)-1]
+	switch c.kind {
+	case textList:
+		if !c.first {
+			if _, err := p.expect(textTokenPunct, ","); err != nil {
+				return err
+			}
+		}
+		c.first = false
+	case textMap:
+		if !c.key {
+			if _, err := p.expect(textTokenPunct, ":"); err != nil {
+				return err
+			}
+		} else if !c.first {
+			if _, err := p.expect(textTokenPunct, ","); err != nil {
+				return err
+			}
+		}
+		c.first = false
+		c.key = !c.key
+	case textField:
+		p.context = p.context[:len(p.context)-1]
+	}
+	return nil
 }
 
-func (p *textProtocolWriter) ReadStructEnd() error {
-	return ErrUnimplemented
+func (p *textProtocolReader) readType() (byte, error) {
+	t, err := p.expect(textTokenIdent, "")
+	if err != nil {
+		return 0, err
+	}
+	typ, ok := textTypeID(t.text)
+	if !ok {
+		return 0, p.errorf(t, "unknown type %s", t)
+	}
+	return typ, nil
+}
+
+// countElements counts the elements of the container about to be read, up
+// to the bracket that closes it.
+func (p *textProtocolReader) countElements() (int, error) {
+	depth := 0
+	count := 0
+	start := true // the next token at depth 0 starts an element
+	for i := 0; ; i++ {
+		t, err := p.peek(i)
+		if err != nil {
+			return 0, err
+		}
+		if t.kind == textTokenEOF {
+			return 0, p.errorf(t, "unterminated container")
+		}
+		isPunct := t.kind == textTokenPunct
+		if depth == 0 {
+			if isPunct && (t.text == "]" || t.text == "}" || t.text == ">") {
+				return count, nil
+			}
+			if isPunct && t.text == "," {
+				start = true
+				continue
+			}
+			if start {
+				count++
+				start = false
+			}
+		}
+		if isPunct {
+			switch t.text {
+			case "[", "{", "<":
+				depth++
+			case "]", "}", ">":
+				depth--
+			}
+		}
+	}
+}
+
+func (p *textProtocolReader) readContainerBegin(kind int, name string) (elementType byte, valueType byte, size int, err error) {
+	if err = p.beginValue(); err != nil {
+		return
+	}
+	var t textToken
+	if t, err = p.expect(textTokenIdent, ""); err != nil {
+		return
+	}
+	if t.text != name && !(name == "list" && t.text == "set") && !(name == "set" && t.text == "list") {
+		err = p.errorf(t, "expected %s but found %s", name, t)
+		return
+	}
+	if _, err = p.expect(textTokenPunct, "<"); err != nil {
+		return
+	}
+	if elementType, err = p.readType(); err != nil {
+		return
+	}
+	if kind == textMap {
+		if _, err = p.expect(textTokenPunct, ","); err != nil {
+			return
+		}
+		if valueType, err = p.readType(); err != nil {
+			return
+		}
+	}
+	if _, err = p.expect(textTokenPunct, ">"); err != nil {
+		return
+	}
+	open := "["
+	if kind == textMap {
+		open = "{"
+	}
+	if _, err = p.expect(textTokenPunct, open); err != nil {
+		return
+	}
+	if size, err = p.countElements(); err != nil {
+		return
+	}
+	p.context = append(p.context, textContext{kind: kind, first: true, key: true})
+	return
+}
+
+func (p *textProtocolReader) readContainerEnd(kind int) error {
+	if c := p.context[len(p.context)-1]; c.kind != kind {
+		return ProtocolError{"TextProtocol", "unbalanced end of container"}
+	}
+	p.context = p.context[:len(p.context)-1]
+	t, err := p.peek(0)
+	if err != nil {
+		return err
+	}
+	if p.isPunct(t, ",") {
+		p.next()
+	}
+	end := "]"
+	if kind == textMap {
+		end = "}"
+	}
+	_, err = p.expect(textTokenPunct, end)
+	return err
+}
+
+func (p *textProtocolReader) readScalar(kind int) (textToken, error) {
+	if err := p.beginValue(); err != nil {
+		return textToken{}, err
+	}
+	return p.expect(kind, "")
+}
+
+func (p *textProtocolReader) readInt(bitSize int) (int64, error) {
+	t, err := p.readScalar(textTokenNumber)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(t.text, 0, bitSize)
+	if err != nil {
+		return 0, p.errorf(t, "invalid i%d %s", bitSize, t)
+	}
+	return v, nil
+}
+
+func (p *textProtocolReader) ReadMessageBegin() (name string, messageType byte, seqid int32, err error) {
+	var t textToken
+	if t, err = p.next(); err != nil {
+		return
+	}
+	if t.kind == textTokenEOF {
+		err = io.EOF
+		return
+	}
+	if t.kind != textTokenIdent || t.text != "message" {
+		err = p.errorf(t, "expected \"message\" but found %s", t)
+		return
+	}
+	if t, err = p.expect(textTokenString, ""); err != nil {
+		return
+	}
+	name = t.text
+	if t, err = p.next(); err != nil {
+		return
+	}
+	found := false
+	for mt, n := range textMessageTypeNames {
+		if t.text == n {
+			messageType = mt
+			found = true
+		}
+	}
+	if !found {
+		v, e := strconv.ParseUint(t.text, 0, 8)
+		if e != nil {
+			err = p.errorf(t, "invalid message type %s", t)
+			return
+		}
+		messageType = byte(v)
+	}
+	if t, err = p.expect(textTokenNumber, ""); err != nil {
+		return
+	}
+	var v int64
+	if v, err = strconv.ParseInt(t.text, 0, 32); err != nil {
+		err = p.errorf(t, "invalid sequence ID %s", t)
+		return
+	}
+	seqid = int32(v)
+	return
+}
+
+func (p *textProtocolReader) ReadMessageEnd() error {
+	return nil
 }
 
-func (p *textProtocolWriter) ReadFieldBegin() (fieldType byte, id int16, err error) {
-	return 0, 0, ErrUnimplemented
+func (p *textProtocolReader) ReadStructBegin() error {
+	if err := p.beginValue(); err != nil {
+		return err
+	}
+	t, err := p.peek(0)
+	if err != nil {
+		return err
+	}
+	if t.kind == textTokenIdent {
+		p.next()
+	}
+	if _, err := p.expect(textTokenPunct, "{"); err != nil {
+		return err
+	}
+	p.context = append(p.context, textContext{kind: textTop})
+	return nil
 }
 
-func (p *textProtocolWriter) ReadFieldEnd() error {
-	return ErrUnimplemented
+func (p *textProtocolReader) ReadStructEnd() error {
+	if len(p.context) == 1 {
+		return ProtocolError{"TextProtocol", "unbalanced end of struct"}
+	}
+	p.context = p.context[:len(p.context)-1]
+	_, err := p.expect(textTokenPunct, "}")
+	return err
+}
+
+func (p *textProtocolReader) ReadFieldBegin() (fieldType byte, id int16, err error) {
+	var t textToken
+	if t, err = p.peek(0); err != nil {
+		return
+	}
+	if p.isPunct(t, "}") {
+		fieldType = TypeStop
+		return
+	}
+	if t, err = p.expect(textTokenNumber, ""); err != nil {
+		return
+	}
+	var v int64
+	if v, err = strconv.ParseInt(t.text, 0, 16); err != nil {
+		err = p.errorf(t, "invalid field ID %s", t)
+		return
+	}
+	id = int16(v)
+	if _, err = p.expect(textTokenPunct, ":"); err != nil {
+		return
+	}
+	if fieldType, err = p.readType(); err != nil {
+		return
+	}
+	// The field name is optional.
+	if t, err = p.peek(0); err != nil {
+		return
+	}
+	if t.kind == textTokenIdent {
+		p.next()
+	}
+	if _, err = p.expect(textTokenPunct, "="); err != nil {
+		return
+	}
+	p.context = append(p.context, textContext{kind: textField})
+	return
+}
+
+func (p *textProtocolReader) ReadFieldEnd() error {
+	return nil
 }
 
-func (p *textProtocolWriter) ReadMapBegin() (keyType byte, valueType byte, size int, err error) {
-	return 0, 0, 0, ErrUnimplemented
+func (p *textProtocolReader) ReadMapBegin() (keyType byte, valueType byte, size int, err error) {
+	return p.readContainerBegin(textMap, "map")
 }
 
-func (p *textProtocolWriter) ReadMapEnd() error {
-	return ErrUnimplemented
+func (p *textProtocolReader) ReadMapEnd() error {
+	return p.readContainerEnd(textMap)
 }
 
-func (p *textProtocolWriter) ReadListBegin() (elementType byte, size int, err error) {
-	return 0, 0, ErrUnimplemented
+func (p *textProtocolReader) ReadListBegin() (elementType byte, size int, err error) {
+	elementType, _, size, err = p.readContainerBegin(textList, "list")
+	return
 }
 
-func (p *textProtocolWriter) ReadListEnd() error {
-	return ErrUnimplemented
+func (p *textProtocolReader) ReadListEnd() error {
+	return p.readContainerEnd(textList)
 }
 
-func (p *textProtocolWriter) ReadSetBegin() (elementType byte, size int, err error) {
-	return 0, 0, ErrUnimplemented
+func (p *textProtocolReader) ReadSetBegin() (elementType byte, size int, err error) {
+	elementType, _, size, err = p.readContainerBegin(textList, "set")
+	return
 }
 
-func (p *textProtocolWriter) ReadSetEnd() error {
-	return ErrUnimplemented
+func (p *textProtocolReader) ReadSetEnd() error {
+	return p.readContainerEnd(textList)
 }
 
-func (p *textProtocolWriter) ReadBool() (bool, error) {
-	return false, ErrUnimplemented
+func (p *textProtocolReader) ReadBool() (bool, error) {
+	t, err := p.readScalar(textTokenIdent)
+	if err != nil {
+		return false, err
+	}
+	switch t.text {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, p.errorf(t, "invalid bool %s", t)
 }
 
-func (p *textProtocolWriter) ReadByte() (byte, error) {
-	return 0, ErrUnimplemented
+func (p *textProtocolReader) ReadByte() (byte, error) {
+	v, err := p.readInt(8)
+	return byte(v), err
 }
 
-func (p *textProtocolWriter) ReadI16() (int16, error) {
-	return 0, ErrUnimplemented
+func (p *textProtocolReader) ReadI16() (int16, error) {
+	v, err := p.readInt(16)
+	return int16(v), err
 }
 
-func (p *textProtocolWriter) ReadI32() (int32, error) {
-	return 0, ErrUnimplemented
+func (p *textProtocolReader) ReadI32() (int32, error) {
+	v, err := p.readInt(32)
+	return int32(v), err
 }
 
-func (p *textProtocolWriter) ReadI64() (int64, error) {
-	return 0, ErrUnimplemented
+func (p *textProtocolReader) ReadI64() (int64, error) {
+	return p.readInt(64)
 }
 
-func (p *textProtocolWriter) ReadDouble() (float64, error) {
-	return 0.0, ErrUnimplemented
+func (p *textProtocolReader) ReadDouble() (float64, error) {
+	if err := p.beginValue(); err != nil {
+		return 0, err
+	}
+	t, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	if t.kind != textTokenNumber && t.kind != textTokenIdent {
+		return 0, p.errorf(t, "expected a double but found %s", t)
+	}
+	v, err := strconv.ParseFloat(strings.ToLower(t.text), 64)
+	if err != nil {
+		return 0, p.errorf(t, "invalid double %s", t)
+	}
+	return v, nil
 }
 
-func (p *textProtocolWriter) ReadString() (string, error) {
-	return "", ErrUnimplemented
+func (p *textProtocolReader) ReadString() (string, error) {
+	t, err := p.readScalar(textTokenString)
+	return t.text, err
 }
 
-func (p *textProtocolWriter) ReadBytes() ([]byte, error) {
-	return nil, ErrUnimplemented
+func (p *textProtocolReader) ReadBytes() ([]byte, error) {
+	t, err := p.readScalar(textTokenString)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(t.text), nil
 }
@@ -0,0 +1,166 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTextProtocol(t *testing.T) {
+	b := &bytes.Buffer{}
+	testProtocol(t, NewTextProtocolReader(b), NewTextProtocolWriter(b))
+}
+
+const textTestStructGolden = `message "add" call 5
+jsonTestStruct {
+	1: bool Bool = true
+	2: byte Byte = -56
+	3: i16 I16 = -300
+	4: i32 I32 = 70000
+	5: i64 I64 = -5000000000
+	6: double Double = 1.5
+	7: string String = "a\"b\\c\n\x01é"
+	8: string Binary = "\x01\x02\x03\x04"
+	9: list List = list<string>[
+		"x",
+		"y",
+	]
+	10: set Set = set<i32>[
+		1,
+		7,
+	]
+	11: map Map = map<string,i64>{
+		"k": 5,
+	}
+	12: map IntMap = map<i32,string>{
+		7: "seven",
+	}
+	13: struct Struct = jsonTestSub {
+		1: i32 Value = 3
+	}
+	14: list Specials = list<double>[
+		nan,
+		inf,
+		-inf,
+	]
+	15: map DblMap = map<double,bool>{
+		0.25: false,
+	}
+	16: map Nested = map<string,list>{
+		"a": list<i16>[
+			1,
+			2,
+		],
+	}
+}
+`
+
+func TestTextProtocolRoundTrip(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := NewTextProtocolWriter(b)
+	if err := w.WriteMessageBegin("add", MessageTypeCall, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeStruct(w, newJSONTestStruct()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteMessageEnd(); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); s != textTestStructGolden {
+		t.Fatalf("Text output does not match golden:\n%s\n%s", s, textTestStructGolden)
+	}
+
+	r := NewTextProtocolReader(b)
+	name, mtype, seq, err := r.ReadMessageBegin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "add" || mtype != MessageTypeCall || seq != 5 {
+		t.Fatalf("Unexpected message header %s %d %d", name, mtype, seq)
+	}
+	st := &jsonTestStruct{}
+	if err := DecodeStruct(r, st); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ReadMessageEnd(); err != nil {
+		t.Fatal(err)
+	}
+	exp := newJSONTestStruct()
+	if !math.IsNaN(st.Specials[0]) || !math.IsInf(st.Specials[1], 1) || !math.IsInf(st.Specials[2], -1) {
+		t.Fatalf("Decoded special doubles %v", st.Specials)
+	}
+	st.Specials, exp.Specials = nil, nil
+	if !reflect.DeepEqual(st, exp) {
+		t.Fatalf("Decoded struct does not match:\n%+v\n%+v", st, exp)
+	}
+	if _, _, _, err := r.ReadMessageBegin(); err != io.EOF {
+		t.Fatalf("Expected io.EOF at the end of input, got %+v", err)
+	}
+}
+
+type textTestStruct struct {
+	String string             `thrift:"7"`
+	List   []string           `thrift:"9"`
+	Set    []int32            `thrift:"10,set"`
+	IntMap map[int32]string   `thrift:"12"`
+	Struct *jsonTestSub       `thrift:"13"`
+	Nested map[string][]int16 `thrift:"16"`
+}
+
+// Hand written input may leave out names and trailing commas, and have comments.
+func TestTextProtocolHandWritten(t *testing.T) {
+	in := `
+# A fixture.
+{
+	9: list = list<string>["x", "y"]  # no trailing comma
+	10: set = set<i32>[1, 7,]
+	12: map = map<i32, string>{7: "seven"}
+	13: struct = {
+		1: i32 = 0x3
+	}
+	16: map = map<string, list>{"a": list<i16>[1, 2], "b": list<i16>[]}
+	7: string = ` + "`raw`" + `
+}
+`
+	st := &textTestStruct{}
+	if err := DecodeStruct(NewTextProtocolReader(strings.NewReader(in)), st); err != nil {
+		t.Fatal(err)
+	}
+	exp := &textTestStruct{
+		String: "raw",
+		List:   []string{"x", "y"},
+		Set:    []int32{1, 7},
+		IntMap: map[int32]string{7: "seven"},
+		Struct: &jsonTestSub{3},
+		Nested: map[string][]int16{"a": {1, 2}, "b": nil},
+	}
+	if !reflect.DeepEqual(st, exp) {
+		t.Fatalf("Decoded struct does not match:\n%+v\n%+v", st, exp)
+	}
+}
+
+func TestTextProtocolErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"{\n\t12: map = map<i32,string>{\"x\": \"y\"}\n}", "line 2: expected a number"},
+		{"{\n\t1: float = 1\n}", "line 2: unknown type \"float\""},
+		{"{\n\t9: list = list<string>[\"x\" \"y\"]\n}", "line 2: expected \"]\" but found \"y\""},
+		{"{\n\t9: list = list<string>[\"x\",\n", "line 3: unterminated container"},
+	}
+	for _, test := range tests {
+		err := DecodeStruct(NewTextProtocolReader(strings.NewReader(test.in)), &textTestStruct{})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected error containing %q for %q, got %+v", test.err, test.in, err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"time"
+)
+
+type idempotent interface {
+	Idempotent() bool
+}
+
+// Caller makes RPC calls. Client, Pool, ContextClient, RetryClient and
+// MiddlewareClient implement it.
+type Caller interface {
+	CallContext(ctx context.Context, method string, request interface{}, response interface{}) error
+}
+
+// RetryPolicy says how to retry the failed calls of a method.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a call is made at most, including
+	// the first one. Calls aren't retried when it's less than 2.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the time to wait before making a call
+	// again, which doubles with every attempt and is randomly shortened by
+	// up to half. They default to 10ms and 1s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Retryable reports whether a call that failed with err may succeed if
+	// made again. When nil IsTransient is used.
+	Retryable func(err error) bool
+}
+
+// RetryClient is an RPC client that makes the calls failing with a
+// retryable error again through Client, according to the policy of their
+// method. It implements the RPCClient and ContextRPCClient interfaces of
+// generated code.
+//
+// Only calls whose request reports Idempotent() == true are retried, as the
+// requests of methods annotated with (idempotent = "true") in the IDL do,
+// since a call that failed may still have been processed by the server.
+// Client should be able to recover from a broken connection, as a Pool does.
+type RetryClient struct {
+	Client Caller
+	// Policy is the policy of the methods missing from Methods.
+	Policy RetryPolicy
+	// Methods holds the policies of specific methods by Thrift method name.
+	Methods map[string]RetryPolicy
+}
+
+// Call invokes the named function and returns its error status, as
+// Client.Call does, retrying it on failure.
+func (c *RetryClient) Call(method string, request interface{}, response interface{}) error {
+	return c.CallContext(context.Background(), method, request, response)
+}
+
+// CallContext is like Call but stops retrying when ctx is done, in which
+// case ctx.Err() is returned.
+func (c *RetryClient) CallContext(ctx context.Context, method string, request interface{}, response interface{}) error {
+	policy, ok := c.Methods[method]
+	if !ok {
+		policy = c.Policy
+	}
+	err := c.Client.CallContext(ctx, method, request, response)
+	if err == nil || policy.MaxAttempts < 2 {
+		return err
+	}
+	if i, ok := request.(idempotent); !ok || !i.Idempotent() {
+		return err
+	}
+
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+	backoff, maxBackoff := policy.MinBackoff, policy.MaxBackoff
+	if backoff <= 0 {
+		backoff = 10 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = time.Second
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	for attempt := 1; attempt < policy.MaxAttempts && retryable(err); attempt++ {
+		t := time.NewTimer(jitter(backoff))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		// Don't let a response partially decoded by the failed attempt
+		// leak into the next one.
+		resetResponse(response)
+		err = c.Client.CallContext(ctx, method, request, response)
+	}
+	return err
+}
+
+func resetResponse(response interface{}) {
+	v := reflect.ValueOf(response)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
+
+// IsTransient reports whether a call that failed with err may succeed if
+// made again: when the connection is broken or couldn't be made, when a
+// peer sent a frame too big, and when the server failed with an
+// ApplicationException of type ExceptionInternalError or
+// ExceptionLoadShedding.
+func IsTransient(err error) bool {
+	switch e := err.(type) {
+	case *ApplicationException:
+		return e.Type == ExceptionInternalError || e.Type == ExceptionLoadShedding
+	case ErrFrameTooBig:
+		return true
+	case net.Error:
+		return true
+	}
+	switch err {
+	case ErrShutdown, ErrNoConnection, io.EOF, io.ErrUnexpectedEOF, io.ErrClosedPipe:
+		return true
+	}
+	return false
+}
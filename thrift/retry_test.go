@@ -0,0 +1,177 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type TestIdempotentRequest struct {
+	Value int32 `thrift:"1,required"`
+}
+
+func (req *TestIdempotentRequest) Idempotent() bool {
+	return true
+}
+
+// flakyCaller fails the first calls with the errors in errs.
+type flakyCaller struct {
+	errs  []error
+	calls int
+}
+
+func (c *flakyCaller) CallContext(ctx context.Context, method string, request interface{}, response interface{}) error {
+	c.calls++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		response.(*TestResponse).Value = -1
+		return err
+	}
+	response.(*TestResponse).Value = 1
+	return nil
+}
+
+var internalError = &ApplicationException{"failed", ExceptionInternalError}
+
+func TestRetryClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		request interface{}
+		errs    []error
+		err     error
+		calls   int
+	}{
+		{"success", &TestIdempotentRequest{}, nil, nil, 1},
+		{"retried", &TestIdempotentRequest{}, []error{io.EOF, internalError}, nil, 3},
+		{"too many failures", &TestIdempotentRequest{}, []error{io.EOF, io.EOF, ErrShutdown}, ErrShutdown, 3},
+		{"not idempotent", &TestRequest{}, []error{io.EOF}, io.EOF, 1},
+		{"not transient", &TestIdempotentRequest{}, []error{ProtocolError{"Test", "bad"}}, ProtocolError{"Test", "bad"}, 1},
+	}
+	for _, test := range tests {
+		caller := &flakyCaller{errs: test.errs}
+		c := &RetryClient{
+			Client: caller,
+			Policy: RetryPolicy{MaxAttempts: 3, MinBackoff: time.Microsecond},
+		}
+		res := &TestResponse{}
+		err := c.Call("echo", test.request, res)
+		if err != test.err {
+			t.Errorf("%s: expected error %+v, got %+v", test.name, test.err, err)
+		}
+		if caller.calls != test.calls {
+			t.Errorf("%s: expected %d calls, got %d", test.name, test.calls, caller.calls)
+		}
+		if err == nil && res.Value != 1 {
+			t.Errorf("%s: expected response 1, got %d", test.name, res.Value)
+		}
+	}
+}
+
+func TestRetryClientMethodPolicy(t *testing.T) {
+	caller := &flakyCaller{errs: []error{io.EOF, io.EOF}}
+	c := &RetryClient{
+		Client:  caller,
+		Policy:  RetryPolicy{MaxAttempts: 5, MinBackoff: time.Microsecond},
+		Methods: map[string]RetryPolicy{"once": {MaxAttempts: 1}},
+	}
+	if err := c.Call("once", &TestIdempotentRequest{}, &TestResponse{}); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got %+v", err)
+	}
+	if caller.calls != 1 {
+		t.Fatalf("Expected 1 call, got %d", caller.calls)
+	}
+
+	retryable := func(err error) bool { return err == io.EOF }
+	c.Methods["custom"] = RetryPolicy{MaxAttempts: 5, MinBackoff: time.Microsecond, Retryable: retryable}
+	if err := c.Call("custom", &TestIdempotentRequest{}, &TestResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if caller.calls != 3 {
+		t.Fatalf("Expected 3 calls, got %d", caller.calls)
+	}
+}
+
+func TestRetryClientContext(t *testing.T) {
+	caller := &flakyCaller{errs: []error{io.EOF, io.EOF}}
+	c := &RetryClient{
+		Client: caller,
+		Policy: RetryPolicy{MaxAttempts: 3, MinBackoff: time.Hour, MaxBackoff: time.Hour},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.CallContext(ctx, "echo", &TestIdempotentRequest{}, &TestResponse{}); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %+v", err)
+	}
+	if caller.calls != 1 {
+		t.Fatalf("Expected 1 call, got %d", caller.calls)
+	}
+}
+
+func TestRetryClientPool(t *testing.T) {
+	failures := 1
+	proc := &funcProcessor{
+		"echo": {
+			NewRequest:  func() interface{} { return &TestIdempotentRequest{} },
+			NewResponse: func() interface{} { return &TestResponse{} },
+			Call: func(req, res interface{}) error {
+				if failures > 0 {
+					failures--
+					return errors.New("failed")
+				}
+				res.(*TestResponse).Value = req.(*TestIdempotentRequest).Value
+				return nil
+			},
+		},
+	}
+	e := newPipeEndpoints(map[string]Processor{"a": proc})
+	p := NewPool([]string{"a"}, &PoolOptions{Dial: e.dial})
+	defer p.Close()
+	c := &RetryClient{Client: p, Policy: RetryPolicy{MaxAttempts: 2, MinBackoff: time.Microsecond}}
+
+	res := &TestResponse{}
+	if err := c.Call("echo", &TestIdempotentRequest{42}, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != 42 {
+		t.Fatalf("Expected 42, got %d", res.Value)
+	}
+}
+
+type funcProcessor map[string]ProcessorMethod
+
+func (p *funcProcessor) ProcessorMethods() map[string]ProcessorMethod {
+	return *p
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{io.EOF, true},
+		{io.ErrUnexpectedEOF, true},
+		{ErrShutdown, true},
+		{ErrNoConnection, true},
+		{ErrFrameTooBig{100, 10}, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, true},
+		{internalError, true},
+		{&ApplicationException{"busy", ExceptionLoadShedding}, true},
+		{&ApplicationException{"no", ExceptionUnknownMethod}, false},
+		{ErrOnewayNotEnabled, false},
+		{context.Canceled, false},
+		{errors.New("other"), false},
+	}
+	for _, test := range tests {
+		if got := IsTransient(test.err); got != test.transient {
+			t.Errorf("IsTransient(%+v) = %v, expected %v", test.err, got, test.transient)
+		}
+	}
+}
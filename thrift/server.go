@@ -5,99 +5,597 @@
 package thrift
 
 import (
+	"context"
 	"errors"
 	"io"
-	"net/rpc"
-	"strings"
+	"io/ioutil"
+	"net"
 	"sync"
+	"time"
 )
 
-type serverCodec struct {
-	conn       Transport
-	nameCache  map[string]string // incoming name -> registered name
-	methodName map[uint64]string // sequence ID -> method name
-	mu         sync.Mutex
+// shutdownLinger bounds the time Shutdown waits for a client to hang up
+// after reading the last responses of its connection.
+const shutdownLinger = time.Second
+
+// ErrServerClosed is returned by the Serve and ServeTransport methods of a
+// Server after a call to Shutdown or Close.
+var ErrServerClosed = errors.New("thrift: server closed")
+
+// ProcessorMethod describes how to handle requests for one method of a
+// service. NewRequest and NewResponse return empty request and response
+// structs for the method, NewResponse being nil for one-way methods. Call
+// invokes the method with values previously returned by them.
+//
+// CallContext, when set, is used instead of Call and also gets the context
+// of the request as passed on by Server.Middleware. The server cancels it
+// when the connection is closed, by the client, Close or Shutdown once its
+// ctx is done, but not while Shutdown waits for the request to complete.
+type ProcessorMethod struct {
+	NewRequest  func() interface{}
+	NewResponse func() interface{}
+	Call        func(request, response interface{}) error
+	CallContext func(ctx context.Context, request, response interface{}) error
+}
+
+func (m ProcessorMethod) call(ctx context.Context, request, response interface{}) error {
+	if m.CallContext != nil {
+		return m.CallContext(ctx, request, response)
+	}
+	return m.Call(request, response)
 }
 
-// ServeConn runs the Thrift RPC server on a single connection. ServeConn blocks,
-// serving the connection until the client hangs up. The caller typically invokes
-// ServeConn in a go statement.
-func ServeConn(conn Transport) {
-	rpc.ServeCodec(NewServerCodec(conn))
+// Processor is implemented by the generated <Service>Server types. It maps
+// the Thrift method names of a service, including those of the services it
+// extends, to their handlers.
+type Processor interface {
+	ProcessorMethods() map[string]ProcessorMethod
 }
 
-// NewServerCodec returns a new rpc.ServerCodec using Thrift RPC on conn using the specified protocol.
-func NewServerCodec(conn Transport) rpc.ServerCodec {
-	return &serverCodec{
-		conn:       conn,
-		nameCache:  make(map[string]string, 8),
-		methodName: make(map[uint64]string, 8),
+// Server is a Thrift RPC server that dispatches requests to a Processor.
+// Requests on a connection are handled concurrently and their responses
+// written as they complete, matched to requests by sequence ID.
+type Server struct {
+	Processor Processor
+	// NewTransport wraps accepted connections, which it gets wrapped by the
+	// server to watch reads during Shutdown. When nil framed binary protocol
+	// is used.
+	NewTransport func(conn net.Conn) Transport
+	// Middleware runs around the handling of every request, in order. The
+	// method is named as in the request, "Service:method" for multiplexed
+	// requests.
+	Middleware []Middleware
+
+	// MaxConcurrentRequests limits the number of requests handled at the
+	// same time by the server. Requests beyond it are answered right away
+	// with Overload. Zero means no limit.
+	MaxConcurrentRequests int
+	// MaxConnRequests limits the number of requests handled at the same time
+	// on each connection, the others waiting for their turn. A waiting
+	// request already counts towards MaxConcurrentRequests, so that it's
+	// rejected right away when the server is busy. Zero means no limit.
+	MaxConnRequests int
+	// MaxPendingRequests limits the number of requests read from each
+	// connection and not answered yet. Once it's reached the server stops
+	// reading from the connection until a response is sent, which makes
+	// clients pipelining requests wait. Zero means no limit.
+	MaxPendingRequests int
+	// Overload is sent in response to the requests rejected because of
+	// MaxConcurrentRequests. When nil an ApplicationException of type
+	// ExceptionLoadShedding is sent.
+	Overload *ApplicationException
+
+	mu         sync.Mutex // protects following
+	listeners  map[net.Listener]struct{}
+	conns      map[*serverConn]struct{}
+	inShutdown bool
+	drained    chan struct{} // closed once conns is empty after Shutdown
+	running    int           // number of requests being handled
+}
+
+// Serve accepts connections on the listener and serves each one in a new
+// goroutine. It returns the error that made Accept fail, or ErrServerClosed
+// after Shutdown or Close, which close the listener.
+func (s *Server) Serve(ln net.Listener) error {
+	if !s.trackListener(ln, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(ln, false)
+
+	methods := s.Processor.ProcessorMethods()
+	var delay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		raw := &serverNetConn{Conn: conn, srv: s}
+		go s.serve(methods, s.transport(raw), raw)
 	}
 }
 
-func (c *serverCodec) ReadRequestHeader(request *rpc.Request) error {
-	name, messageType, seq, err := c.conn.ReadMessageBegin()
-	if err != nil {
-		return err
+// ServeTransport serves requests on a single connection. It blocks until the
+// client hangs up or the connection fails, waits for the pending requests to
+// complete and closes the connection. A clean hang up returns nil, and
+// ErrServerClosed is returned when the connection is closed by Shutdown or
+// Close.
+func (s *Server) ServeTransport(conn Transport) error {
+	return s.serve(s.Processor.ProcessorMethods(), conn, nil)
+}
+
+// Shutdown gracefully shuts down the server: it closes the listeners and
+// stops reading requests from the connections, then closes each connection
+// once the requests already read from it are answered, and returns when all
+// of them are closed. When ctx is done first the remaining connections are
+// closed without waiting and ctx.Err() is returned.
+//
+// Connections accepted by Serve stop reading at the end of the request being
+// received, if any part of one has arrived, and are closed once the client
+// has read the responses.
+// Connections given to ServeTransport are closed right away when idle, and
+// otherwise once the request they read next is answered.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.inShutdown = true
+	for ln := range s.listeners {
+		ln.Close()
+		delete(s.listeners, ln)
+	}
+	for sc := range s.conns {
+		sc.stopReading()
+	}
+	if s.drained == nil {
+		s.drained = make(chan struct{})
+		if len(s.conns) == 0 {
+			close(s.drained)
+		}
+	}
+	drained := s.drained
+	s.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	for sc := range s.conns {
+		sc.close()
+	}
+	s.mu.Unlock()
+	return ctx.Err()
+}
+
+// Close immediately closes the listeners and connections of the server.
+// Requests being handled can't send their response.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inShutdown = true
+	var err error
+	for ln := range s.listeners {
+		if cerr := ln.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(s.listeners, ln)
+	}
+	for sc := range s.conns {
+		sc.close()
 	}
-	if messageType != MessageTypeCall { // Currently don't support one way
-		return errors.New("thrift: expected Call message type")
+	return err
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inShutdown
+}
+
+// trackListener adds ln to the listeners closed on shutdown or removes it.
+// It reports false if the server is already shutting down.
+func (s *Server) trackListener(ln net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.listeners, ln)
+		return true
 	}
+	if s.inShutdown {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[ln] = struct{}{}
+	return true
+}
 
-	// TODO: should use a limited size cache for the nameCache to avoid a possible
-	//       memory overflow from nefarious or broken clients
-	newName := c.nameCache[name]
-	if newName == "" {
-		newName = CamelCase(name)
-		if !strings.ContainsRune(newName, '.') {
-			newName = "Thrift." + newName
+// trackConn adds sc to the connections closed on shutdown or removes it. It
+// reports false if the server is already shutting down.
+func (s *Server) trackConn(sc *serverConn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.conns, sc)
+		if s.drained != nil && len(s.conns) == 0 {
+			select {
+			case <-s.drained:
+			default:
+				close(s.drained)
+			}
 		}
-		c.nameCache[name] = newName
+		return true
+	}
+	if s.inShutdown {
+		return false
 	}
+	if s.conns == nil {
+		s.conns = make(map[*serverConn]struct{})
+	}
+	s.conns[sc] = struct{}{}
+	return true
+}
 
-	c.mu.Lock()
-	c.methodName[uint64(seq)] = name
-	c.mu.Unlock()
+// acquire reserves one of the MaxConcurrentRequests slots for a request. It
+// reports false if there's none left.
+func (s *Server) acquire() bool {
+	if s.MaxConcurrentRequests <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running >= s.MaxConcurrentRequests {
+		return false
+	}
+	s.running++
+	return true
+}
 
-	request.ServiceMethod = newName
-	request.Seq = uint64(seq)
+// release gives back a slot reserved by acquire.
+func (s *Server) release() {
+	if s.MaxConcurrentRequests <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.running--
+	s.mu.Unlock()
+}
 
-	return nil
+// done records that a request read from sc has been answered.
+func (s *Server) done(sc *serverConn) {
+	if sc.pending != nil {
+		<-sc.pending
+	}
+	s.setActive(sc, -1)
 }
 
-func (c *serverCodec) ReadRequestBody(thriftStruct interface{}) error {
-	if thriftStruct == nil {
-		if err := SkipValue(c.conn, TypeStruct); err != nil {
-			return err
+// begin records that sc started reading a request. It reports false if the
+// connection has been closed in the meantime.
+func (s *Server) begin(sc *serverConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sc.closed {
+		return false
+	}
+	sc.active++
+	sc.reading = true
+	return true
+}
+
+// received records that bytes of a request arrived on sc.
+func (s *Server) received(sc *serverConn) {
+	s.mu.Lock()
+	sc.reading = true
+	s.mu.Unlock()
+}
+
+// resume reports whether reading sc should go on after the read deadline set
+// by Shutdown expired, as a request is being received. The deadline is then
+// removed.
+func (s *Server) resume(sc *serverConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !sc.stopped || !sc.reading || sc.closed {
+		return false
+	}
+	sc.raw.SetReadDeadline(time.Time{})
+	return true
+}
+
+// end records that sc finished reading a request. It reports whether it's
+// the last one to read as the server is shutting down.
+func (s *Server) end(sc *serverConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc.reading = false
+	if s.inShutdown {
+		sc.stopped = true
+	}
+	return sc.stopped
+}
+
+// setActive adds delta to the number of requests being handled on sc. Once
+// there are none left during a shutdown, a connection given to
+// ServeTransport that is waiting for a request is closed.
+func (s *Server) setActive(sc *serverConn, delta int) {
+	s.mu.Lock()
+	sc.active += delta
+	if sc.active == 0 && s.inShutdown && sc.raw == nil && !sc.reading {
+		sc.close()
+	}
+	s.mu.Unlock()
+}
+
+func (s *Server) transport(conn net.Conn) Transport {
+	if s.NewTransport != nil {
+		return s.NewTransport(conn)
+	}
+	return NewTransport(NewFramedReadWriteCloser(conn, DefaultMaxFrameSize), BinaryProtocol)
+}
+
+type serverConn struct {
+	srv        *Server
+	conn       Transport
+	raw        *serverNetConn // nil when given to ServeTransport
+	middleware []Middleware
+	ctx        context.Context // of the requests, cancelled when the connection is closed
+	cancel     context.CancelFunc
+	sending    sync.Mutex    // serializes writing responses to conn
+	slots      chan struct{} // holds a value per request being handled, when limited
+	pending    chan struct{} // holds a value per request not answered yet, when limited
+
+	// Protected by Server.mu.
+	active  int  // number of requests read or being read and not answered
+	reading bool // in the middle of receiving a request
+	closed  bool // closed by Shutdown or Close
+	stopped bool // no more requests are read because of Shutdown
+}
+
+// close closes the connection on behalf of the server. Server.mu must be
+// held.
+func (c *serverConn) close() {
+	c.cancel()
+	if !c.closed {
+		c.closed = true
+		c.conn.Close()
+	}
+}
+
+// serverNetConn is a connection accepted by Serve. It tells the server when
+// bytes of a request arrive, so that Shutdown doesn't cut it short.
+type serverNetConn struct {
+	net.Conn
+	srv *Server
+	sc  *serverConn // set before requests are read
+}
+
+func (c *serverNetConn) Read(b []byte) (int, error) {
+	for {
+		n, err := c.Conn.Read(b)
+		if c.sc == nil {
+			return n, err
 		}
-	} else {
-		if err := DecodeStruct(c.conn, thriftStruct); err != nil {
-			return err
+		if n > 0 {
+			c.srv.received(c.sc)
+		}
+		if ne, ok := err.(net.Error); ok && n == 0 && ne.Timeout() && c.srv.resume(c.sc) {
+			continue
 		}
+		return n, err
+	}
+}
+
+// stopReading makes the connection stop reading requests, on behalf of
+// Shutdown. A connection accepted by Serve is woken up by a read deadline,
+// which only ends reading if no bytes have arrived since the end of the last
+// request: otherwise it's removed and the request received to the end. The
+// start of a pipelined request read along with the end of the previous one
+// isn't noticed, so such a request may still be cut short. A connection
+// given to ServeTransport can only be closed, which is done when it's idle.
+// Server.mu must be held.
+func (c *serverConn) stopReading() {
+	if c.closed || c.stopped {
+		return
+	}
+	if c.raw != nil {
+		c.stopped = true
+		c.raw.SetReadDeadline(time.Now())
+	} else if c.active == 0 && !c.reading {
+		c.close()
+	}
+}
+
+// linger closes the writing side of a connection accepted by Serve and
+// reads until the client hangs up. Closing a connection with unread requests
+// resets it, which could make the client lose the responses sent last.
+func (c *serverConn) linger() {
+	cw, ok := c.raw.Conn.(interface{ CloseWrite() error })
+	if !ok || cw.CloseWrite() != nil {
+		return
 	}
-	return c.conn.ReadMessageEnd()
+	c.raw.SetReadDeadline(time.Now().Add(shutdownLinger))
+	io.Copy(ioutil.Discard, c.raw.Conn)
 }
 
-func (c *serverCodec) WriteResponse(response *rpc.Response, thriftStruct interface{}) error {
-	c.mu.Lock()
-	methodName := c.methodName[response.Seq]
-	delete(c.methodName, response.Seq)
-	c.mu.Unlock()
-	response.ServiceMethod = methodName
+func (s *Server) serve(methods map[string]ProcessorMethod, conn Transport, raw *serverNetConn) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sc := &serverConn{srv: s, conn: conn, raw: raw, middleware: s.Middleware, ctx: ctx, cancel: cancel}
+	if raw != nil {
+		raw.sc = sc
+	}
+	if s.MaxConnRequests > 0 {
+		sc.slots = make(chan struct{}, s.MaxConnRequests)
+	}
+	if s.MaxPendingRequests > 0 {
+		sc.pending = make(chan struct{}, s.MaxPendingRequests)
+	}
+	if !s.trackConn(sc, true) {
+		conn.Close()
+		return ErrServerClosed
+	}
+	defer s.trackConn(sc, false)
+
+	var wg sync.WaitGroup
+	var err error
+	var stopped bool
+	for !stopped {
+		var name string
+		var mtype byte
+		var seq int32
+		if sc.pending != nil {
+			// Don't read more requests than allowed to be pending.
+			sc.pending <- struct{}{}
+		}
+		name, mtype, seq, err = conn.ReadMessageBegin()
+		if err != nil {
+			break
+		}
+		if !s.begin(sc) {
+			break
+		}
+		if mtype != MessageTypeCall && mtype != MessageTypeOneway {
+			err = ProtocolError{"Server", "expected Call or Oneway message type"}
+			break
+		}
+		msg := readMessage(conn)
+		// Replies to multiplexed requests carry the bare method name.
+		_, replyName := splitMultiplexedName(name)
+		method, ok := methods[name]
+		if !ok {
+			if err = SkipValue(conn, TypeStruct); err != nil {
+				break
+			}
+			if err = conn.ReadMessageEnd(); err != nil {
+				break
+			}
+			stopped = s.end(sc)
+			if mtype != MessageTypeOneway {
+				exc := &ApplicationException{"thrift: can't find method " + name, ExceptionUnknownMethod}
+				if err = sc.reply(msg, nil, replyName, MessageTypeException, seq, exc); err != nil {
+					break
+				}
+			}
+			s.done(sc)
+			continue
+		}
+		req := method.NewRequest()
+		if err = DecodeStruct(conn, req); err != nil {
+			break
+		}
+		if err = conn.ReadMessageEnd(); err != nil {
+			break
+		}
+		stopped = s.end(sc)
+		ow := mtype == MessageTypeOneway || method.NewResponse == nil
+		if o, ok := req.(oneway); ok && o.Oneway() {
+			ow = true
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sc.call(msg, name, replyName, seq, ow, method, req)
+			s.done(sc)
+		}()
+	}
+	wg.Wait()
+	s.mu.Lock()
+	stopped = sc.stopped && !sc.closed
+	s.mu.Unlock()
+	if stopped && sc.raw != nil {
+		sc.linger()
+	}
+	conn.Close()
+	s.mu.Lock()
+	closed := sc.closed || sc.stopped
+	s.mu.Unlock()
+	if closed {
+		return ErrServerClosed
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
 
+func (c *serverConn) call(msg *headerMessage, name, replyName string, seq int32, ow bool, method ProcessorMethod, req interface{}) {
+	var res interface{}
+	var err error
+	ctx := c.ctx
+	var headers *serverHeaders
+	if msg != nil {
+		headers = &serverHeaders{request: msg.headers}
+		ctx = context.WithValue(ctx, serverHeadersKey{}, headers)
+	}
+	// The server wide limit is checked first so that requests are rejected
+	// right away rather than after waiting for their turn on the connection.
+	if !c.srv.acquire() {
+		exc := c.srv.Overload
+		if exc == nil {
+			exc = &ApplicationException{"thrift: server overloaded", ExceptionLoadShedding}
+		}
+		err = exc
+	} else {
+		if c.slots != nil {
+			c.slots <- struct{}{}
+		}
+		if method.NewResponse != nil {
+			res = method.NewResponse()
+		}
+		if len(c.middleware) == 0 {
+			err = method.call(ctx, req, res)
+		} else {
+			h := func(ctx context.Context, name string, req, res interface{}) error {
+				return method.call(ctx, req, res)
+			}
+			err = withMiddleware(c.middleware, h)(ctx, name, req, res)
+		}
+		if c.slots != nil {
+			<-c.slots
+		}
+		c.srv.release()
+	}
+	if ow {
+		// No response, not even an exception, is sent for one-way requests.
+		return
+	}
 	mtype := byte(MessageTypeReply)
-	if response.Error != "" {
+	if err != nil {
 		mtype = MessageTypeException
-		etype := int32(ExceptionInternalError)
-		if strings.HasPrefix(response.Error, "rpc: can't find") {
-			etype = ExceptionUnknownMethod
+		exc, ok := err.(*ApplicationException)
+		if !ok {
+			exc = &ApplicationException{err.Error(), ExceptionInternalError}
 		}
-		thriftStruct = &ApplicationException{response.Error, etype}
+		res = exc
+	}
+	if err := c.reply(msg, headers.responseHeaders(), replyName, mtype, seq, res); err != nil {
+		// The stream is broken, make the read loop give up as well.
+		c.conn.Close()
 	}
-	if err := c.conn.WriteMessageBegin(response.ServiceMethod, mtype, int32(response.Seq)); err != nil {
+}
+
+// reply writes the response to the request read as msg, with headers.
+func (c *serverConn) reply(msg *headerMessage, headers map[string]string, name string, mtype byte, seq int32, res interface{}) error {
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	writeNext(c.conn, msg, headers)
+	if err := c.conn.WriteMessageBegin(name, mtype, seq); err != nil {
 		return err
 	}
-	if err := EncodeStruct(c.conn, thriftStruct); err != nil {
+	if err := EncodeStruct(c.conn, res); err != nil {
 		return err
 	}
 	if err := c.conn.WriteMessageEnd(); err != nil {
@@ -105,10 +603,3 @@ func (c *serverCodec) WriteResponse(response *rpc.Response, thriftStruct interfa
 	}
 	return c.conn.Flush()
 }
-
-func (c *serverCodec) Close() error {
-	if cl, ok := c.conn.(io.Closer); ok {
-		return cl.Close()
-	}
-	return nil
-}
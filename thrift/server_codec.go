@@ -0,0 +1,246 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"errors"
+	"io"
+	"net/rpc"
+	"strings"
+	"sync"
+)
+
+// maxNameCacheSize bounds the number of method names a serverCodec
+// remembers, so that clients sending many names can't make it grow forever.
+const maxNameCacheSize = 256
+
+// DefaultServerCodecPendingRequests is the MaxPendingRequests of the codecs
+// returned by NewServerCodec.
+const DefaultServerCodecPendingRequests = 1000
+
+// ServerCodecOptions configures a server codec. The zero value is usable and
+// doesn't limit anything.
+type ServerCodecOptions struct {
+	// MaxPendingRequests limits the number of requests read and not
+	// answered yet. Once it's reached the codec stops reading from the
+	// connection until a response is sent, which makes clients pipelining
+	// requests wait. Zero means no limit.
+	MaxPendingRequests int
+	// MaxConcurrentRequests limits the number of requests handled at the
+	// same time, net/rpc handling each request read in a new goroutine.
+	// Requests beyond it are answered right away with Overload without
+	// being handed to net/rpc. It only matters when lower than
+	// MaxPendingRequests. Zero means no limit.
+	MaxConcurrentRequests int
+	// Overload is sent in response to the requests rejected because of
+	// MaxConcurrentRequests. When nil an ApplicationException of type
+	// ExceptionLoadShedding is sent.
+	Overload *ApplicationException
+}
+
+type serverCodec struct {
+	conn      Transport
+	opts      ServerCodecOptions
+	nameCache map[string]string        // incoming name -> registered name
+	requests  map[uint64]serverRequest // sequence ID -> pending request
+	seq       uint64                   // sequence ID of the request being read
+	mu        sync.Mutex
+	answered  *sync.Cond // signaled when a request is removed from requests
+	sending   sync.Mutex // serializes writing responses to conn
+}
+
+type serverRequest struct {
+	method string
+	oneway bool
+}
+
+// ServeConn runs the Thrift RPC server on a single connection. ServeConn blocks,
+// serving the connection until the client hangs up. The caller typically invokes
+// ServeConn in a go statement.
+func ServeConn(conn Transport) {
+	rpc.ServeCodec(NewServerCodec(conn))
+}
+
+// NewServerCodec returns a new rpc.ServerCodec using Thrift RPC on conn using the specified protocol.
+// It stops reading requests while DefaultServerCodecPendingRequests of them are waiting for a response,
+// as net/rpc handles each one in a new goroutine.
+func NewServerCodec(conn Transport) rpc.ServerCodec {
+	return NewServerCodecOptions(conn, &ServerCodecOptions{MaxPendingRequests: DefaultServerCodecPendingRequests})
+}
+
+// NewServerCodecOptions returns a new rpc.ServerCodec using Thrift RPC on conn, limiting the requests
+// it reads according to opts. A nil opts is the same as the zero value.
+func NewServerCodecOptions(conn Transport, opts *ServerCodecOptions) rpc.ServerCodec {
+	if opts == nil {
+		opts = &ServerCodecOptions{}
+	}
+	c := &serverCodec{
+		conn:      conn,
+		opts:      *opts,
+		nameCache: make(map[string]string, 8),
+		requests:  make(map[uint64]serverRequest, 8),
+	}
+	c.answered = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *serverCodec) ReadRequestHeader(request *rpc.Request) error {
+	c.mu.Lock()
+	for c.opts.MaxPendingRequests > 0 && len(c.requests) >= c.opts.MaxPendingRequests {
+		c.answered.Wait()
+	}
+	c.mu.Unlock()
+
+	name, messageType, seq, err := c.conn.ReadMessageBegin()
+	if err != nil {
+		return err
+	}
+	if messageType != MessageTypeCall && messageType != MessageTypeOneway {
+		return errors.New("thrift: expected Call or Oneway message type")
+	}
+	for c.overloaded() {
+		if err := c.shed(name, messageType, seq); err != nil {
+			return err
+		}
+		if name, messageType, seq, err = c.conn.ReadMessageBegin(); err != nil {
+			return err
+		}
+		if messageType != MessageTypeCall && messageType != MessageTypeOneway {
+			return errors.New("thrift: expected Call or Oneway message type")
+		}
+	}
+
+	newName := c.nameCache[name]
+	service, method := splitMultiplexedName(name)
+	if newName == "" {
+		if service != "" {
+			// Multiplexed requests go to the service registered under
+			// the name of their prefix.
+			newName = service + "." + CamelCase(method)
+		} else {
+			newName = CamelCase(name)
+			if !strings.ContainsRune(newName, '.') {
+				newName = "Thrift." + newName
+			}
+		}
+		if len(c.nameCache) < maxNameCacheSize {
+			c.nameCache[name] = newName
+		}
+	}
+
+	c.mu.Lock()
+	c.requests[uint64(seq)] = serverRequest{
+		method: method,
+		oneway: messageType == MessageTypeOneway,
+	}
+	c.seq = uint64(seq)
+	c.mu.Unlock()
+
+	request.ServiceMethod = newName
+	request.Seq = uint64(seq)
+
+	return nil
+}
+
+// overloaded reports whether MaxConcurrentRequests requests are being
+// handled.
+func (c *serverCodec) overloaded() bool {
+	if c.opts.MaxConcurrentRequests <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.requests) >= c.opts.MaxConcurrentRequests
+}
+
+// shed skips the body of the request whose header was just read and answers
+// it with Overload. One-way requests sent as calls get a response all the
+// same, which clients ignore.
+func (c *serverCodec) shed(name string, messageType byte, seq int32) error {
+	if err := SkipValue(c.conn, TypeStruct); err != nil {
+		return err
+	}
+	if err := c.conn.ReadMessageEnd(); err != nil {
+		return err
+	}
+	if messageType == MessageTypeOneway {
+		return nil
+	}
+	exc := c.opts.Overload
+	if exc == nil {
+		exc = &ApplicationException{"thrift: server overloaded", ExceptionLoadShedding}
+	}
+	_, method := splitMultiplexedName(name)
+	return c.writeMessage(method, MessageTypeException, seq, exc)
+}
+
+func (c *serverCodec) ReadRequestBody(thriftStruct interface{}) error {
+	if thriftStruct == nil {
+		if err := SkipValue(c.conn, TypeStruct); err != nil {
+			return err
+		}
+	} else {
+		if err := DecodeStruct(c.conn, thriftStruct); err != nil {
+			return err
+		}
+		// Clients that don't know about the Oneway message type send
+		// one-way requests as calls, so also trust the request struct.
+		if o, ok := thriftStruct.(oneway); ok && o.Oneway() {
+			c.mu.Lock()
+			req := c.requests[c.seq]
+			req.oneway = true
+			c.requests[c.seq] = req
+			c.mu.Unlock()
+		}
+	}
+	return c.conn.ReadMessageEnd()
+}
+
+func (c *serverCodec) WriteResponse(response *rpc.Response, thriftStruct interface{}) error {
+	c.mu.Lock()
+	req := c.requests[response.Seq]
+	delete(c.requests, response.Seq)
+	c.answered.Signal()
+	c.mu.Unlock()
+	response.ServiceMethod = req.method
+
+	if req.oneway {
+		// No response, not even an exception, is sent for one-way requests.
+		return nil
+	}
+
+	mtype := byte(MessageTypeReply)
+	if response.Error != "" {
+		mtype = MessageTypeException
+		etype := int32(ExceptionInternalError)
+		if strings.HasPrefix(response.Error, "rpc: can't find") {
+			etype = ExceptionUnknownMethod
+		}
+		thriftStruct = &ApplicationException{response.Error, etype}
+	}
+	return c.writeMessage(response.ServiceMethod, mtype, int32(response.Seq), thriftStruct)
+}
+
+func (c *serverCodec) writeMessage(name string, mtype byte, seq int32, thriftStruct interface{}) error {
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	if err := c.conn.WriteMessageBegin(name, mtype, seq); err != nil {
+		return err
+	}
+	if err := EncodeStruct(c.conn, thriftStruct); err != nil {
+		return err
+	}
+	if err := c.conn.WriteMessageEnd(); err != nil {
+		return err
+	}
+	return c.conn.Flush()
+}
+
+func (c *serverCodec) Close() error {
+	if cl, ok := c.conn.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+// Make sure the ServerCodec returns the same method name
+// in the response as was in the request.
+func TestServerMethodName(t *testing.T) {
+	buf := &ClosingBuffer{&bytes.Buffer{}}
+	clientCodec := NewClientCodec(NewTransport(buf, BinaryProtocol), false)
+	defer clientCodec.Close()
+	serverCodec := NewServerCodec(NewTransport(buf, BinaryProtocol))
+	defer serverCodec.Close()
+	req := &rpc.Request{
+		ServiceMethod: "some_method",
+		Seq:           3,
+	}
+	empty := &struct{}{}
+	if err := clientCodec.WriteRequest(req, empty); err != nil {
+		t.Fatal(err)
+	}
+	var req2 rpc.Request
+	if err := serverCodec.ReadRequestHeader(&req2); err != nil {
+		t.Fatal(err)
+	}
+	if req.Seq != req2.Seq {
+		t.Fatalf("Expected seq %d, got %d", req.Seq, req2.Seq)
+	}
+	t.Logf("Mangled method name: %s", req2.ServiceMethod)
+	if err := serverCodec.ReadRequestBody(empty); err != nil {
+		t.Fatal(err)
+	}
+	res := &rpc.Response{
+		ServiceMethod: req2.ServiceMethod,
+		Seq:           req2.Seq,
+	}
+	if err := serverCodec.WriteResponse(res, empty); err != nil {
+		t.Fatal(err)
+	}
+	var res2 rpc.Response
+	if err := clientCodec.ReadResponseHeader(&res2); err != nil {
+		t.Fatal(err)
+	}
+	if res2.Seq != req.Seq {
+		t.Fatalf("Expected seq %d, got %d", req.Seq, res2.Seq)
+	}
+	if res2.Error != "" {
+		t.Fatalf("Expected error of '' instead of '%s'", res2.Error)
+	}
+	if res2.ServiceMethod != req.ServiceMethod {
+		t.Fatalf("Expected ServiceMethod of '%s' instead of '%s'", req.ServiceMethod, res2.ServiceMethod)
+	}
+}
+
+func TestServerCodecNameCache(t *testing.T) {
+	buf := &ClosingBuffer{&bytes.Buffer{}}
+	clientCodec := NewClientCodec(NewTransport(buf, BinaryProtocol), false)
+	defer clientCodec.Close()
+	codec := NewServerCodec(NewTransport(buf, BinaryProtocol))
+	defer codec.Close()
+
+	empty := &struct{}{}
+	for i := 0; i < maxNameCacheSize+10; i++ {
+		req := &rpc.Request{ServiceMethod: fmt.Sprintf("method_%d", i), Seq: uint64(i)}
+		if err := clientCodec.WriteRequest(req, empty); err != nil {
+			t.Fatal(err)
+		}
+		var req2 rpc.Request
+		if err := codec.ReadRequestHeader(&req2); err != nil {
+			t.Fatal(err)
+		}
+		if expected := fmt.Sprintf("Thrift.Method%d", i); req2.ServiceMethod != expected {
+			t.Fatalf("Expected method %s, got %s", expected, req2.ServiceMethod)
+		}
+		if err := codec.ReadRequestBody(empty); err != nil {
+			t.Fatal(err)
+		}
+		if err := codec.WriteResponse(&rpc.Response{Seq: req2.Seq}, empty); err != nil {
+			t.Fatal(err)
+		}
+		var res rpc.Response
+		if err := clientCodec.ReadResponseHeader(&res); err != nil {
+			t.Fatal(err)
+		}
+		if err := clientCodec.ReadResponseBody(empty); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(codec.(*serverCodec).nameCache); n != maxNameCacheSize {
+		t.Fatalf("Expected %d cached names, got %d", maxNameCacheSize, n)
+	}
+}
+
+type onewayTestService struct {
+	calls chan int32
+}
+
+func (s *onewayTestService) Notify(req *TestOneWayRequest, _ *struct{}) error {
+	s.calls <- req.Value
+	return nil
+}
+
+func (s *onewayTestService) Echo(req *TestRequest, res *TestResponse) error {
+	res.Value = req.Value
+	return nil
+}
+
+func startOnewayTestServer(t *testing.T) (*onewayTestService, net.Conn) {
+	svc := &onewayTestService{calls: make(chan int32, 1)}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Thrift", svc); err != nil {
+		t.Fatal(err)
+	}
+	cli, conn := net.Pipe()
+	go srv.ServeCodec(NewServerCodec(NewTransport(conn, BinaryProtocol)))
+	return svc, cli
+}
+
+func expectOnewayCall(t *testing.T, svc *onewayTestService, value int32) {
+	select {
+	case v := <-svc.calls:
+		if v != value {
+			t.Fatalf("Expected one-way call with %d, got %d", value, v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for one-way call")
+	}
+}
+
+// Make sure one-way requests are dispatched and that no response is
+// written for them, so that following calls get their own response.
+func TestServerOneway(t *testing.T) {
+	svc, conn := startOnewayTestServer(t)
+	client := NewNativeClient(NewTransport(conn, BinaryProtocol), true)
+	defer client.Close()
+
+	if err := client.Call("notify", &TestOneWayRequest{42}, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectOnewayCall(t, svc, 42)
+
+	res := &TestResponse{}
+	if err := client.Call("echo", &TestRequest{123}, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != 123 {
+		t.Fatalf("Expected response value 123, got %d", res.Value)
+	}
+}
+
+// Clients that don't support the Oneway message type send one-way requests
+// as calls. The server should still recognize them from the request struct.
+func TestServerOnewayAsCall(t *testing.T) {
+	svc, conn := startOnewayTestServer(t)
+	defer conn.Close()
+	trans := NewTransport(conn, BinaryProtocol)
+
+	go func() {
+		if err := trans.WriteMessageBegin("notify", MessageTypeCall, 1); err != nil {
+			t.Error(err)
+		}
+		if err := EncodeStruct(trans, &TestOneWayRequest{42}); err != nil {
+			t.Error(err)
+		}
+		if err := trans.WriteMessageBegin("echo", MessageTypeCall, 2); err != nil {
+			t.Error(err)
+		}
+		if err := EncodeStruct(trans, &TestRequest{123}); err != nil {
+			t.Error(err)
+		}
+		if err := trans.Flush(); err != nil {
+			t.Error(err)
+		}
+	}()
+	expectOnewayCall(t, svc, 42)
+
+	name, mtype, seq, err := trans.ReadMessageBegin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "echo" || mtype != MessageTypeReply || seq != 2 {
+		t.Fatalf("Expected reply to echo with seq 2, got %s (type %d, seq %d)", name, mtype, seq)
+	}
+	res := &TestResponse{}
+	if err := DecodeStruct(trans, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != 123 {
+		t.Fatalf("Expected response value 123, got %d", res.Value)
+	}
+}
+
+// limitTestService has a Block method that blocks until release is closed.
+type limitTestService struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *limitTestService) Block(req *TestRequest, res *TestResponse) error {
+	s.started <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func (s *limitTestService) Echo(req *TestRequest, res *TestResponse) error {
+	res.Value = req.Value
+	return nil
+}
+
+// startCodecLimitTestServer serves a limitTestService with net/rpc and a
+// codec using opts, and returns a client connected to it. It uses TCP rather
+// than net.Pipe, whose writes would block the client while the server
+// doesn't read.
+func startCodecLimitTestServer(t *testing.T, opts *ServerCodecOptions) (*limitTestService, *Client) {
+	svc := &limitTestService{started: make(chan struct{}, 1), release: make(chan struct{})}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Thrift", svc); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		srv.ServeCodec(NewServerCodecOptions(NewTransport(conn, BinaryProtocol), opts))
+	}()
+
+	c, err := DialClient("tcp", ln.Addr().String(), false, BinaryProtocol, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return svc, c
+}
+
+func TestServerCodecMaxPendingRequests(t *testing.T) {
+	svc, c := startCodecLimitTestServer(t, &ServerCodecOptions{MaxPendingRequests: 1})
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- c.Call("block", &TestRequest{}, &TestResponse{})
+	}()
+	<-svc.started
+
+	// The request isn't read while the first one is pending.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.CallContext(ctx, "echo", &TestRequest{1}, &TestResponse{}); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %+v", err)
+	}
+
+	close(svc.release)
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Call("echo", &TestRequest{1}, &TestResponse{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerCodecMaxConcurrentRequests(t *testing.T) {
+	svc, c := startCodecLimitTestServer(t, &ServerCodecOptions{MaxConcurrentRequests: 1})
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- c.Call("block", &TestRequest{}, &TestResponse{})
+	}()
+	<-svc.started
+
+	err := c.Call("echo", &TestRequest{1}, &TestResponse{})
+	if exc, ok := err.(*ApplicationException); !ok || exc.Type != ExceptionLoadShedding {
+		t.Fatalf("Expected a load shedding exception, got %+v", err)
+	}
+
+	close(svc.release)
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+	res := &TestResponse{}
+	if err := c.Call("echo", &TestRequest{1}, res); err != nil {
+		t.Fatalf("Expected calls to succeed once the server isn't busy, got %+v", err)
+	}
+	if res.Value != 1 {
+		t.Fatalf("Response value wrong: %d != 1", res.Value)
+	}
+}
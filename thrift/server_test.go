@@ -6,55 +6,601 @@ package thrift
 
 import (
 	"bytes"
-	"net/rpc"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-// Make sure the ServerCodec returns the same method name
-// in the response as was in the request.
-func TestServerMethodName(t *testing.T) {
+type testProcessor struct {
+	calls chan int32
+}
+
+func (p *testProcessor) ProcessorMethods() map[string]ProcessorMethod {
+	return map[string]ProcessorMethod{
+		"echo": {
+			NewRequest:  func() interface{} { return &TestRequest{} },
+			NewResponse: func() interface{} { return &TestResponse{} },
+			Call: func(req, res interface{}) error {
+				res.(*TestResponse).Value = req.(*TestRequest).Value
+				return nil
+			},
+		},
+		"fail": {
+			NewRequest:  func() interface{} { return &TestRequest{} },
+			NewResponse: func() interface{} { return &TestResponse{} },
+			Call: func(req, res interface{}) error {
+				return errors.New("failed")
+			},
+		},
+		"notify": {
+			NewRequest: func() interface{} { return &TestOneWayRequest{} },
+			Call: func(req, res interface{}) error {
+				p.calls <- req.(*TestOneWayRequest).Value
+				return nil
+			},
+		},
+	}
+}
+
+func startTestServer(t *testing.T) (*testProcessor, *Client) {
+	p := &testProcessor{calls: make(chan int32, 1)}
+	srv := &Server{Processor: p}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { ln.Close() })
+
+	c, err := DialClient("tcp", ln.Addr().String(), true, BinaryProtocol, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return p, c
+}
+
+func TestServerCall(t *testing.T) {
+	_, c := startTestServer(t)
+
+	res := &TestResponse{}
+	if err := c.Call("echo", &TestRequest{123}, res); err != nil {
+		t.Fatalf("Client.Call returned error: %+v", err)
+	}
+	if res.Value != 123 {
+		t.Fatalf("Response value wrong: %d != 123", res.Value)
+	}
+}
+
+func TestServerError(t *testing.T) {
+	_, c := startTestServer(t)
+
+	err := c.Call("fail", &TestRequest{123}, &TestResponse{})
+	exc, ok := err.(*ApplicationException)
+	if !ok {
+		t.Fatalf("Expected an ApplicationException, got %+v", err)
+	}
+	if exc.Type != ExceptionInternalError || exc.Message != "failed" {
+		t.Fatalf("Unexpected exception %+v", exc)
+	}
+}
+
+func TestServerUnknownMethod(t *testing.T) {
+	_, c := startTestServer(t)
+
+	err := c.Call("missing", &TestRequest{123}, &TestResponse{})
+	if exc, ok := err.(*ApplicationException); !ok || exc.Type != ExceptionUnknownMethod {
+		t.Fatalf("Expected an unknown method exception, got %+v", err)
+	}
+
+	// The connection must still be usable.
+	res := &TestResponse{}
+	if err := c.Call("echo", &TestRequest{456}, res); err != nil {
+		t.Fatalf("Client.Call returned error: %+v", err)
+	}
+	if res.Value != 456 {
+		t.Fatalf("Response value wrong: %d != 456", res.Value)
+	}
+}
+
+func TestServerProcessorOneway(t *testing.T) {
+	p, c := startTestServer(t)
+
+	if err := c.Call("notify", &TestOneWayRequest{42}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-p.calls; v != 42 {
+		t.Fatalf("Expected one-way call with 42, got %d", v)
+	}
+
+	res := &TestResponse{}
+	if err := c.Call("echo", &TestRequest{123}, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != 123 {
+		t.Fatalf("Expected response value 123, got %d", res.Value)
+	}
+}
+
+func TestServerTransportHangUp(t *testing.T) {
+	srv := &Server{Processor: &testProcessor{}}
+	cli, conn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeTransport(NewTransport(conn, BinaryProtocol))
+	}()
+
+	c := NewNativeClient(NewTransport(cli, BinaryProtocol), false)
+	res := &TestResponse{}
+	if err := c.Call("echo", &TestRequest{123}, res); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("ServeTransport returned error: %+v", err)
+	}
+}
+
+// startShutdownTestServer serves an endpointProcessor on a TCP listener and
+// returns a client connected to it and the result of Serve.
+func startShutdownTestServer(t *testing.T) (*Server, *endpointProcessor, *Client, chan error) {
+	p := &endpointProcessor{id: 1, started: make(chan struct{}, 1), release: make(chan struct{})}
+	srv := &Server{Processor: p}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
+	c, err := DialClient("tcp", ln.Addr().String(), true, BinaryProtocol, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.Call("whoami", &TestRequest{}, &TestResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	return srv, p, c, served
+}
+
+func TestServerShutdown(t *testing.T) {
+	srv, p, c, served := startShutdownTestServer(t)
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- c.Call("block", &TestRequest{}, &TestResponse{})
+	}()
+	<-p.started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(context.Background()) }()
+	if err := <-served; err != ErrServerClosed {
+		t.Fatalf("Expected Serve to return ErrServerClosed, got %+v", err)
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %+v before the pending request was answered", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(p.release)
+	if err := <-blocked; err != nil {
+		t.Fatalf("Expected the pending request to succeed, got %+v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown returned error: %+v", err)
+	}
+	if err := c.Call("whoami", &TestRequest{}, &TestResponse{}); err == nil {
+		t.Fatal("Expected the connection to be closed after Shutdown")
+	}
+}
+
+func TestServerShutdownIdle(t *testing.T) {
+	srv, _, c, served := startShutdownTestServer(t)
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %+v", err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Fatalf("Expected Serve to return ErrServerClosed, got %+v", err)
+	}
+	if err := c.Call("whoami", &TestRequest{}, &TestResponse{}); err == nil {
+		t.Fatal("Expected the idle connection to be closed")
+	}
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	srv, p, c, _ := startShutdownTestServer(t)
+	defer close(p.release)
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- c.Call("block", &TestRequest{}, &TestResponse{})
+	}()
+	<-p.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %+v", err)
+	}
+	if err := <-blocked; err == nil {
+		t.Fatal("Expected the pending request to fail once its connection is closed")
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	srv, _, _, served := startShutdownTestServer(t)
+
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Fatalf("Expected Serve to return ErrServerClosed, got %+v", err)
+	}
+	_, conn := net.Pipe()
+	if err := srv.ServeTransport(NewTransport(conn, BinaryProtocol)); err != ErrServerClosed {
+		t.Fatalf("Expected ServeTransport to return ErrServerClosed, got %+v", err)
+	}
+}
+
+// Shutdown doesn't wait for clients to stop sending requests: it stops
+// reading them and answers those already read.
+func TestServerShutdownBusy(t *testing.T) {
+	var handled int64
+	p := funcProcessor{
+		"echo": {
+			NewRequest:  func() interface{} { return &TestRequest{} },
+			NewResponse: func() interface{} { return &TestResponse{} },
+			Call: func(req, res interface{}) error {
+				time.Sleep(time.Duration(req.(*TestRequest).Value) * time.Millisecond)
+				res.(*TestResponse).Value = req.(*TestRequest).Value
+				atomic.AddInt64(&handled, 1)
+				return nil
+			},
+		},
+	}
+	srv := &Server{Processor: &p}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+
+	var answered int64
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		c, err := DialClient("tcp", ln.Addr().String(), true, BinaryProtocol, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		// Requests of different lengths keep the connection busy.
+		for j := 1; j <= 16; j++ {
+			wg.Add(1)
+			go func(d int32) {
+				defer wg.Done()
+				for c.Call("echo", &TestRequest{d}, &TestResponse{}) == nil {
+					atomic.AddInt64(&answered, 1)
+				}
+			}(int32(j))
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Expected Shutdown to complete before its deadline, got %+v", err)
+	}
+	wg.Wait()
+	if answered == 0 {
+		t.Fatal("Expected calls to succeed before the shutdown")
+	}
+	if handled != answered {
+		t.Fatalf("Expected every request handled to be answered, %d handled and %d answered", handled, answered)
+	}
+}
+
+// A request partly received when Shutdown starts is read to the end and
+// answered.
+func TestServerShutdownPartialRequest(t *testing.T) {
+	srv := &Server{Processor: &testProcessor{}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+
 	buf := &ClosingBuffer{&bytes.Buffer{}}
-	clientCodec := NewClientCodec(NewTransport(buf, BinaryProtocol), false)
-	defer clientCodec.Close()
-	serverCodec := NewServerCodec(NewTransport(buf, BinaryProtocol))
-	defer serverCodec.Close()
-	req := &rpc.Request{
-		ServiceMethod: "some_method",
-		Seq:           3,
+	ct := NewTransport(NewFramedReadWriteCloser(buf, 0), BinaryProtocol)
+	if err := ct.WriteMessageBegin("echo", MessageTypeCall, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeStruct(ct, &TestRequest{123}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ct.WriteMessageEnd(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ct.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(frame[:len(frame)/2]); err != nil {
+		t.Fatal(err)
+	}
+	// Let the server read the first half.
+	time.Sleep(20 * time.Millisecond)
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- srv.Shutdown(context.Background())
+	}()
+	for !srv.shuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := conn.Write(frame[len(frame)/2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	st := NewTransport(NewFramedReadWriteCloser(conn, 0), BinaryProtocol)
+	if _, mtype, seq, err := st.ReadMessageBegin(); err != nil {
+		t.Fatalf("Expected a response, got %+v", err)
+	} else if mtype != MessageTypeReply || seq != 1 {
+		t.Fatalf("Expected a reply to request 1, got type %d for %d", mtype, seq)
+	}
+	res := &TestResponse{}
+	if err := DecodeStruct(st, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != 123 {
+		t.Fatalf("Response value wrong: %d != 123", res.Value)
+	}
+	conn.Close()
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown returned error: %+v", err)
+	}
+}
+
+// ctxProcessor has a "wait" method that reports the context of the request
+// and blocks until release is closed or the context is done.
+type ctxProcessor struct {
+	ctxs    chan context.Context
+	release chan struct{}
+}
+
+func (p *ctxProcessor) ProcessorMethods() map[string]ProcessorMethod {
+	return map[string]ProcessorMethod{
+		"wait": {
+			NewRequest:  func() interface{} { return &TestRequest{} },
+			NewResponse: func() interface{} { return &TestResponse{} },
+			CallContext: func(ctx context.Context, req, res interface{}) error {
+				p.ctxs <- ctx
+				select {
+				case <-p.release:
+				case <-ctx.Done():
+				}
+				return ctx.Err()
+			},
+		},
+	}
+}
+
+// startCtxTestServer serves a ctxProcessor with srv and returns a client
+// connected to it.
+func startCtxTestServer(t *testing.T, srv *Server) (*ctxProcessor, *Client) {
+	p := &ctxProcessor{ctxs: make(chan context.Context, 1), release: make(chan struct{})}
+	srv.Processor = p
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	c, err := DialClient("tcp", ln.Addr().String(), true, BinaryProtocol, false)
+	if err != nil {
+		t.Fatal(err)
 	}
-	empty := &struct{}{}
-	if err := clientCodec.WriteRequest(req, empty); err != nil {
+	t.Cleanup(func() { c.Close() })
+	return p, c
+}
+
+func TestServerRequestContext(t *testing.T) {
+	srv := &Server{
+		Middleware: []Middleware{
+			func(ctx context.Context, method string, req, res interface{}, next Handler) error {
+				return next(context.WithValue(ctx, ctxKey{}, method), method, req, res)
+			},
+		},
+	}
+	p, c := startCtxTestServer(t, srv)
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- c.Call("wait", &TestRequest{}, &TestResponse{})
+	}()
+	ctx := <-p.ctxs
+	if v := ctx.Value(ctxKey{}); v != "wait" {
+		t.Fatalf("Expected the context of the middleware, got value %v", v)
+	}
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- srv.Shutdown(context.Background())
+	}()
+	for !srv.shuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("Expected the context to stay alive during a graceful shutdown, got %+v", err)
+	}
+	close(p.release)
+	if err := <-waited; err != nil {
+		t.Fatalf("Expected the call to succeed, got %+v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown returned error: %+v", err)
+	}
+}
+
+// The context of the requests is cancelled once Shutdown gives up waiting
+// for them and closes their connection.
+func TestServerRequestContextShutdownDeadline(t *testing.T) {
+	srv := &Server{}
+	p, c := startCtxTestServer(t, srv)
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- c.Call("wait", &TestRequest{}, &TestResponse{})
+	}()
+	ctx := <-p.ctxs
+	sctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected Shutdown to return DeadlineExceeded, got %+v", err)
+	}
+	if err := ctx.Err(); err != context.Canceled {
+		t.Fatalf("Expected the context to be cancelled, got %+v", err)
+	}
+	if err := <-waited; err == nil {
+		t.Fatal("Expected the call to fail once its connection is closed")
+	}
+}
+
+// startLimitTestServer serves an endpointProcessor with srv and returns a
+// client connected to it. It uses TCP rather than net.Pipe, whose writes
+// would block the client while the server doesn't read.
+func startLimitTestServer(t *testing.T, srv *Server) (*endpointProcessor, *Client) {
+	p := &endpointProcessor{id: 1, started: make(chan struct{}, 1), release: make(chan struct{})}
+	srv.Processor = p
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
 		t.Fatal(err)
 	}
-	var req2 rpc.Request
-	if err := serverCodec.ReadRequestHeader(&req2); err != nil {
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	c, err := DialClient("tcp", ln.Addr().String(), true, BinaryProtocol, false)
+	if err != nil {
 		t.Fatal(err)
 	}
-	if req.Seq != req2.Seq {
-		t.Fatalf("Expected seq %d, got %d", req.Seq, req2.Seq)
+	t.Cleanup(func() { c.Close() })
+	return p, c
+}
+
+func TestServerMaxConcurrentRequests(t *testing.T) {
+	srv := &Server{MaxConcurrentRequests: 1}
+	p, c := startLimitTestServer(t, srv)
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- c.Call("block", &TestRequest{}, &TestResponse{})
+	}()
+	<-p.started
+
+	err := c.Call("whoami", &TestRequest{}, &TestResponse{})
+	if exc, ok := err.(*ApplicationException); !ok || exc.Type != ExceptionLoadShedding {
+		t.Fatalf("Expected a load shedding exception, got %+v", err)
 	}
-	t.Logf("Mangled method name: %s", req2.ServiceMethod)
-	if err := serverCodec.ReadRequestBody(empty); err != nil {
+	srv.Overload = &ApplicationException{"busy", ExceptionLoadShedding}
+	err = c.Call("whoami", &TestRequest{}, &TestResponse{})
+	if exc, ok := err.(*ApplicationException); !ok || exc.Message != "busy" {
+		t.Fatalf("Expected the configured exception, got %+v", err)
+	}
+
+	close(p.release)
+	if err := <-blocked; err != nil {
 		t.Fatal(err)
 	}
-	res := &rpc.Response{
-		ServiceMethod: req2.ServiceMethod,
-		Seq:           req2.Seq,
+	if err := c.Call("whoami", &TestRequest{}, &TestResponse{}); err != nil {
+		t.Fatalf("Expected calls to succeed once the server isn't busy, got %+v", err)
+	}
+}
+
+func TestServerMaxConnRequests(t *testing.T) {
+	p, c := startLimitTestServer(t, &Server{MaxConnRequests: 1})
+
+	blocked := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			blocked <- c.Call("block", &TestRequest{}, &TestResponse{})
+		}()
 	}
-	if err := serverCodec.WriteResponse(res, empty); err != nil {
+	<-p.started
+	select {
+	case <-p.started:
+		t.Fatal("Expected the second request to wait for the first one")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(p.release)
+	<-p.started
+	for i := 0; i < 2; i++ {
+		if err := <-blocked; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// With both limits, requests beyond MaxConcurrentRequests are rejected
+// without waiting for their turn on the connection.
+func TestServerMaxConcurrentAndConnRequests(t *testing.T) {
+	p, c := startLimitTestServer(t, &Server{MaxConcurrentRequests: 1, MaxConnRequests: 1})
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- c.Call("block", &TestRequest{}, &TestResponse{})
+	}()
+	<-p.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := c.CallContext(ctx, "whoami", &TestRequest{}, &TestResponse{})
+	if exc, ok := err.(*ApplicationException); !ok || exc.Type != ExceptionLoadShedding {
+		t.Fatalf("Expected a load shedding exception, got %+v", err)
+	}
+
+	close(p.release)
+	if err := <-blocked; err != nil {
 		t.Fatal(err)
 	}
-	var res2 rpc.Response
-	if err := clientCodec.ReadResponseHeader(&res2); err != nil {
+	if err := c.Call("whoami", &TestRequest{}, &TestResponse{}); err != nil {
 		t.Fatal(err)
 	}
-	if res2.Seq != req.Seq {
-		t.Fatalf("Expected seq %d, got %d", req.Seq, res2.Seq)
+}
+
+func TestServerMaxPendingRequests(t *testing.T) {
+	p, c := startLimitTestServer(t, &Server{MaxPendingRequests: 1})
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- c.Call("block", &TestRequest{}, &TestResponse{})
+	}()
+	<-p.started
+
+	// The request isn't read while the first one is pending.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.CallContext(ctx, "whoami", &TestRequest{}, &TestResponse{}); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %+v", err)
 	}
-	if res2.Error != "" {
-		t.Fatalf("Expected error of '' instead of '%s'", res2.Error)
+
+	close(p.release)
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
 	}
-	if res2.ServiceMethod != req.ServiceMethod {
-		t.Fatalf("Expected ServiceMethod of '%s' instead of '%s'", req.ServiceMethod, res2.ServiceMethod)
+	if err := c.Call("whoami", &TestRequest{}, &TestResponse{}); err != nil {
+		t.Fatal(err)
 	}
 }
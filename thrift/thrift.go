@@ -69,6 +69,12 @@ const (
 	ExceptionMissingResult      = 5
 	ExceptionInternalError      = 6
 	ExceptionProtocolError      = 7
+	ExceptionInvalidTransform   = 8
+	ExceptionInvalidProtocol    = 9
+	ExceptionUnsupportedClient  = 10
+	// ExceptionLoadShedding is the type of the exception sent by a server
+	// rejecting requests because it's overloaded.
+	ExceptionLoadShedding = 11
 )
 
 type MissingRequiredField struct {
@@ -80,6 +86,29 @@ func (e *MissingRequiredField) Error() string {
 	return "thrift: missing required field: " + e.StructName + "." + e.FieldName
 }
 
+// FieldTypeMismatch is returned by generated DecodeThrift methods when a
+// field, or an element of a container field, has another type than declared.
+type FieldTypeMismatch struct {
+	StructName string
+	FieldName  string
+	Type       byte // type read from the stream
+}
+
+func (e *FieldTypeMismatch) Error() string {
+	return fmt.Sprintf("thrift: type mismatch for field %s.%s: got %s", e.StructName, e.FieldName, TypeNames[int(e.Type)])
+}
+
+// InvalidUnionError is returned when encoding or decoding a union that
+// doesn't have exactly one field set.
+type InvalidUnionError struct {
+	StructName string
+	Fields     int // number of fields set
+}
+
+func (e *InvalidUnionError) Error() string {
+	return fmt.Sprintf("thrift: union %s has %d fields set instead of 1", e.StructName, e.Fields)
+}
+
 type UnsupportedTypeError struct {
 	Type reflect.Type
 }
@@ -129,10 +158,22 @@ func (e *ApplicationException) String() string {
 		typeStr = "Internal Error"
 	case ExceptionProtocolError:
 		typeStr = "Protocol Error"
+	case ExceptionInvalidTransform:
+		typeStr = "Invalid Transform"
+	case ExceptionInvalidProtocol:
+		typeStr = "Invalid Protocol"
+	case ExceptionUnsupportedClient:
+		typeStr = "Unsupported Client Type"
+	case ExceptionLoadShedding:
+		typeStr = "Load Shedding"
 	}
 	return fmt.Sprintf("%s: %s", typeStr, e.Message)
 }
 
+func (e *ApplicationException) Error() string {
+	return e.String()
+}
+
 func fieldType(t reflect.Type) byte {
 	switch t.Kind() {
 	case reflect.Bool:
@@ -202,6 +243,7 @@ type encodeField struct {
 
 type structMeta struct {
 	required   *bitset // bitmap of required fields
+	union      bool    // fields have the union option, exactly one must be set
 	orderedIds []int
 	fields     map[int]encodeField
 }
@@ -259,6 +301,9 @@ func encodeFields(t reflect.Type) structMeta {
 				m.required.Set(id)
 			}
 			ef.keepEmpty = opts.Contains("keepempty")
+			if opts.Contains("union") {
+				m.union = true
+			}
 			if opts.Contains("set") {
 				ef.fieldType = TypeSet
 			} else {
@@ -0,0 +1,657 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// HeaderProtocolID identifies the protocol of the payload of a header frame.
+type HeaderProtocolID uint64
+
+const (
+	HeaderProtocolBinary  HeaderProtocolID = 0
+	HeaderProtocolCompact HeaderProtocolID = 2
+)
+
+// HeaderTransformID identifies a transform applied to the payload of a
+// header frame.
+type HeaderTransformID uint64
+
+const (
+	HeaderTransformZlib HeaderTransformID = 1
+)
+
+const (
+	headerMagic        = 0x0fff
+	headerInfoPadding  = 0
+	headerInfoKeyValue = 1
+	headerFixedSize    = 10 // magic, flags, seqid and header size following the frame size
+	maxHeaderSize      = 0xffff * 4
+)
+
+// headerFraming is how a message is framed on the wire.
+type headerFraming int
+
+const (
+	headerFramingHeader headerFraming = iota
+	headerFramingFramed
+	headerFramingUnframed
+)
+
+// HeaderTransport is a Transport that speaks the THeader format of
+// fbthrift and Apache Thrift: messages are sent in frames with the magic
+// 0x0FFF that carry key/value headers, the ID of the protocol of the payload
+// and the transforms applied to it.
+//
+// Binary and compact payloads are decoded according to their protocol ID.
+// Messages from legacy peers using unframed or framed strict binary protocol
+// are accepted as well.
+//
+// Server and Client keep the format and headers of each message they read:
+// a Server answers every request in the format it was received in, even when
+// the requests of a connection are handled concurrently, and both hand the
+// headers of a message to the call it belongs to (see RequestHeaders and
+// WithResponseHeaders). Code reading and writing messages itself gets the
+// headers of the last message read from ReadHeaders, and writes messages in
+// the format of the last message read.
+type HeaderTransport struct {
+	rwc          io.ReadWriteCloser
+	r            *bufio.Reader
+	maxFrameSize int64
+
+	reader   ProtocolReader // reader of the message being read
+	unframed ProtocolReader // binary reader over r for legacy peers
+	rtmp     []byte
+	frame    []byte
+
+	writer     ProtocolWriter // writer of the message being written
+	wbuf       bytes.Buffer
+	seqid      int32
+	out        headerFormat      // format of the message being written
+	outHeaders map[string]string // headers of the message being written, besides writeHeaders
+	next       *headerNext       // set by writeNext for the next message written
+
+	mu           sync.Mutex // protects following
+	format       headerFormat
+	writeHeaders map[string]string
+	lastRead     *headerMessage // nil until a message is read
+}
+
+type headerFormat struct {
+	framing    headerFraming
+	protocol   HeaderProtocolID
+	transforms []HeaderTransformID
+}
+
+// headerMessage is the format and headers of a message read.
+type headerMessage struct {
+	format  headerFormat
+	headers map[string]string
+}
+
+type headerNext struct {
+	reply   *headerMessage // request answered by the message, nil for a call
+	headers map[string]string
+}
+
+// messageHeaders is implemented by transports whose messages carry headers
+// and don't all use the same format, such as HeaderTransport. Server and
+// Client use it to keep them per message.
+type messageHeaders interface {
+	// readMessage returns the format and headers of the message last read,
+	// or nil if there's none.
+	readMessage() *headerMessage
+	// writeNext sets up the next message written: as a reply to the
+	// message read as reply, or in the transport's own format when reply
+	// is nil, with headers added to those set with SetWriteHeader.
+	writeNext(reply *headerMessage, headers map[string]string)
+}
+
+// NewHeaderTransport returns a HeaderTransport over rwc. Frames larger than
+// maxFrameSize, or DefaultMaxFrameSize when 0, are rejected. Until a message
+// is read, messages are written as header frames with binary protocol.
+func NewHeaderTransport(rwc io.ReadWriteCloser, maxFrameSize int) *HeaderTransport {
+	if maxFrameSize == 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	t := &HeaderTransport{
+		rwc:          rwc,
+		r:            bufio.NewReader(rwc),
+		maxFrameSize: int64(maxFrameSize),
+		rtmp:         make([]byte, 4),
+		writeHeaders: make(map[string]string),
+	}
+	t.unframed = NewBinaryProtocolReader(t.r, false)
+	t.reader = t.unframed
+	t.writer = NewBinaryProtocolWriter(&t.wbuf, true)
+	return t
+}
+
+// SetProtocol sets the protocol of the header frames written from now on.
+func (t *HeaderTransport) SetProtocol(id HeaderProtocolID) error {
+	if id != HeaderProtocolBinary && id != HeaderProtocolCompact {
+		return ProtocolError{"HeaderTransport", fmt.Sprintf("unsupported protocol ID %d", id)}
+	}
+	t.mu.Lock()
+	t.format.protocol = id
+	t.mu.Unlock()
+	return nil
+}
+
+// AddTransform adds a transform to apply to the payload of the header frames
+// written from now on.
+func (t *HeaderTransport) AddTransform(id HeaderTransformID) error {
+	if id != HeaderTransformZlib {
+		return ProtocolError{"HeaderTransport", fmt.Sprintf("unsupported transform ID %d", id)}
+	}
+	t.mu.Lock()
+	t.format.transforms = append(t.format.transforms[:len(t.format.transforms):len(t.format.transforms)], id)
+	t.mu.Unlock()
+	return nil
+}
+
+// ReadHeaders returns the headers of the last message read, so it must be
+// called before the next message is read. Server handlers get the headers of
+// their request with RequestHeaders instead, and Client calls those of their
+// response with WithResponseHeaders.
+func (t *HeaderTransport) ReadHeaders() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.lastRead == nil {
+		return nil
+	}
+	return t.lastRead.headers
+}
+
+// SetWriteHeader sets a header sent with every message written until it is
+// removed with ClearWriteHeaders, such as the identity of a client. Headers
+// of a single message are set with SetResponseHeader on servers and
+// WithRequestHeaders on clients. Legacy peers don't get headers.
+func (t *HeaderTransport) SetWriteHeader(key, value string) {
+	t.mu.Lock()
+	t.writeHeaders[key] = value
+	t.mu.Unlock()
+}
+
+// ClearWriteHeaders removes all the headers set with SetWriteHeader.
+func (t *HeaderTransport) ClearWriteHeaders() {
+	t.mu.Lock()
+	t.writeHeaders = make(map[string]string)
+	t.mu.Unlock()
+}
+
+// readFrame reads the start of the next message, which tells how it is
+// framed, and sets up the reader for it.
+func (t *HeaderTransport) readFrame() error {
+	b, err := t.r.Peek(4)
+	if err != nil {
+		if err == io.EOF && len(b) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if uint32(b[0])<<8|uint32(b[1]) == version1>>16 {
+		t.reader = t.unframed
+		t.setReadFormat(headerFormat{framing: headerFramingUnframed}, nil)
+		return nil
+	}
+
+	if _, err := io.ReadFull(t.r, t.rtmp); err != nil {
+		return err
+	}
+	size := int64(binary.BigEndian.Uint32(t.rtmp))
+	if size > t.maxFrameSize {
+		return ErrFrameTooBig{size, t.maxFrameSize}
+	}
+	if int64(cap(t.frame)) < size {
+		t.frame = make([]byte, size)
+	}
+	t.frame = t.frame[:size]
+	if _, err := io.ReadFull(t.r, t.frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	switch {
+	case size >= 2 && binary.BigEndian.Uint16(t.frame) == headerMagic:
+		return t.readHeaderFrame()
+	case size >= 2 && uint32(binary.BigEndian.Uint16(t.frame)) == version1>>16:
+		t.reader = NewBinaryProtocolReader(bytes.NewReader(t.frame), false)
+		t.setReadFormat(headerFormat{framing: headerFramingFramed}, nil)
+		return nil
+	}
+	return ProtocolError{"HeaderTransport", "unknown frame format"}
+}
+
+func (t *HeaderTransport) readHeaderFrame() error {
+	if len(t.frame) < headerFixedSize {
+		return ProtocolError{"HeaderTransport", "header frame too short"}
+	}
+	headerSize := int(binary.BigEndian.Uint16(t.frame[8:])) * 4
+	if headerFixedSize+headerSize > len(t.frame) {
+		return ProtocolError{"HeaderTransport", "header size larger than frame"}
+	}
+	hr := bytes.NewReader(t.frame[headerFixedSize : headerFixedSize+headerSize])
+	payload := t.frame[headerFixedSize+headerSize:]
+
+	format := headerFormat{framing: headerFramingHeader}
+	protocol, err := binary.ReadUvarint(hr)
+	if err != nil {
+		return ProtocolError{"HeaderTransport", "invalid protocol ID"}
+	}
+	format.protocol = HeaderProtocolID(protocol)
+	count, err := binary.ReadUvarint(hr)
+	if err != nil || count > uint64(hr.Len()) {
+		return ProtocolError{"HeaderTransport", "invalid transform count"}
+	}
+	for i := uint64(0); i < count; i++ {
+		id, err := binary.ReadUvarint(hr)
+		if err != nil {
+			return ProtocolError{"HeaderTransport", "invalid transform ID"}
+		}
+		if HeaderTransformID(id) != HeaderTransformZlib {
+			return ProtocolError{"HeaderTransport", fmt.Sprintf("unsupported transform ID %d", id)}
+		}
+		format.transforms = append(format.transforms, HeaderTransformID(id))
+	}
+
+	var headers map[string]string
+	for hr.Len() > 0 {
+		id, err := binary.ReadUvarint(hr)
+		if err != nil {
+			return ProtocolError{"HeaderTransport", "invalid info ID"}
+		}
+		if id == headerInfoPadding {
+			break
+		}
+		if id != headerInfoKeyValue {
+			// The size of other infos is unknown, so the rest of the
+			// header can't be parsed.
+			break
+		}
+		n, err := binary.ReadUvarint(hr)
+		if err != nil || n > uint64(hr.Len()) {
+			return ProtocolError{"HeaderTransport", "invalid header count"}
+		}
+		if headers == nil {
+			headers = make(map[string]string, n)
+		}
+		for i := uint64(0); i < n; i++ {
+			key, err := readHeaderString(hr)
+			if err != nil {
+				return err
+			}
+			value, err := readHeaderString(hr)
+			if err != nil {
+				return err
+			}
+			headers[key] = value
+		}
+	}
+
+	// Transforms are listed in the order they were applied.
+	for i := len(format.transforms) - 1; i >= 0; i-- {
+		zr, err := zlib.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		payload, err = ioutil.ReadAll(io.LimitReader(zr, t.maxFrameSize+1))
+		if err != nil {
+			return err
+		}
+		if size := int64(len(payload)); size > t.maxFrameSize {
+			return ErrFrameTooBig{size, t.maxFrameSize}
+		}
+	}
+
+	switch format.protocol {
+	case HeaderProtocolBinary:
+		t.reader = NewBinaryProtocolReader(bytes.NewReader(payload), false)
+	case HeaderProtocolCompact:
+		t.reader = NewCompactProtocolReader(bytes.NewReader(payload))
+	default:
+		return ProtocolError{"HeaderTransport", fmt.Sprintf("unsupported protocol ID %d", format.protocol)}
+	}
+	t.setReadFormat(format, headers)
+	return nil
+}
+
+func readHeaderString(r *bytes.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return "", ProtocolError{"HeaderTransport", "invalid header string"}
+	}
+	b := make([]byte, n)
+	r.Read(b)
+	return string(b), nil
+}
+
+func (t *HeaderTransport) setReadFormat(format headerFormat, headers map[string]string) {
+	t.mu.Lock()
+	t.lastRead = &headerMessage{format, headers}
+	t.mu.Unlock()
+}
+
+func (t *HeaderTransport) readMessage() *headerMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastRead
+}
+
+func (t *HeaderTransport) writeNext(reply *headerMessage, headers map[string]string) {
+	t.next = &headerNext{reply, headers}
+}
+
+func (t *HeaderTransport) ReadMessageBegin() (string, byte, int32, error) {
+	if err := t.readFrame(); err != nil {
+		return "", 0, 0, err
+	}
+	return t.reader.ReadMessageBegin()
+}
+
+func (t *HeaderTransport) ReadMessageEnd() error {
+	return t.reader.ReadMessageEnd()
+}
+
+func (t *HeaderTransport) ReadStructBegin() error {
+	return t.reader.ReadStructBegin()
+}
+
+func (t *HeaderTransport) ReadStructEnd() error {
+	return t.reader.ReadStructEnd()
+}
+
+func (t *HeaderTransport) ReadFieldBegin() (byte, int16, error) {
+	return t.reader.ReadFieldBegin()
+}
+
+func (t *HeaderTransport) ReadFieldEnd() error {
+	return t.reader.ReadFieldEnd()
+}
+
+func (t *HeaderTransport) ReadMapBegin() (byte, byte, int, error) {
+	return t.reader.ReadMapBegin()
+}
+
+func (t *HeaderTransport) ReadMapEnd() error {
+	return t.reader.ReadMapEnd()
+}
+
+func (t *HeaderTransport) ReadListBegin() (byte, int, error) {
+	return t.reader.ReadListBegin()
+}
+
+func (t *HeaderTransport) ReadListEnd() error {
+	return t.reader.ReadListEnd()
+}
+
+func (t *HeaderTransport) ReadSetBegin() (byte, int, error) {
+	return t.reader.ReadSetBegin()
+}
+
+func (t *HeaderTransport) ReadSetEnd() error {
+	return t.reader.ReadSetEnd()
+}
+
+func (t *HeaderTransport) ReadBool() (bool, error) {
+	return t.reader.ReadBool()
+}
+
+func (t *HeaderTransport) ReadByte() (byte, error) {
+	return t.reader.ReadByte()
+}
+
+func (t *HeaderTransport) ReadI16() (int16, error) {
+	return t.reader.ReadI16()
+}
+
+func (t *HeaderTransport) ReadI32() (int32, error) {
+	return t.reader.ReadI32()
+}
+
+func (t *HeaderTransport) ReadI64() (int64, error) {
+	return t.reader.ReadI64()
+}
+
+func (t *HeaderTransport) ReadDouble() (float64, error) {
+	return t.reader.ReadDouble()
+}
+
+func (t *HeaderTransport) ReadString() (string, error) {
+	return t.reader.ReadString()
+}
+
+func (t *HeaderTransport) ReadBytes() ([]byte, error) {
+	return t.reader.ReadBytes()
+}
+
+// WriteMessageBegin starts buffering a message in the format of the last
+// message read, or the one set with SetProtocol and AddTransform until a
+// message is read. It is sent by Flush.
+func (t *HeaderTransport) WriteMessageBegin(name string, messageType byte, seqid int32) error {
+	next := t.next
+	t.next = nil
+	t.outHeaders = nil
+	t.mu.Lock()
+	switch {
+	case next != nil && next.reply != nil:
+		t.out = next.reply.format
+	case next != nil || t.lastRead == nil:
+		t.out = t.format
+	default:
+		t.out = t.lastRead.format
+	}
+	t.mu.Unlock()
+	if next != nil {
+		t.outHeaders = next.headers
+	}
+	t.wbuf.Reset()
+	t.seqid = seqid
+	if t.out.framing == headerFramingHeader && t.out.protocol == HeaderProtocolCompact {
+		t.writer = NewCompactProtocolWriter(&t.wbuf)
+	} else {
+		t.writer = NewBinaryProtocolWriter(&t.wbuf, true)
+	}
+	return t.writer.WriteMessageBegin(name, messageType, seqid)
+}
+
+func (t *HeaderTransport) WriteMessageEnd() error {
+	return t.writer.WriteMessageEnd()
+}
+
+func (t *HeaderTransport) WriteStructBegin(name string) error {
+	return t.writer.WriteStructBegin(name)
+}
+
+func (t *HeaderTransport) WriteStructEnd() error {
+	return t.writer.WriteStructEnd()
+}
+
+func (t *HeaderTransport) WriteFieldBegin(name string, fieldType byte, id int16) error {
+	return t.writer.WriteFieldBegin(name, fieldType, id)
+}
+
+func (t *HeaderTransport) WriteFieldEnd() error {
+	return t.writer.WriteFieldEnd()
+}
+
+func (t *HeaderTransport) WriteFieldStop() error {
+	return t.writer.WriteFieldStop()
+}
+
+func (t *HeaderTransport) WriteMapBegin(keyType byte, valueType byte, size int) error {
+	return t.writer.WriteMapBegin(keyType, valueType, size)
+}
+
+func (t *HeaderTransport) WriteMapEnd() error {
+	return t.writer.WriteMapEnd()
+}
+
+func (t *HeaderTransport) WriteListBegin(elementType byte, size int) error {
+	return t.writer.WriteListBegin(elementType, size)
+}
+
+func (t *HeaderTransport) WriteListEnd() error {
+	return t.writer.WriteListEnd()
+}
+
+func (t *HeaderTransport) WriteSetBegin(elementType byte, size int) error {
+	return t.writer.WriteSetBegin(elementType, size)
+}
+
+func (t *HeaderTransport) WriteSetEnd() error {
+	return t.writer.WriteSetEnd()
+}
+
+func (t *HeaderTransport) WriteBool(value bool) error {
+	return t.writer.WriteBool(value)
+}
+
+func (t *HeaderTransport) WriteByte(value byte) error {
+	return t.writer.WriteByte(value)
+}
+
+func (t *HeaderTransport) WriteI16(value int16) error {
+	return t.writer.WriteI16(value)
+}
+
+func (t *HeaderTransport) WriteI32(value int32) error {
+	return t.writer.WriteI32(value)
+}
+
+func (t *HeaderTransport) WriteI64(value int64) error {
+	return t.writer.WriteI64(value)
+}
+
+func (t *HeaderTransport) WriteDouble(value float64) error {
+	return t.writer.WriteDouble(value)
+}
+
+func (t *HeaderTransport) WriteString(value string) error {
+	return t.writer.WriteString(value)
+}
+
+func (t *HeaderTransport) WriteBytes(value []byte) error {
+	return t.writer.WriteBytes(value)
+}
+
+// Flush sends the buffered message.
+func (t *HeaderTransport) Flush() error {
+	if t.wbuf.Len() == 0 {
+		return nil
+	}
+	defer t.wbuf.Reset()
+
+	var out []byte
+	switch t.out.framing {
+	case headerFramingUnframed:
+		out = t.wbuf.Bytes()
+	case headerFramingFramed:
+		if size := int64(t.wbuf.Len()); size > t.maxFrameSize {
+			return ErrFrameTooBig{size, t.maxFrameSize}
+		}
+		out = make([]byte, 4, 4+t.wbuf.Len())
+		binary.BigEndian.PutUint32(out, uint32(t.wbuf.Len()))
+		out = append(out, t.wbuf.Bytes()...)
+	default:
+		var err error
+		if out, err = t.headerFrame(); err != nil {
+			return err
+		}
+	}
+	_, err := t.rwc.Write(out)
+	return err
+}
+
+// headerFrame returns the buffered message as a header frame.
+func (t *HeaderTransport) headerFrame() ([]byte, error) {
+	header := make([]byte, 0, 64)
+	header = appendUvarint(header, uint64(t.out.protocol))
+	header = appendUvarint(header, uint64(len(t.out.transforms)))
+	for _, id := range t.out.transforms {
+		header = appendUvarint(header, uint64(id))
+	}
+	headers := t.outHeaders
+	t.mu.Lock()
+	if len(t.writeHeaders) > 0 {
+		headers = make(map[string]string, len(t.writeHeaders)+len(t.outHeaders))
+		for k, v := range t.writeHeaders {
+			headers[k] = v
+		}
+		for k, v := range t.outHeaders {
+			headers[k] = v
+		}
+	}
+	t.mu.Unlock()
+	if len(headers) > 0 {
+		keys := make([]string, 0, len(headers))
+		for k := range headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		header = appendUvarint(header, headerInfoKeyValue)
+		header = appendUvarint(header, uint64(len(keys)))
+		for _, k := range keys {
+			header = appendUvarint(header, uint64(len(k)))
+			header = append(header, k...)
+			header = appendUvarint(header, uint64(len(headers[k])))
+			header = append(header, headers[k]...)
+		}
+	}
+	for len(header)%4 != 0 {
+		header = append(header, headerInfoPadding)
+	}
+	if len(header) > maxHeaderSize {
+		return nil, ProtocolError{"HeaderTransport", "headers too large"}
+	}
+
+	payload := t.wbuf.Bytes()
+	for range t.out.transforms {
+		var b bytes.Buffer
+		zw := zlib.NewWriter(&b)
+		if _, err := zw.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		payload = b.Bytes()
+	}
+
+	size := int64(headerFixedSize + len(header) + len(payload))
+	if size > t.maxFrameSize {
+		return nil, ErrFrameTooBig{size, t.maxFrameSize}
+	}
+	out := make([]byte, 4+headerFixedSize, 4+size)
+	binary.BigEndian.PutUint32(out, uint32(size))
+	binary.BigEndian.PutUint16(out[4:], headerMagic)
+	binary.BigEndian.PutUint16(out[6:], 0) // flags
+	binary.BigEndian.PutUint32(out[8:], uint32(t.seqid))
+	binary.BigEndian.PutUint16(out[12:], uint16(len(header)/4))
+	out = append(out, header...)
+	out = append(out, payload...)
+	return out, nil
+}
+
+func (t *HeaderTransport) Close() error {
+	return t.rwc.Close()
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(b, tmp[:n]...)
+}
@@ -0,0 +1,260 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestHeaderTransportFrame(t *testing.T) {
+	buf := &ClosingBuffer{&bytes.Buffer{}}
+	tr := NewHeaderTransport(buf, 0)
+	tr.SetWriteHeader("k", "v")
+	if err := tr.WriteMessageBegin("f", MessageTypeCall, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.WriteStructBegin("args"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.WriteFieldStop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.WriteStructEnd(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.WriteMessageEnd(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		0, 0, 0, 32, // frame size
+		0x0f, 0xff, 0, 0, // magic and flags
+		0, 0, 0, 3, // seqid
+		0, 2, // header size / 4
+		0, 0, 1, 1, 1, 'k', 1, 'v', // binary, no transforms, key/value headers
+		0x80, 1, 0, 1, 0, 0, 0, 1, 'f', 0, 0, 0, 3, 0, // payload
+	}
+	if out := buf.Bytes(); !bytes.Equal(out, expected) {
+		t.Fatalf("HeaderTransport wrote\n%v\ninstead of\n%v", out, expected)
+	}
+
+	tr = NewHeaderTransport(buf, 0)
+	name, mtype, seq, err := tr.ReadMessageBegin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "f" || mtype != MessageTypeCall || seq != 3 {
+		t.Fatalf("Unexpected message header %s %d %d", name, mtype, seq)
+	}
+	if err := SkipValue(tr, TypeStruct); err != nil {
+		t.Fatal(err)
+	}
+	if h := tr.ReadHeaders(); !reflect.DeepEqual(h, map[string]string{"k": "v"}) {
+		t.Fatalf("Unexpected read headers %+v", h)
+	}
+}
+
+func TestHeaderTransportCompactZlib(t *testing.T) {
+	buf := &ClosingBuffer{&bytes.Buffer{}}
+	w := NewHeaderTransport(buf, 0)
+	if err := w.SetProtocol(HeaderProtocolCompact); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddTransform(HeaderTransformZlib); err != nil {
+		t.Fatal(err)
+	}
+	w.SetWriteHeader("user", "alice")
+	w.SetWriteHeader("trace", "1234")
+	if err := w.WriteMessageBegin("echo", MessageTypeCall, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeStruct(w, &TestRequest{123}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteMessageEnd(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewHeaderTransport(buf, 0)
+	if _, _, _, err := r.ReadMessageBegin(); err != nil {
+		t.Fatal(err)
+	}
+	req := &TestRequest{}
+	if err := DecodeStruct(r, req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Value != 123 {
+		t.Fatalf("Expected 123, got %d", req.Value)
+	}
+	if h := r.ReadHeaders(); !reflect.DeepEqual(h, map[string]string{"user": "alice", "trace": "1234"}) {
+		t.Fatalf("Unexpected read headers %+v", h)
+	}
+
+	// The reply uses the protocol and transforms of the request.
+	if err := r.WriteMessageBegin("echo", MessageTypeReply, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeStruct(r, &TestResponse{123}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WriteMessageEnd(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+	if len(out) < 17 || out[4] != 0x0f || out[5] != 0xff || out[14] != byte(HeaderProtocolCompact) || out[15] != 1 || out[16] != byte(HeaderTransformZlib) {
+		t.Fatalf("Unexpected reply frame %v", out)
+	}
+}
+
+func TestHeaderTransportServer(t *testing.T) {
+	srv := &Server{
+		Processor: &testProcessor{},
+		NewTransport: func(conn net.Conn) Transport {
+			return NewHeaderTransport(conn, 0)
+		},
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewHeaderTransport(conn, 0)
+	if err := tr.SetProtocol(HeaderProtocolCompact); err != nil {
+		t.Fatal(err)
+	}
+	clients := map[string]*Client{"header": NewNativeClient(tr, false)}
+	for name, framed := range map[string]bool{"framed": true, "unframed": false} {
+		c, err := DialClient("tcp", ln.Addr().String(), framed, BinaryProtocol, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients[name] = c
+	}
+
+	for name, c := range clients {
+		res := &TestResponse{}
+		if err := c.Call("echo", &TestRequest{123}, res); err != nil {
+			t.Fatalf("%s client: %+v", name, err)
+		}
+		if res.Value != 123 {
+			t.Fatalf("%s client: response value wrong: %d != 123", name, res.Value)
+		}
+		c.Close()
+	}
+}
+
+// startHeaderTestServer serves testProcessor over HeaderTransport, echoing
+// the "id" header of requests in their response.
+func startHeaderTestServer(t *testing.T) string {
+	srv := &Server{
+		Processor: &testProcessor{},
+		NewTransport: func(conn net.Conn) Transport {
+			return NewHeaderTransport(conn, 0)
+		},
+		Middleware: []Middleware{
+			func(ctx context.Context, method string, req, res interface{}, next Handler) error {
+				SetResponseHeader(ctx, "id", RequestHeaders(ctx)["id"])
+				return next(ctx, method, req, res)
+			},
+		},
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func dialHeaderClient(t *testing.T, addr string) *Client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewNativeClient(NewHeaderTransport(conn, 0), false)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// callWithID makes a call with the "id" request header and checks the
+// response echoes it.
+func callWithID(t *testing.T, c *Client, id string) {
+	headers := make(map[string]string)
+	ctx := WithRequestHeaders(context.Background(), map[string]string{"id": id})
+	ctx = WithResponseHeaders(ctx, headers)
+	if err := c.CallContext(ctx, "echo", &TestRequest{1}, &TestResponse{}); err != nil {
+		t.Error(err)
+		return
+	}
+	if headers["id"] != id {
+		t.Errorf("response header id = %q, want %q", headers["id"], id)
+	}
+}
+
+func TestHeaderTransportCallHeaders(t *testing.T) {
+	c := dialHeaderClient(t, startHeaderTestServer(t))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			callWithID(t, c, id)
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+}
+
+// A context asking for the response headers can be fanned out to concurrent
+// calls through several clients.
+func TestHeaderTransportSharedResponseHeaders(t *testing.T) {
+	addr := startHeaderTestServer(t)
+	clients := []*Client{dialHeaderClient(t, addr), dialHeaderClient(t, addr)}
+
+	headers := make(map[string]string)
+	ctx := WithRequestHeaders(context.Background(), map[string]string{"id": "shared"})
+	ctx = WithResponseHeaders(ctx, headers)
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(c *Client) {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					if err := c.CallContext(ctx, "echo", &TestRequest{1}, &TestResponse{}); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}(c)
+		}
+	}
+	wg.Wait()
+	if headers["id"] != "shared" {
+		t.Fatalf("response header id = %q, want %q", headers["id"], "shared")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+const compactProtocolIDByte = 0x82
+
+// sniffingTransport picks the framing and protocol of a connection from the
+// first bytes the peer sends.
+type sniffingTransport struct {
+	Transport // nil until the first message is read
+
+	conn         io.ReadWriteCloser
+	maxFrameSize int
+}
+
+// NewSniffingTransport returns a Transport for servers that detects how a
+// client speaks from the start of its first message: framed or unframed,
+// binary or compact protocol, or header frames (see HeaderTransport). Frames
+// larger than maxFrameSize, or DefaultMaxFrameSize when 0, are rejected.
+// Messages can't be written before one is read.
+func NewSniffingTransport(conn io.ReadWriteCloser, maxFrameSize int) Transport {
+	return &sniffingTransport{conn: conn, maxFrameSize: maxFrameSize}
+}
+
+func (t *sniffingTransport) sniff() error {
+	r := bufio.NewReader(t.conn)
+	rwc := &readWriteCloser{r, t.conn, t.conn}
+	b, err := peek(r, 2)
+	if err != nil {
+		return err
+	}
+	switch {
+	case uint32(binary.BigEndian.Uint16(b)) == version1>>16:
+		t.Transport = NewTransport(rwc, BinaryProtocol)
+		return nil
+	case b[0] == compactProtocolIDByte:
+		t.Transport = NewTransport(rwc, CompactProtocol)
+		return nil
+	}
+
+	// Anything else must start with the size of a frame.
+	if b, err = peek(r, 6); err != nil {
+		return err
+	}
+	switch {
+	case binary.BigEndian.Uint16(b[4:]) == headerMagic:
+		t.Transport = NewHeaderTransport(rwc, t.maxFrameSize)
+	case uint32(binary.BigEndian.Uint16(b[4:])) == version1>>16:
+		t.Transport = NewTransport(NewFramedReadWriteCloser(rwc, t.maxFrameSize), BinaryProtocol)
+	case b[4] == compactProtocolIDByte:
+		t.Transport = NewTransport(NewFramedReadWriteCloser(rwc, t.maxFrameSize), CompactProtocol)
+	default:
+		return ProtocolError{"SniffingTransport", "unrecognized framing or protocol"}
+	}
+	return nil
+}
+
+func peek(r *bufio.Reader, n int) ([]byte, error) {
+	b, err := r.Peek(n)
+	if err == io.EOF && len(b) > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+func (t *sniffingTransport) ReadMessageBegin() (string, byte, int32, error) {
+	if t.Transport == nil {
+		if err := t.sniff(); err != nil {
+			return "", 0, 0, err
+		}
+	}
+	return t.Transport.ReadMessageBegin()
+}
+
+func (t *sniffingTransport) WriteMessageBegin(name string, messageType byte, seqid int32) error {
+	if t.Transport == nil {
+		return ProtocolError{"SniffingTransport", "protocol unknown until a message is read"}
+	}
+	return t.Transport.WriteMessageBegin(name, messageType, seqid)
+}
+
+func (t *sniffingTransport) readMessage() *headerMessage {
+	if h, ok := t.Transport.(messageHeaders); ok {
+		return h.readMessage()
+	}
+	return nil
+}
+
+func (t *sniffingTransport) writeNext(reply *headerMessage, headers map[string]string) {
+	if h, ok := t.Transport.(messageHeaders); ok {
+		h.writeNext(reply, headers)
+	}
+}
+
+func (t *sniffingTransport) Flush() error {
+	if t.Transport == nil {
+		return nil
+	}
+	return t.Transport.Flush()
+}
+
+func (t *sniffingTransport) Close() error {
+	return t.conn.Close()
+}
+
+// readWriteCloser reads through a buffer holding the bytes already peeked.
+type readWriteCloser struct {
+	io.Reader
+	io.Writer
+	io.Closer
+}
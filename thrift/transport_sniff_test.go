@@ -0,0 +1,71 @@
+// Copyright 2012-2015 Samuel Stauffer. All rights reserved.
+// Use of this source code is governed by a 3-clause BSD
+// license that can be found in the LICENSE file.
+
+package thrift
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestSniffingTransport(t *testing.T) {
+	srv := &Server{
+		Processor: &testProcessor{},
+		NewTransport: func(conn net.Conn) Transport {
+			return NewSniffingTransport(conn, 0)
+		},
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer ln.Close()
+
+	tests := []struct {
+		name     string
+		framed   bool
+		protocol ProtocolBuilder
+	}{
+		{"framed binary", true, BinaryProtocol},
+		{"unframed binary", false, BinaryProtocol},
+		{"framed compact", true, CompactProtocol},
+		{"unframed compact", false, CompactProtocol},
+		{"header", false, nil},
+	}
+	for _, test := range tests {
+		var c *Client
+		if test.protocol == nil {
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			c = NewNativeClient(NewHeaderTransport(conn, 0), false)
+		} else if c, err = DialClient("tcp", ln.Addr().String(), test.framed, test.protocol, false); err != nil {
+			t.Fatal(err)
+		}
+		for i := int32(1); i <= 2; i++ {
+			res := &TestResponse{}
+			if err := c.Call("echo", &TestRequest{i}, res); err != nil {
+				t.Fatalf("%s: %+v", test.name, err)
+			}
+			if res.Value != i {
+				t.Fatalf("%s: response value wrong: %d != %d", test.name, res.Value, i)
+			}
+		}
+		c.Close()
+	}
+}
+
+func TestSniffingTransportUnrecognized(t *testing.T) {
+	buf := &ClosingBuffer{bytes.NewBufferString("GET / HTTP/1.1\r\n")}
+	tr := NewSniffingTransport(buf, 0)
+	if _, _, _, err := tr.ReadMessageBegin(); err == nil {
+		t.Fatal("Expected an error for an unrecognized protocol")
+	}
+	if err := tr.WriteMessageBegin("echo", MessageTypeReply, 1); err == nil {
+		t.Fatal("Expected an error writing before the protocol is known")
+	}
+}